@@ -1,10 +1,20 @@
 package neuralnet
 
 import (
+	"encoding/json"
+	"math"
+
 	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/num-analysis/linalg"
 )
 
+const (
+	defaultLeakyReLUSlope = 0.01
+
+	seluScale = 1.0507009873554804934193349852946
+	seluAlpha = 1.6732632423543772848170429916717
+)
+
 // Sigmoid is a Layer which applies the
 // logistic sigmoid function.
 type Sigmoid struct{}
@@ -188,3 +198,455 @@ func (_ Sin) SerializerType() string {
 func (_ Sin) Serialize() ([]byte, error) {
 	return []byte{}, nil
 }
+
+// LeakyReLU is like ReLU, except that negative inputs
+// are multiplied by a small slope instead of being
+// set to zero.
+type LeakyReLU struct {
+	// Slope is the slope of the function for negative
+	// inputs.
+	// If this is 0, a reasonable default is used.
+	Slope float64
+}
+
+// DeserializeLeakyReLU deserializes a LeakyReLU.
+func DeserializeLeakyReLU(d []byte) (*LeakyReLU, error) {
+	var res LeakyReLU
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (l *LeakyReLU) Apply(r autofunc.Result) autofunc.Result {
+	return l.elementwise().Apply(r)
+}
+
+func (l *LeakyReLU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return l.elementwise().ApplyR(v, r)
+}
+
+func (l *LeakyReLU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return l.Apply(inputs)
+}
+
+func (l *LeakyReLU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return l.ApplyR(v, inputs)
+}
+
+func (l *LeakyReLU) Serialize() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+func (l *LeakyReLU) SerializerType() string {
+	return serializerTypeLeakyReLU
+}
+
+func (l *LeakyReLU) elementwise() *elementwiseFunc {
+	slope := l.Slope
+	if slope == 0 {
+		slope = defaultLeakyReLUSlope
+	}
+	return &elementwiseFunc{
+		F: func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return slope * x
+		},
+		D: func(x float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return slope
+		},
+		DD: func(x float64) float64 {
+			return 0
+		},
+	}
+}
+
+// ELU is a Layer which applies the exponential linear
+// unit, as described in https://arxiv.org/abs/1511.07289.
+type ELU struct {
+	// Alpha is the value which the function approaches
+	// as its input approaches negative infinity.
+	// If this is 0, 1 is used.
+	Alpha float64
+}
+
+// DeserializeELU deserializes an ELU.
+func DeserializeELU(d []byte) (*ELU, error) {
+	var res ELU
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (e *ELU) Apply(r autofunc.Result) autofunc.Result {
+	return e.elementwise().Apply(r)
+}
+
+func (e *ELU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return e.elementwise().ApplyR(v, r)
+}
+
+func (e *ELU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return e.Apply(inputs)
+}
+
+func (e *ELU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return e.ApplyR(v, inputs)
+}
+
+func (e *ELU) Serialize() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e *ELU) SerializerType() string {
+	return serializerTypeELU
+}
+
+func (e *ELU) elementwise() *elementwiseFunc {
+	alpha := e.Alpha
+	if alpha == 0 {
+		alpha = 1
+	}
+	return eluFunc(1, alpha)
+}
+
+// SELU is a Layer which applies the scaled exponential
+// linear unit, as described in
+// https://arxiv.org/abs/1706.02515.
+type SELU struct{}
+
+func (_ SELU) Apply(r autofunc.Result) autofunc.Result {
+	return eluFunc(seluScale, seluAlpha).Apply(r)
+}
+
+func (_ SELU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return eluFunc(seluScale, seluAlpha).ApplyR(v, r)
+}
+
+func (_ SELU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return SELU{}.Apply(inputs)
+}
+
+func (_ SELU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return SELU{}.ApplyR(v, inputs)
+}
+
+func (_ SELU) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ SELU) SerializerType() string {
+	return serializerTypeSELU
+}
+
+// eluFunc creates a (possibly scaled) ELU function.
+func eluFunc(scale, alpha float64) *elementwiseFunc {
+	return &elementwiseFunc{
+		F: func(x float64) float64 {
+			if x > 0 {
+				return scale * x
+			}
+			return scale * alpha * (math.Exp(x) - 1)
+		},
+		D: func(x float64) float64 {
+			if x > 0 {
+				return scale
+			}
+			return scale * alpha * math.Exp(x)
+		},
+		DD: func(x float64) float64 {
+			if x > 0 {
+				return 0
+			}
+			return scale * alpha * math.Exp(x)
+		},
+	}
+}
+
+// Softplus is a Layer which applies the function
+// log(1+exp(x)), a smooth approximation of ReLU.
+type Softplus struct{}
+
+func (_ Softplus) Apply(r autofunc.Result) autofunc.Result {
+	return softplusFunc.Apply(r)
+}
+
+func (_ Softplus) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return softplusFunc.ApplyR(v, r)
+}
+
+func (_ Softplus) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return Softplus{}.Apply(inputs)
+}
+
+func (_ Softplus) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return Softplus{}.ApplyR(v, inputs)
+}
+
+func (_ Softplus) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ Softplus) SerializerType() string {
+	return serializerTypeSoftplus
+}
+
+var softplusFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		return math.Max(x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+	},
+	D: scalarSigmoid,
+	DD: func(x float64) float64 {
+		s := scalarSigmoid(x)
+		return s * (1 - s)
+	},
+}
+
+// Swish is a Layer which applies the function
+// x*sigmoid(x), also known as SiLU, as described in
+// https://arxiv.org/abs/1710.05941.
+type Swish struct{}
+
+func (_ Swish) Apply(r autofunc.Result) autofunc.Result {
+	return swishFunc.Apply(r)
+}
+
+func (_ Swish) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return swishFunc.ApplyR(v, r)
+}
+
+func (_ Swish) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return Swish{}.Apply(inputs)
+}
+
+func (_ Swish) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return Swish{}.ApplyR(v, inputs)
+}
+
+func (_ Swish) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ Swish) SerializerType() string {
+	return serializerTypeSwish
+}
+
+var swishFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		return x * scalarSigmoid(x)
+	},
+	D: func(x float64) float64 {
+		s := scalarSigmoid(x)
+		return s + x*s*(1-s)
+	},
+	DD: func(x float64) float64 {
+		s := scalarSigmoid(x)
+		return s * (1 - s) * (2 + x*(1-2*s))
+	},
+}
+
+// GELU is a Layer which applies the Gaussian error
+// linear unit x*Phi(x), where Phi is the CDF of the
+// standard normal distribution, as described in
+// https://arxiv.org/abs/1606.08415.
+type GELU struct{}
+
+func (_ GELU) Apply(r autofunc.Result) autofunc.Result {
+	return geluFunc.Apply(r)
+}
+
+func (_ GELU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return geluFunc.ApplyR(v, r)
+}
+
+func (_ GELU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return GELU{}.Apply(inputs)
+}
+
+func (_ GELU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return GELU{}.ApplyR(v, inputs)
+}
+
+func (_ GELU) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ GELU) SerializerType() string {
+	return serializerTypeGELU
+}
+
+var geluFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		return x * normalCDF(x)
+	},
+	D: func(x float64) float64 {
+		return normalCDF(x) + x*normalPDF(x)
+	},
+	DD: func(x float64) float64 {
+		return normalPDF(x) * (2 - x*x)
+	},
+}
+
+// HardSigmoid is a Layer which applies a piecewise
+// linear approximation of the logistic sigmoid,
+// max(0, min(1, 0.2*x+0.5)).
+type HardSigmoid struct{}
+
+func (_ HardSigmoid) Apply(r autofunc.Result) autofunc.Result {
+	return hardSigmoidFunc.Apply(r)
+}
+
+func (_ HardSigmoid) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	return hardSigmoidFunc.ApplyR(v, r)
+}
+
+func (_ HardSigmoid) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return HardSigmoid{}.Apply(inputs)
+}
+
+func (_ HardSigmoid) BatchR(v autofunc.RVector, inputs autofunc.RResult,
+	n int) autofunc.RResult {
+	return HardSigmoid{}.ApplyR(v, inputs)
+}
+
+func (_ HardSigmoid) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (_ HardSigmoid) SerializerType() string {
+	return serializerTypeHardSigmoid
+}
+
+var hardSigmoidFunc = &elementwiseFunc{
+	F: func(x float64) float64 {
+		return math.Max(0, math.Min(1, 0.2*x+0.5))
+	},
+	D: func(x float64) float64 {
+		if x <= -2.5 || x >= 2.5 {
+			return 0
+		}
+		return 0.2
+	},
+	DD: func(x float64) float64 {
+		return 0
+	},
+}
+
+func scalarSigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func normalCDF(x float64) float64 {
+	return 0.5 * (1 + math.Erf(x/math.Sqrt2))
+}
+
+func normalPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+// elementwiseFunc applies a twice-differentiable scalar
+// function to every component of its input.
+type elementwiseFunc struct {
+	// F is the function itself.
+	F func(x float64) float64
+
+	// D is the first derivative of F.
+	D func(x float64) float64
+
+	// DD is the second derivative of F, which is needed
+	// to propagate R-gradients.
+	DD func(x float64) float64
+}
+
+func (e *elementwiseFunc) Apply(r autofunc.Result) autofunc.Result {
+	inVec := r.Output()
+	vec := make(linalg.Vector, len(inVec))
+	for i, x := range inVec {
+		vec[i] = e.F(x)
+	}
+	return &elementwiseResult{
+		OutputVec: vec,
+		Input:     r,
+		Func:      e,
+	}
+}
+
+func (e *elementwiseFunc) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	inVec := r.Output()
+	inVecR := r.ROutput()
+	vec := make(linalg.Vector, len(inVec))
+	vecR := make(linalg.Vector, len(inVec))
+	for i, x := range inVec {
+		vec[i] = e.F(x)
+		vecR[i] = e.D(x) * inVecR[i]
+	}
+	return &elementwiseRResult{
+		OutputVec:  vec,
+		ROutputVec: vecR,
+		Input:      r,
+		Func:       e,
+	}
+}
+
+type elementwiseResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	Func      *elementwiseFunc
+}
+
+func (e *elementwiseResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elementwiseResult) Constant(g autofunc.Gradient) bool {
+	return e.Input.Constant(g)
+}
+
+func (e *elementwiseResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	if e.Input.Constant(grad) {
+		return
+	}
+	for i, x := range e.Input.Output() {
+		upstream[i] *= e.Func.D(x)
+	}
+	e.Input.PropagateGradient(upstream, grad)
+}
+
+type elementwiseRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	Func       *elementwiseFunc
+}
+
+func (e *elementwiseRResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *elementwiseRResult) ROutput() linalg.Vector {
+	return e.ROutputVec
+}
+
+func (e *elementwiseRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return e.Input.Constant(rg, g)
+}
+
+func (e *elementwiseRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if e.Input.Constant(rgrad, grad) {
+		return
+	}
+	inR := e.Input.ROutput()
+	for i, x := range e.Input.Output() {
+		deriv := e.Func.D(x)
+		upstreamR[i] = upstreamR[i]*deriv + upstream[i]*e.Func.DD(x)*inR[i]
+		upstream[i] *= deriv
+	}
+	e.Input.PropagateRGradient(upstream, upstreamR, rgrad, grad)
+}
@@ -0,0 +1,137 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestActivationOutputs(t *testing.T) {
+	input := linalg.Vector{-2, -0.5, 0.5, 3}
+	tests := []struct {
+		Layer    autofunc.Func
+		Expected []float64
+	}{
+		{&LeakyReLU{}, []float64{-0.02, -0.005, 0.5, 3}},
+		{&LeakyReLU{Slope: 0.5}, []float64{-1, -0.25, 0.5, 3}},
+		{&ELU{}, []float64{math.Exp(-2) - 1, math.Exp(-0.5) - 1, 0.5, 3}},
+		{SELU{}, []float64{seluScale * seluAlpha * (math.Exp(-2) - 1),
+			seluScale * seluAlpha * (math.Exp(-0.5) - 1), seluScale * 0.5, seluScale * 3}},
+		{Softplus{}, []float64{math.Log(1 + math.Exp(-2)), math.Log(1 + math.Exp(-0.5)),
+			math.Log(1 + math.Exp(0.5)), math.Log(1 + math.Exp(3))}},
+		{Swish{}, []float64{-2 / (1 + math.Exp(2)), -0.5 / (1 + math.Exp(0.5)),
+			0.5 / (1 + math.Exp(-0.5)), 3 / (1 + math.Exp(-3))}},
+		{GELU{}, []float64{-0.04550026389635842, -0.15426876936299347,
+			0.34573123063700656, 2.9959503059051097}},
+		{HardSigmoid{}, []float64{0.1, 0.4, 0.6, 1}},
+		{NewPReLU(2), []float64{-0.5, -0.125, 0.5, 3}},
+	}
+	for i, test := range tests {
+		actual := test.Layer.Apply(&autofunc.Variable{Vector: input}).Output()
+		for j, x := range test.Expected {
+			if math.Abs(actual[j]-x) > 1e-8 {
+				t.Errorf("test %d (%T): output %d should be %f but got %f", i,
+					test.Layer, j, x, actual[j])
+			}
+		}
+	}
+}
+
+func TestActivationRProp(t *testing.T) {
+	prelu := NewPReLU(3)
+	for i := range prelu.Slopes.Vector {
+		prelu.Slopes.Vector[i] = rand.NormFloat64()
+	}
+	layers := []autofunc.RFunc{
+		&LeakyReLU{Slope: 0.3},
+		&ELU{Alpha: 1.5},
+		SELU{},
+		Softplus{},
+		Swish{},
+		GELU{},
+		HardSigmoid{},
+		prelu,
+	}
+	for _, layer := range layers {
+		inVar := &autofunc.Variable{Vector: make(linalg.Vector, 12)}
+		for i := range inVar.Vector {
+			inVar.Vector[i] = rand.Float64()*6 - 3
+		}
+		variables := []*autofunc.Variable{inVar}
+		if learner, ok := layer.(*PReLU); ok {
+			variables = append(variables, learner.Parameters()...)
+		}
+		rVector := autofunc.RVector{}
+		for _, variable := range variables {
+			rVector[variable] = make(linalg.Vector, len(variable.Vector))
+			for i := range rVector[variable] {
+				rVector[variable][i] = rand.Float64()*2 - 1
+			}
+		}
+		funcTest := &functest.RFuncChecker{
+			F:     layer,
+			Vars:  variables,
+			Input: inVar,
+			RV:    rVector,
+		}
+		funcTest.FullCheck(t)
+	}
+}
+
+func TestPReLUBatch(t *testing.T) {
+	layer := NewPReLU(3)
+	for i := range layer.Slopes.Vector {
+		layer.Slopes.Vector[i] = rand.NormFloat64()
+	}
+
+	n := 4
+	batchRes := &autofunc.Variable{Vector: make(linalg.Vector, n*6)}
+	for i := range batchRes.Vector {
+		batchRes.Vector[i] = rand.NormFloat64()
+	}
+	params := []*autofunc.Variable{batchRes, layer.Slopes}
+
+	rVec := autofunc.RVector{}
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+		rVec[param] = vec
+	}
+
+	testBatcher(t, layer, batchRes, n, params)
+	testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec), n, params)
+}
+
+func TestActivationSerialize(t *testing.T) {
+	layers := []serializer.Serializer{
+		&LeakyReLU{Slope: 0.3},
+		&ELU{Alpha: 1.5},
+		&SELU{},
+		&Softplus{},
+		&Swish{},
+		&GELU{},
+		&HardSigmoid{},
+		NewPReLU(3),
+	}
+	for _, layer := range layers {
+		encoded, err := layer.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := serializer.GetDeserializer(layer.SerializerType())(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, layer) {
+			t.Errorf("expected %v but got %v", layer, decoded)
+		}
+	}
+}
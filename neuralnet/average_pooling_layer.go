@@ -0,0 +1,261 @@
+package neuralnet
+
+import (
+	"encoding/json"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/tensor"
+)
+
+// An AveragePoolingLayer reduces the width and height
+// of an input tensor by returning the mean value of
+// each of many small two-dimensional regions in each
+// depth layer of the input tensor.
+//
+// Pools on the right and bottom edges of the input may
+// be smaller than XSpan by YSpan, in which case they are
+// averaged over the inputs they actually cover.
+type AveragePoolingLayer struct {
+	// XSpan indicates how many consecutive
+	// horizontal inputs correspond to a pool.
+	XSpan int
+
+	// YSpan indicates how many consecutive
+	// vertical inputs correspond to a pool.
+	YSpan int
+
+	// InputWidth indicates the width of the
+	// layer's input tensor.
+	InputWidth int
+
+	// InputHeight indicates the height of the
+	// layer's input tensor.
+	InputHeight int
+
+	// InputDepth indicates the depth of the
+	// layer's input tensor.
+	InputDepth int
+}
+
+// DeserializeAveragePoolingLayer deserializes an
+// AveragePoolingLayer.
+func DeserializeAveragePoolingLayer(d []byte) (*AveragePoolingLayer, error) {
+	var res AveragePoolingLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OutputWidth returns the output tensor width.
+func (a *AveragePoolingLayer) OutputWidth() int {
+	w := a.InputWidth / a.XSpan
+	if (a.InputWidth % a.XSpan) != 0 {
+		w++
+	}
+	return w
+}
+
+// OutputHeight returns the output tensor height.
+func (a *AveragePoolingLayer) OutputHeight() int {
+	h := a.InputHeight / a.YSpan
+	if (a.InputHeight % a.YSpan) != 0 {
+		h++
+	}
+	return h
+}
+
+// Apply applies the layer to an input, which is treated
+// as a tensor.
+func (a *AveragePoolingLayer) Apply(in autofunc.Result) autofunc.Result {
+	return a.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (a *AveragePoolingLayer) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return a.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (a *AveragePoolingLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	if len(in.Output()) != n*a.inputSize() {
+		panic("invalid input size")
+	}
+	return &averagePoolingResult{
+		OutputVec: a.pool(in.Output(), n),
+		Input:     in,
+		N:         n,
+		Layer:     a,
+	}
+}
+
+// BatchR is like Batch, but for RResults.
+func (a *AveragePoolingLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	if len(in.Output()) != n*a.inputSize() {
+		panic("invalid input size")
+	}
+	return &averagePoolingRResult{
+		OutputVec:  a.pool(in.Output(), n),
+		ROutputVec: a.pool(in.ROutput(), n),
+		Input:      in,
+		N:          n,
+		Layer:      a,
+	}
+}
+
+// Serialize serializes the layer.
+func (a *AveragePoolingLayer) Serialize() ([]byte, error) {
+	return json.Marshal(a)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (a *AveragePoolingLayer) SerializerType() string {
+	return serializerTypeAveragePoolingLayer
+}
+
+func (a *AveragePoolingLayer) inputSize() int {
+	return a.InputWidth * a.InputHeight * a.InputDepth
+}
+
+func (a *AveragePoolingLayer) outputSize() int {
+	return a.OutputWidth() * a.OutputHeight() * a.InputDepth
+}
+
+// pool averages every pool in a batch of input tensors.
+func (a *AveragePoolingLayer) pool(in linalg.Vector, n int) linalg.Vector {
+	inSize := a.inputSize()
+	outSize := a.outputSize()
+	res := make(linalg.Vector, n*outSize)
+	for i := 0; i < n; i++ {
+		inTensor := a.inputTensor(in[i*inSize : (i+1)*inSize])
+		outTensor := a.outputTensor(res[i*outSize : (i+1)*outSize])
+		a.forEachPool(func(x, y, minX, maxX, minY, maxY int) {
+			scaler := 1 / float64((maxX-minX+1)*(maxY-minY+1))
+			for z := 0; z < a.InputDepth; z++ {
+				var sum float64
+				for poolY := minY; poolY <= maxY; poolY++ {
+					for poolX := minX; poolX <= maxX; poolX++ {
+						sum += inTensor.Get(poolX, poolY, z)
+					}
+				}
+				outTensor.Set(x, y, z, sum*scaler)
+			}
+		})
+	}
+	return res
+}
+
+// unpool computes the gradient of pool with respect to
+// its input, given the upstream gradient.
+func (a *AveragePoolingLayer) unpool(upstream linalg.Vector, n int) linalg.Vector {
+	inSize := a.inputSize()
+	outSize := a.outputSize()
+	res := make(linalg.Vector, n*inSize)
+	for i := 0; i < n; i++ {
+		upTensor := a.outputTensor(upstream[i*outSize : (i+1)*outSize])
+		downTensor := a.inputTensor(res[i*inSize : (i+1)*inSize])
+		a.forEachPool(func(x, y, minX, maxX, minY, maxY int) {
+			scaler := 1 / float64((maxX-minX+1)*(maxY-minY+1))
+			for z := 0; z < a.InputDepth; z++ {
+				val := upTensor.Get(x, y, z) * scaler
+				for poolY := minY; poolY <= maxY; poolY++ {
+					for poolX := minX; poolX <= maxX; poolX++ {
+						downTensor.Set(poolX, poolY, z, val)
+					}
+				}
+			}
+		})
+	}
+	return res
+}
+
+func (a *AveragePoolingLayer) forEachPool(f func(x, y, minX, maxX, minY, maxY int)) {
+	for y := 0; y < a.OutputHeight(); y++ {
+		poolY := y * a.YSpan
+		maxY := poolY + a.YSpan - 1
+		if maxY >= a.InputHeight {
+			maxY = a.InputHeight - 1
+		}
+		for x := 0; x < a.OutputWidth(); x++ {
+			poolX := x * a.XSpan
+			maxX := poolX + a.XSpan - 1
+			if maxX >= a.InputWidth {
+				maxX = a.InputWidth - 1
+			}
+			f(x, y, poolX, maxX, poolY, maxY)
+		}
+	}
+}
+
+func (a *AveragePoolingLayer) inputTensor(inVec linalg.Vector) *tensor.Float64 {
+	return &tensor.Float64{
+		Width:  a.InputWidth,
+		Height: a.InputHeight,
+		Depth:  a.InputDepth,
+		Data:   inVec,
+	}
+}
+
+func (a *AveragePoolingLayer) outputTensor(outVec linalg.Vector) *tensor.Float64 {
+	return &tensor.Float64{
+		Width:  a.OutputWidth(),
+		Height: a.OutputHeight(),
+		Depth:  a.InputDepth,
+		Data:   outVec,
+	}
+}
+
+type averagePoolingResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *AveragePoolingLayer
+}
+
+func (a *averagePoolingResult) Output() linalg.Vector {
+	return a.OutputVec
+}
+
+func (a *averagePoolingResult) Constant(g autofunc.Gradient) bool {
+	return a.Input.Constant(g)
+}
+
+func (a *averagePoolingResult) PropagateGradient(upstream linalg.Vector,
+	grad autofunc.Gradient) {
+	if a.Input.Constant(grad) {
+		return
+	}
+	a.Input.PropagateGradient(a.Layer.unpool(upstream, a.N), grad)
+}
+
+type averagePoolingRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	N          int
+	Layer      *AveragePoolingLayer
+}
+
+func (a *averagePoolingRResult) Output() linalg.Vector {
+	return a.OutputVec
+}
+
+func (a *averagePoolingRResult) ROutput() linalg.Vector {
+	return a.ROutputVec
+}
+
+func (a *averagePoolingRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return a.Input.Constant(rg, g)
+}
+
+func (a *averagePoolingRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if a.Input.Constant(rgrad, grad) {
+		return
+	}
+	a.Input.PropagateRGradient(a.Layer.unpool(upstream, a.N),
+		a.Layer.unpool(upstreamR, a.N), rgrad, grad)
+}
@@ -0,0 +1,105 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestAveragePoolingForward(t *testing.T) {
+	layer := &AveragePoolingLayer{2, 2, 3, 3, 2}
+
+	input := []float64{
+		1, 2, 3, 4, 5, 6,
+		7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16, 17, 18,
+	}
+	output := []float64{
+		5, 6, 8, 9,
+		14, 15, 17, 18,
+	}
+
+	result := layer.Apply(&autofunc.Variable{Vector: input}).Output()
+	if len(result) != len(output) {
+		t.Fatalf("expected %d outputs but got %d", len(output), len(result))
+	}
+	for i, x := range output {
+		if actual := result[i]; math.Abs(actual-x) > 1e-5 {
+			t.Errorf("expected output %d to be %f but got %f", i, x, actual)
+		}
+	}
+}
+
+func TestAveragePoolingRProp(t *testing.T) {
+	layer := &AveragePoolingLayer{3, 2, 10, 11, 2}
+	input := make(linalg.Vector, 10*11*2)
+	inputR := make(linalg.Vector, len(input))
+	for i := range input {
+		input[i] = rand.Float64()*2 - 1
+		inputR[i] = rand.Float64()*2 - 1
+	}
+
+	inputVar := &autofunc.Variable{Vector: input}
+	rVector := autofunc.RVector{inputVar: inputR}
+
+	funcTest := &functest.RFuncChecker{
+		F:     layer,
+		Vars:  []*autofunc.Variable{inputVar},
+		Input: inputVar,
+		RV:    rVector,
+	}
+	funcTest.FullCheck(t)
+}
+
+func TestAveragePoolingBatch(t *testing.T) {
+	layer := &AveragePoolingLayer{
+		XSpan:       5,
+		YSpan:       4,
+		InputWidth:  17,
+		InputHeight: 19,
+		InputDepth:  3,
+	}
+
+	n := 3
+	batchInput := make(linalg.Vector, n*layer.InputWidth*layer.InputHeight*layer.InputDepth)
+	for i := range batchInput {
+		batchInput[i] = rand.NormFloat64()
+	}
+	batchRes := &autofunc.Variable{Vector: batchInput}
+
+	rVec := autofunc.RVector{
+		batchRes: make(linalg.Vector, len(batchInput)),
+	}
+	for i := range rVec[batchRes] {
+		rVec[batchRes][i] = rand.NormFloat64()
+	}
+
+	testBatcher(t, layer, batchRes, n, []*autofunc.Variable{batchRes})
+	testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec),
+		n, []*autofunc.Variable{batchRes})
+}
+
+func TestAveragePoolingSerialize(t *testing.T) {
+	layer := &AveragePoolingLayer{3, 3, 10, 11, 2}
+	encoded, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerType := layer.SerializerType()
+	decoded, err := serializer.GetDeserializer(layerType)(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*AveragePoolingLayer)
+	if !ok {
+		t.Fatalf("expected *AveragePoolingLayer but got %T", decoded)
+	}
+	if *newLayer != *layer {
+		t.Errorf("expected %v but got %v", *layer, *newLayer)
+	}
+}
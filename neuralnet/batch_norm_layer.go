@@ -0,0 +1,502 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const (
+	defaultBatchNormMomentum = 0.1
+	defaultBatchNormEpsilon  = 1e-5
+)
+
+// BatchNormLayer implements batch normalization, as
+// described in https://arxiv.org/abs/1502.03167.
+//
+// Inputs are treated as rows of InputCount features,
+// and every feature is normalized separately.
+// An input may contain any number of rows, so setting
+// InputCount to a ConvLayer's OutputDepth() normalizes
+// each of its filters across every spatial position
+// of every sample in the batch.
+//
+// In training mode, the mean and variance come from
+// the batch being evaluated, and the running averages
+// are updated as a side-effect.
+// In usage mode, the running averages are used and
+// the layer acts like a fixed affine transformation.
+type BatchNormLayer struct {
+	// InputCount is the number of features which are
+	// normalized independently.
+	InputCount int
+
+	// Scales and Biases are the learned affine
+	// transformation applied after normalization.
+	Scales *autofunc.Variable
+	Biases *autofunc.Variable
+
+	// RunningMean and RunningVariance are the
+	// statistics used outside of training mode.
+	RunningMean     linalg.Vector
+	RunningVariance linalg.Vector
+
+	// Momentum is the weight given to each new batch
+	// when updating the running averages.
+	// If this is 0, a reasonable default is used.
+	Momentum float64
+
+	// Epsilon is added to every variance to avoid
+	// dividing by zero.
+	// If this is 0, a reasonable default is used.
+	Epsilon float64
+
+	// Training is true if batch statistics should be
+	// used (and the running averages updated).
+	//
+	// The running averages are only updated by Apply and
+	// Batch, not by ApplyR and BatchR, so that repeated
+	// R-operator passes over the same batch (e.g. during
+	// Hessian-free optimization) do not overweight it.
+	Training bool
+
+	statLock sync.Mutex
+}
+
+// NewBatchNormLayer creates a BatchNormLayer with the
+// given number of features.
+// The resulting layer is not in training mode.
+func NewBatchNormLayer(inCount int) *BatchNormLayer {
+	res := &BatchNormLayer{InputCount: inCount}
+	res.Randomize()
+	return res
+}
+
+// DeserializeBatchNormLayer deserializes a BatchNormLayer.
+func DeserializeBatchNormLayer(d []byte) (*BatchNormLayer, error) {
+	var res BatchNormLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Randomize sets the scales to 1, the biases to 0,
+// and the running statistics to those of a standard
+// normal distribution.
+//
+// This will allocate b.Scales, b.Biases, and the
+// running statistics if they are nil.
+func (b *BatchNormLayer) Randomize() {
+	if b.Scales == nil {
+		b.Scales = &autofunc.Variable{Vector: make(linalg.Vector, b.InputCount)}
+	}
+	if b.Biases == nil {
+		b.Biases = &autofunc.Variable{Vector: make(linalg.Vector, b.InputCount)}
+	}
+	b.RunningMean = make(linalg.Vector, b.InputCount)
+	b.RunningVariance = make(linalg.Vector, b.InputCount)
+	for i := 0; i < b.InputCount; i++ {
+		b.Scales.Vector[i] = 1
+		b.Biases.Vector[i] = 0
+		b.RunningVariance[i] = 1
+	}
+}
+
+// Parameters returns a slice containing the scale
+// variable followed by the bias variable.
+func (b *BatchNormLayer) Parameters() []*autofunc.Variable {
+	if b.Scales == nil || b.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{b.Scales, b.Biases}
+}
+
+// Apply applies the layer to a single input.
+// In training mode, the statistics are computed over
+// the rows of the input.
+func (b *BatchNormLayer) Apply(in autofunc.Result) autofunc.Result {
+	return b.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (b *BatchNormLayer) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return b.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+// In training mode, the statistics are computed over
+// every row of every input.
+func (b *BatchNormLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	if b.Scales == nil || b.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	stats := b.normalize(in.Output(), true)
+	res := &batchNormResult{
+		OutputVec: make(linalg.Vector, len(stats.Normalized)),
+		Input:     in,
+		Stats:     stats,
+		Layer:     b,
+	}
+	for i, x := range stats.Normalized {
+		j := i % b.InputCount
+		res.OutputVec[i] = x*b.Scales.Vector[j] + b.Biases.Vector[j]
+	}
+	return res
+}
+
+// BatchR is like Batch, but for RResults.
+func (b *BatchNormLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	if b.Scales == nil || b.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	stats := b.normalizeR(in.Output(), in.ROutput())
+	res := &batchNormRResult{
+		OutputVec:  make(linalg.Vector, len(stats.Normalized)),
+		ROutputVec: make(linalg.Vector, len(stats.Normalized)),
+		Input:      in,
+		Stats:      stats,
+		ScalesR:    rv[b.Scales],
+		BiasesR:    rv[b.Biases],
+		Layer:      b,
+	}
+	for i, x := range stats.Normalized {
+		j := i % b.InputCount
+		res.OutputVec[i] = x*b.Scales.Vector[j] + b.Biases.Vector[j]
+		res.ROutputVec[i] = stats.RNormalized[i] * b.Scales.Vector[j]
+		if res.ScalesR != nil {
+			res.ROutputVec[i] += x * res.ScalesR[j]
+		}
+		if res.BiasesR != nil {
+			res.ROutputVec[i] += res.BiasesR[j]
+		}
+	}
+	return res
+}
+
+// Serialize serializes the layer.
+func (b *BatchNormLayer) Serialize() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (b *BatchNormLayer) SerializerType() string {
+	return serializerTypeBatchNormLayer
+}
+
+// normalize normalizes the input, updating the running
+// statistics in training mode if update is true.
+func (b *BatchNormLayer) normalize(in linalg.Vector, update bool) *batchNormStats {
+	if len(in)%b.InputCount != 0 {
+		panic("invalid input size")
+	}
+	res := &batchNormStats{
+		Rows:       len(in) / b.InputCount,
+		Centered:   make(linalg.Vector, len(in)),
+		Normalized: make(linalg.Vector, len(in)),
+		InvStd:     make(linalg.Vector, b.InputCount),
+	}
+
+	var variance linalg.Vector
+	if b.Training {
+		res.Mean, variance = b.batchStatistics(in)
+		if update {
+			b.updateRunningStatistics(res.Mean, variance)
+		}
+	} else {
+		res.Frozen = true
+		res.Mean, variance = b.runningStatistics()
+	}
+
+	eps := b.Epsilon
+	if eps == 0 {
+		eps = defaultBatchNormEpsilon
+	}
+	for i, v := range variance {
+		res.InvStd[i] = 1 / math.Sqrt(v+eps)
+	}
+	for i, x := range in {
+		j := i % b.InputCount
+		res.Centered[i] = x - res.Mean[j]
+		res.Normalized[i] = res.Centered[i] * res.InvStd[j]
+	}
+	return res
+}
+
+func (b *BatchNormLayer) normalizeR(in, inR linalg.Vector) *batchNormStats {
+	res := b.normalize(in, false)
+	res.RNormalized = make(linalg.Vector, len(in))
+	if res.Frozen {
+		for i, x := range inR {
+			res.RNormalized[i] = x * res.InvStd[i%b.InputCount]
+		}
+		return res
+	}
+
+	meanR := make(linalg.Vector, b.InputCount)
+	for i, x := range inR {
+		meanR[i%b.InputCount] += x
+	}
+	meanR.Scale(1 / float64(res.Rows))
+
+	varianceR := make(linalg.Vector, b.InputCount)
+	for i, x := range inR {
+		j := i % b.InputCount
+		varianceR[j] += res.Centered[i] * (x - meanR[j])
+	}
+	res.InvStdR = make(linalg.Vector, b.InputCount)
+	for j, x := range varianceR {
+		s := res.InvStd[j]
+		res.InvStdR[j] = -s * s * s * x / float64(res.Rows)
+	}
+
+	for i, x := range inR {
+		j := i % b.InputCount
+		res.RNormalized[i] = (x-meanR[j])*res.InvStd[j] + res.Centered[i]*res.InvStdR[j]
+	}
+	return res
+}
+
+func (b *BatchNormLayer) batchStatistics(in linalg.Vector) (mean, variance linalg.Vector) {
+	rows := float64(len(in) / b.InputCount)
+	mean = make(linalg.Vector, b.InputCount)
+	for i, x := range in {
+		mean[i%b.InputCount] += x
+	}
+	mean.Scale(1 / rows)
+	variance = make(linalg.Vector, b.InputCount)
+	for i, x := range in {
+		diff := x - mean[i%b.InputCount]
+		variance[i%b.InputCount] += diff * diff
+	}
+	variance.Scale(1 / rows)
+	return
+}
+
+func (b *BatchNormLayer) updateRunningStatistics(mean, variance linalg.Vector) {
+	momentum := b.Momentum
+	if momentum == 0 {
+		momentum = defaultBatchNormMomentum
+	}
+	b.statLock.Lock()
+	defer b.statLock.Unlock()
+	if b.RunningMean == nil || b.RunningVariance == nil {
+		b.RunningMean = mean.Copy()
+		b.RunningVariance = variance.Copy()
+		return
+	}
+	for i, x := range mean {
+		b.RunningMean[i] += momentum * (x - b.RunningMean[i])
+		b.RunningVariance[i] += momentum * (variance[i] - b.RunningVariance[i])
+	}
+}
+
+func (b *BatchNormLayer) runningStatistics() (mean, variance linalg.Vector) {
+	b.statLock.Lock()
+	defer b.statLock.Unlock()
+	if b.RunningMean == nil || b.RunningVariance == nil {
+		panic(uninitPanicMessage)
+	}
+	return b.RunningMean.Copy(), b.RunningVariance.Copy()
+}
+
+// batchNormStats stores the intermediate values of a
+// normalization so that they can be used during
+// back-propagation.
+type batchNormStats struct {
+	// Frozen is true if the statistics did not depend
+	// on the input (i.e. in usage mode).
+	Frozen bool
+
+	Rows       int
+	Mean       linalg.Vector
+	InvStd     linalg.Vector
+	Centered   linalg.Vector
+	Normalized linalg.Vector
+
+	// These are only set for R-operator results, and
+	// InvStdR is nil if the statistics were frozen.
+	InvStdR     linalg.Vector
+	RNormalized linalg.Vector
+}
+
+// propagate computes the gradient with respect to the
+// input given the gradient with respect to Normalized.
+func (b *batchNormStats) propagate(normGrad linalg.Vector) linalg.Vector {
+	cols := len(b.InvStd)
+	res := make(linalg.Vector, len(normGrad))
+	if b.Frozen {
+		for i, x := range normGrad {
+			res[i] = x * b.InvStd[i%cols]
+		}
+		return res
+	}
+	sums, dots := b.gradientSums(normGrad, b.Normalized)
+	rows := float64(b.Rows)
+	for i, x := range normGrad {
+		j := i % cols
+		res[i] = b.InvStd[j] * (x - (sums[j]+b.Normalized[i]*dots[j])/rows)
+	}
+	return res
+}
+
+// propagateR is like propagate, but it also computes
+// the R-derivative of the input gradient.
+func (b *batchNormStats) propagateR(normGrad, normGradR linalg.Vector) (grad,
+	gradR linalg.Vector) {
+	cols := len(b.InvStd)
+	grad = make(linalg.Vector, len(normGrad))
+	gradR = make(linalg.Vector, len(normGrad))
+	if b.Frozen {
+		for i, x := range normGrad {
+			grad[i] = x * b.InvStd[i%cols]
+			gradR[i] = normGradR[i] * b.InvStd[i%cols]
+		}
+		return
+	}
+
+	sums, dots := b.gradientSums(normGrad, b.Normalized)
+	sumsR, dotsR := b.gradientSums(normGradR, b.Normalized)
+	_, extraDotsR := b.gradientSums(normGrad, b.RNormalized)
+	dotsR.Add(extraDotsR)
+
+	rows := float64(b.Rows)
+	for i, x := range normGrad {
+		j := i % cols
+		inner := x - (sums[j]+b.Normalized[i]*dots[j])/rows
+		innerR := normGradR[i] - (sumsR[j]+b.RNormalized[i]*dots[j]+
+			b.Normalized[i]*dotsR[j])/rows
+		grad[i] = b.InvStd[j] * inner
+		gradR[i] = b.InvStdR[j]*inner + b.InvStd[j]*innerR
+	}
+	return
+}
+
+// gradientSums computes the per-feature sums of vec and
+// the per-feature dot products of vec and other.
+func (b *batchNormStats) gradientSums(vec, other linalg.Vector) (sums, dots linalg.Vector) {
+	cols := len(b.InvStd)
+	sums = make(linalg.Vector, cols)
+	dots = make(linalg.Vector, cols)
+	for i, x := range vec {
+		sums[i%cols] += x
+		dots[i%cols] += x * other[i]
+	}
+	return
+}
+
+type batchNormResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	Stats     *batchNormStats
+	Layer     *BatchNormLayer
+}
+
+func (b *batchNormResult) Output() linalg.Vector {
+	return b.OutputVec
+}
+
+func (b *batchNormResult) Constant(g autofunc.Gradient) bool {
+	return b.Input.Constant(g) && b.Layer.Scales.Constant(g) &&
+		b.Layer.Biases.Constant(g)
+}
+
+func (b *batchNormResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	cols := b.Layer.InputCount
+	if scaleGrad, ok := grad[b.Layer.Scales]; ok {
+		for i, u := range upstream {
+			scaleGrad[i%cols] += u * b.Stats.Normalized[i]
+		}
+	}
+	if biasGrad, ok := grad[b.Layer.Biases]; ok {
+		for i, u := range upstream {
+			biasGrad[i%cols] += u
+		}
+	}
+	if b.Input.Constant(grad) {
+		return
+	}
+	for i := range upstream {
+		upstream[i] *= b.Layer.Scales.Vector[i%cols]
+	}
+	b.Input.PropagateGradient(b.Stats.propagate(upstream), grad)
+}
+
+type batchNormRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	Stats      *batchNormStats
+	ScalesR    linalg.Vector
+	BiasesR    linalg.Vector
+	Layer      *BatchNormLayer
+}
+
+func (b *batchNormRResult) Output() linalg.Vector {
+	return b.OutputVec
+}
+
+func (b *batchNormRResult) ROutput() linalg.Vector {
+	return b.ROutputVec
+}
+
+func (b *batchNormRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	for _, v := range b.Layer.Parameters() {
+		if !v.Constant(g) {
+			return false
+		} else if _, ok := rg[v]; ok {
+			return false
+		}
+	}
+	return b.Input.Constant(rg, g)
+}
+
+func (b *batchNormRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	cols := b.Layer.InputCount
+	if scaleGrad, ok := grad[b.Layer.Scales]; ok {
+		for i, u := range upstream {
+			scaleGrad[i%cols] += u * b.Stats.Normalized[i]
+		}
+	}
+	if scaleRGrad, ok := rgrad[b.Layer.Scales]; ok {
+		for i, u := range upstream {
+			scaleRGrad[i%cols] += upstreamR[i]*b.Stats.Normalized[i] +
+				u*b.Stats.RNormalized[i]
+		}
+	}
+	if biasGrad, ok := grad[b.Layer.Biases]; ok {
+		for i, u := range upstream {
+			biasGrad[i%cols] += u
+		}
+	}
+	if biasRGrad, ok := rgrad[b.Layer.Biases]; ok {
+		for i, u := range upstreamR {
+			biasRGrad[i%cols] += u
+		}
+	}
+	if b.Input.Constant(rgrad, grad) {
+		return
+	}
+
+	normGrad := make(linalg.Vector, len(upstream))
+	normGradR := make(linalg.Vector, len(upstream))
+	for i, u := range upstream {
+		scale := b.Layer.Scales.Vector[i%cols]
+		normGrad[i] = u * scale
+		normGradR[i] = upstreamR[i] * scale
+		if b.ScalesR != nil {
+			normGradR[i] += u * b.ScalesR[i%cols]
+		}
+	}
+	down, downR := b.Stats.propagateR(normGrad, normGradR)
+	b.Input.PropagateRGradient(down, downR, rgrad, grad)
+}
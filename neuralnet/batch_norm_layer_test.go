@@ -0,0 +1,142 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestBatchNormOutput(t *testing.T) {
+	layer := NewBatchNormLayer(3)
+	layer.Training = true
+	input := &autofunc.Variable{Vector: make(linalg.Vector, 3*10)}
+	for i := range input.Vector {
+		input.Vector[i] = rand.NormFloat64()*float64(i%3+1) + float64(i%3)
+	}
+	output := layer.Batch(input, 5).Output()
+	for feature := 0; feature < 3; feature++ {
+		var mean, variance float64
+		for i := feature; i < len(output); i += 3 {
+			mean += output[i]
+			variance += output[i] * output[i]
+		}
+		mean /= 10
+		variance = variance/10 - mean*mean
+		if math.Abs(mean) > 1e-5 || math.Abs(variance-1) > 1e-3 {
+			t.Errorf("feature %d: bad mean %f or variance %f", feature, mean, variance)
+		}
+	}
+	for i, x := range layer.RunningMean {
+		if x == 0 || layer.RunningVariance[i] == 1 {
+			t.Errorf("running statistics for feature %d were not updated", i)
+		}
+	}
+}
+
+func TestBatchNormRProp(t *testing.T) {
+	for _, training := range []bool{true, false} {
+		layer := NewBatchNormLayer(3)
+		layer.Training = training
+		for i := range layer.Scales.Vector {
+			layer.Scales.Vector[i] = rand.NormFloat64()
+			layer.Biases.Vector[i] = rand.NormFloat64()
+			layer.RunningMean[i] = rand.NormFloat64()
+			layer.RunningVariance[i] = rand.Float64() + 0.5
+		}
+
+		inVar := &autofunc.Variable{Vector: make(linalg.Vector, 3*4)}
+		for i := range inVar.Vector {
+			inVar.Vector[i] = rand.NormFloat64()
+		}
+
+		variables := append(layer.Parameters(), inVar)
+		rVector := autofunc.RVector{}
+		for _, variable := range variables {
+			rVector[variable] = make(linalg.Vector, len(variable.Vector))
+			for i := range rVector[variable] {
+				rVector[variable][i] = rand.Float64()*2 - 1
+			}
+		}
+		funcTest := &functest.RFuncChecker{
+			F:     layer,
+			Vars:  variables,
+			Input: inVar,
+			RV:    rVector,
+		}
+		funcTest.FullCheck(t)
+	}
+}
+
+func TestBatchNormRStatistics(t *testing.T) {
+	layer := NewBatchNormLayer(2)
+	layer.Training = true
+	inVar := &autofunc.Variable{Vector: []float64{1, 2, 3, 5}}
+	rVector := autofunc.RVector{inVar: []float64{1, -1, 0.5, 2}}
+	layer.BatchR(rVector, autofunc.NewRVariable(inVar, rVector), 1)
+	layer.ApplyR(rVector, autofunc.NewRVariable(inVar, rVector))
+	for i, x := range layer.RunningMean {
+		if x != 0 || layer.RunningVariance[i] != 1 {
+			t.Errorf("running statistics for feature %d were updated", i)
+		}
+	}
+}
+
+func TestBatchNormBatch(t *testing.T) {
+	layer := NewBatchNormLayer(4)
+	for i := range layer.Scales.Vector {
+		layer.Scales.Vector[i] = rand.NormFloat64()
+		layer.Biases.Vector[i] = rand.NormFloat64()
+	}
+
+	n := 3
+	batchRes := &autofunc.Variable{Vector: make(linalg.Vector, n*4*5)}
+	for i := range batchRes.Vector {
+		batchRes.Vector[i] = rand.NormFloat64()
+	}
+	params := []*autofunc.Variable{batchRes, layer.Scales, layer.Biases}
+
+	rVec := autofunc.RVector{}
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+		rVec[param] = vec
+	}
+
+	testBatcher(t, layer, batchRes, n, params)
+	testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec), n, params)
+}
+
+func TestBatchNormSerialize(t *testing.T) {
+	layer := NewBatchNormLayer(2)
+	layer.Training = true
+	layer.Apply(&autofunc.Variable{Vector: []float64{1, 2, 3, 5}})
+
+	encoded, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*BatchNormLayer)
+	if !ok {
+		t.Fatalf("expected *BatchNormLayer but got %T", decoded)
+	}
+	if !newLayer.Training {
+		t.Error("training flag was not preserved")
+	}
+	for i, x := range layer.RunningMean {
+		if newLayer.RunningMean[i] != x ||
+			newLayer.RunningVariance[i] != layer.RunningVariance[i] {
+			t.Errorf("statistics for feature %d were not preserved", i)
+		}
+	}
+}
@@ -32,6 +32,10 @@ type BatchRGradienter struct {
 	// If this is 0, a reasonable default is used.
 	MaxBatchSize int
 
+	// Processor is used to clip gradients and add noise
+	// to them.
+	Processor GradProcessor
+
 	helper *GradHelper
 }
 
@@ -48,12 +52,14 @@ func (b *BatchRGradienter) makeHelper() *GradHelper {
 	if b.helper != nil {
 		b.helper.MaxConcurrency = b.MaxGoroutines
 		b.helper.MaxSubBatch = b.MaxBatchSize
+		b.helper.Processor = b.Processor
 		return b.helper
 	}
 	b.helper = &GradHelper{
 		MaxConcurrency: b.MaxGoroutines,
 		MaxSubBatch:    b.MaxBatchSize,
 		Learner:        b.Learner,
+		Processor:      b.Processor,
 
 		CompGrad: func(g autofunc.Gradient, s sgd.SampleSet) {
 			b.runBatch(nil, nil, g, s)
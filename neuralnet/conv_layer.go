@@ -56,6 +56,17 @@ type ConvLayer struct {
 	// The array behind the slice in FilterVar should
 	// be re-used in Filters.
 	FilterVar *autofunc.Variable `json:"-"`
+
+	// PaddingX and PaddingY specify how many zeros are
+	// implicitly added to the left and right (PaddingX)
+	// and the top and bottom (PaddingY) of the input.
+	PaddingX int
+	PaddingY int
+
+	// Dilation is the spacing between adjacent filter
+	// entries when they are applied to the input.
+	// A value of 0 is treated like 1 (no dilation).
+	Dilation int
 }
 
 // DeserializeConvLayer deserializes a ConvLayer.
@@ -80,7 +91,7 @@ func DeserializeConvLayer(data []byte) (*ConvLayer, error) {
 
 // OutputWidth computes the width of the output tensor.
 func (c *ConvLayer) OutputWidth() int {
-	w := 1 + (c.InputWidth-c.FilterWidth)/c.Stride
+	w := 1 + (c.paddedWidth()-c.dilatedFilterWidth())/c.Stride
 	if w < 0 {
 		return 0
 	}
@@ -89,7 +100,7 @@ func (c *ConvLayer) OutputWidth() int {
 
 // OutputHeight computes the height of the output tensor.
 func (c *ConvLayer) OutputHeight() int {
-	h := 1 + (c.InputHeight-c.FilterHeight)/c.Stride
+	h := 1 + (c.paddedHeight()-c.dilatedFilterHeight())/c.Stride
 	if h < 0 {
 		return 0
 	}
@@ -182,7 +193,7 @@ func (c *ConvLayer) Batch(in autofunc.Result, n int) autofunc.Result {
 		for i := 0; i < n; i++ {
 			subIn := in.Output()[i*inSize : (i+1)*inSize]
 			subOut := res.OutputVec[i*outSize : (i+1)*outSize]
-			inMat := c.inputToMatrix32(cast32(subIn), i2c, tempIn)
+			inMat := c.inputToMatrix32(subIn, i2c, tempIn)
 			c.convolve32(inMat, c.outputToTensor32(tempOut))
 			cast64InPlace(subOut, tempOut)
 		}
@@ -249,25 +260,152 @@ func (c *ConvLayer) SerializerType() string {
 	return serializerTypeConvLayer
 }
 
+// im2ColDims returns the dimensions for converting a
+// padded input tensor into a matrix which can be
+// multiplied by the dilated filters.
 func (c *ConvLayer) im2ColDims() *tensor.Im2ColDims {
 	return &tensor.Im2ColDims{
-		ImageWidth:  c.InputWidth,
-		ImageHeight: c.InputHeight,
+		ImageWidth:  c.paddedWidth(),
+		ImageHeight: c.paddedHeight(),
 		ImageDepth:  c.InputDepth,
 
-		FilterWidth:  c.FilterWidth,
-		FilterHeight: c.FilterHeight,
+		FilterWidth:  c.dilatedFilterWidth(),
+		FilterHeight: c.dilatedFilterHeight(),
 		FilterStride: c.Stride,
 	}
 }
 
-func (c *ConvLayer) convolve(inMat blas64.General, out *tensor.Float64) {
-	filterMat := blas64.General{
+func (c *ConvLayer) dilation() int {
+	if c.Dilation == 0 {
+		return 1
+	}
+	return c.Dilation
+}
+
+func (c *ConvLayer) dilatedFilterWidth() int {
+	return (c.FilterWidth-1)*c.dilation() + 1
+}
+
+func (c *ConvLayer) dilatedFilterHeight() int {
+	return (c.FilterHeight-1)*c.dilation() + 1
+}
+
+func (c *ConvLayer) paddedWidth() int {
+	return c.InputWidth + 2*c.PaddingX
+}
+
+func (c *ConvLayer) paddedHeight() int {
+	return c.InputHeight + 2*c.PaddingY
+}
+
+// matrixCols returns the number of columns in the
+// matrices produced by im2col, which is also the
+// number of entries in each dilated filter.
+func (c *ConvLayer) matrixCols() int {
+	return c.dilatedFilterWidth() * c.dilatedFilterHeight() * c.InputDepth
+}
+
+// filterMatrix creates a matrix with one dilated filter
+// per row, given the concatenated (undilated) filters.
+func (c *ConvLayer) filterMatrix(filters linalg.Vector) blas64.General {
+	data := filters
+	if c.dilation() != 1 {
+		data = make(linalg.Vector, c.FilterCount*c.matrixCols())
+		c.forEachDilatedEntry(func(src, dst int) {
+			data[dst] = filters[src]
+		})
+	}
+	return blas64.General{
 		Rows:   c.FilterCount,
-		Cols:   inMat.Cols,
-		Stride: inMat.Stride,
-		Data:   c.FilterVar.Vector,
+		Cols:   c.matrixCols(),
+		Stride: c.matrixCols(),
+		Data:   data,
+	}
+}
+
+// filterGradMatrix creates a matrix into which the
+// gradient of the dilated filters can be accumulated.
+// After the matrix has been written to, addFilterGrad
+// should be called to update the actual gradient.
+func (c *ConvLayer) filterGradMatrix(grad linalg.Vector) blas64.General {
+	data := grad
+	if c.dilation() != 1 {
+		data = make(linalg.Vector, c.FilterCount*c.matrixCols())
+	}
+	return blas64.General{
+		Rows:   c.FilterCount,
+		Cols:   c.matrixCols(),
+		Stride: c.matrixCols(),
+		Data:   data,
+	}
+}
+
+// addFilterGrad adds the gradient from a matrix created
+// with filterGradMatrix to the undilated gradient.
+func (c *ConvLayer) addFilterGrad(grad linalg.Vector, gradMat blas64.General) {
+	if c.dilation() == 1 {
+		return
+	}
+	c.forEachDilatedEntry(func(src, dst int) {
+		grad[src] += gradMat.Data[dst]
+	})
+}
+
+// forEachDilatedEntry calls f with the index of every
+// filter entry and the index of the same entry in the
+// dilated filters.
+func (c *ConvLayer) forEachDilatedEntry(f func(src, dst int)) {
+	d := c.dilation()
+	filterSize := c.FilterWidth * c.FilterHeight * c.InputDepth
+	dilatedWidth := c.dilatedFilterWidth()
+	for i := 0; i < c.FilterCount; i++ {
+		for y := 0; y < c.FilterHeight; y++ {
+			for x := 0; x < c.FilterWidth; x++ {
+				src := i*filterSize + (y*c.FilterWidth+x)*c.InputDepth
+				dst := i*c.matrixCols() + (y*d*dilatedWidth+x*d)*c.InputDepth
+				for z := 0; z < c.InputDepth; z++ {
+					f(src+z, dst+z)
+				}
+			}
+		}
 	}
+}
+
+// padInput surrounds an input tensor with zeros.
+// If there is no padding, in itself is returned.
+func (c *ConvLayer) padInput(in linalg.Vector) linalg.Vector {
+	if c.PaddingX == 0 && c.PaddingY == 0 {
+		return in
+	}
+	res := make(linalg.Vector, c.paddedWidth()*c.paddedHeight()*c.InputDepth)
+	c.forEachPaddedRow(func(src, dst, size int) {
+		copy(res[dst:dst+size], in[src:src+size])
+	})
+	return res
+}
+
+// unpadInput copies the non-padding part of a padded
+// input tensor into dest.
+func (c *ConvLayer) unpadInput(dest, padded linalg.Vector) {
+	if c.PaddingX == 0 && c.PaddingY == 0 {
+		copy(dest, padded)
+		return
+	}
+	c.forEachPaddedRow(func(src, dst, size int) {
+		copy(dest[src:src+size], padded[dst:dst+size])
+	})
+}
+
+func (c *ConvLayer) forEachPaddedRow(f func(src, dst, size int)) {
+	rowSize := c.InputWidth * c.InputDepth
+	for y := 0; y < c.InputHeight; y++ {
+		dst := ((y+c.PaddingY)*c.paddedWidth() + c.PaddingX) * c.InputDepth
+		f(y*rowSize, dst, rowSize)
+	}
+}
+
+func (c *ConvLayer) convolve(inMat blas64.General, out *tensor.Float64) {
+	filterMat := c.filterMatrix(c.FilterVar.Vector)
 	outMat := blas64.General{
 		Rows:   out.Width * out.Height,
 		Cols:   out.Depth,
@@ -289,7 +427,7 @@ func (c *ConvLayer) convolve32(inMat blas32.General, out *tensor.Float32) {
 		Rows:   c.FilterCount,
 		Cols:   inMat.Cols,
 		Stride: inMat.Stride,
-		Data:   cast32(c.FilterVar.Vector),
+		Data:   cast32(c.filterMatrix(c.FilterVar.Vector).Data),
 	}
 	outMat := blas32.General{
 		Rows:   out.Width * out.Height,
@@ -309,12 +447,7 @@ func (c *ConvLayer) convolve32(inMat blas32.General, out *tensor.Float32) {
 
 func (c *ConvLayer) convolveR(v autofunc.RVector, inMat, inMatR blas64.General,
 	out *tensor.Float64) {
-	filterMat := blas64.General{
-		Rows:   c.FilterCount,
-		Cols:   inMat.Cols,
-		Stride: inMat.Stride,
-		Data:   c.FilterVar.Vector,
-	}
+	filterMat := c.filterMatrix(c.FilterVar.Vector)
 	outMat := blas64.General{
 		Rows:   out.Width * out.Height,
 		Cols:   out.Depth,
@@ -323,12 +456,7 @@ func (c *ConvLayer) convolveR(v autofunc.RVector, inMat, inMatR blas64.General,
 	}
 	blas64.Gemm(blas.NoTrans, blas.Trans, 1, inMatR, filterMat, 0, outMat)
 	if filterRV, ok := v[c.FilterVar]; ok {
-		filterMatR := blas64.General{
-			Rows:   c.FilterCount,
-			Cols:   inMat.Cols,
-			Stride: inMat.Stride,
-			Data:   filterRV,
-		}
+		filterMatR := c.filterMatrix(filterRV)
 		blas64.Gemm(blas.NoTrans, blas.Trans, 1, inMat, filterMatR, 1, outMat)
 	}
 
@@ -344,8 +472,8 @@ func (c *ConvLayer) convolveR(v autofunc.RVector, inMat, inMatR blas64.General,
 
 func (c *ConvLayer) inputToTensor(in linalg.Vector) *tensor.Float64 {
 	return &tensor.Float64{
-		Width:  c.InputWidth,
-		Height: c.InputHeight,
+		Width:  c.paddedWidth(),
+		Height: c.paddedHeight(),
 		Depth:  c.InputDepth,
 		Data:   in,
 	}
@@ -353,11 +481,11 @@ func (c *ConvLayer) inputToTensor(in linalg.Vector) *tensor.Float64 {
 
 func (c *ConvLayer) inputToMatrix(in linalg.Vector, i2c tensor.Im2Col64,
 	data []float64) blas64.General {
-	i2c.ToMatrix(data, c.inputToTensor(in))
+	i2c.ToMatrix(data, c.inputToTensor(c.padInput(in)))
 	return blas64.General{
 		Rows:   c.OutputWidth() * c.OutputHeight(),
-		Cols:   c.FilterWidth * c.FilterHeight * c.InputDepth,
-		Stride: c.FilterWidth * c.FilterHeight * c.InputDepth,
+		Cols:   c.matrixCols(),
+		Stride: c.matrixCols(),
 		Data:   data,
 	}
 }
@@ -373,20 +501,20 @@ func (c *ConvLayer) outputToTensor(out linalg.Vector) *tensor.Float64 {
 
 func (c *ConvLayer) inputToTensor32(in []float32) *tensor.Float32 {
 	return &tensor.Float32{
-		Width:  c.InputWidth,
-		Height: c.InputHeight,
+		Width:  c.paddedWidth(),
+		Height: c.paddedHeight(),
 		Depth:  c.InputDepth,
 		Data:   in,
 	}
 }
 
-func (c *ConvLayer) inputToMatrix32(in []float32, i2c tensor.Im2Col32,
+func (c *ConvLayer) inputToMatrix32(in linalg.Vector, i2c tensor.Im2Col32,
 	data []float32) blas32.General {
-	i2c.ToMatrix(data, c.inputToTensor32(in))
+	i2c.ToMatrix(data, c.inputToTensor32(cast32(c.padInput(in))))
 	return blas32.General{
 		Rows:   c.OutputWidth() * c.OutputHeight(),
-		Cols:   c.FilterWidth * c.FilterHeight * c.InputDepth,
-		Stride: c.FilterWidth * c.FilterHeight * c.InputDepth,
+		Cols:   c.matrixCols(),
+		Stride: c.matrixCols(),
 		Data:   data,
 	}
 }
@@ -490,26 +618,17 @@ func (c *convLayerResult) propagateSingle(input, upstream, downstream linalg.Vec
 	inMatrix := c.Layer.inputToMatrix(input, i2c, matScratch)
 
 	if filterGrad, ok := grad[c.Layer.FilterVar]; ok {
-		destMat := blas64.General{
-			Rows:   len(c.Layer.Filters),
-			Cols:   c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Stride: c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Data:   filterGrad,
-		}
+		destMat := c.Layer.filterGradMatrix(filterGrad)
 		blas64.Gemm(blas.Trans, blas.NoTrans, 1, upstreamMat, inMatrix, 1, destMat)
+		c.Layer.addFilterGrad(filterGrad, destMat)
 	}
 
 	if downstream != nil {
 		inDeriv := inMatrix
-		filterMat := blas64.General{
-			Rows:   len(c.Layer.Filters),
-			Cols:   c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Stride: c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Data:   c.Layer.FilterVar.Vector,
-		}
+		filterMat := c.Layer.filterMatrix(c.Layer.FilterVar.Vector)
 		blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMat, filterMat, 0, inDeriv)
 		flattened := i2c.ToImage(inDeriv.Data)
-		copy(downstream, flattened.Data)
+		c.Layer.unpadInput(downstream, flattened.Data)
 	}
 }
 
@@ -522,30 +641,32 @@ func (c *convLayerResult) propagateSingle32(input, upstream, downstream linalg.V
 		Data:   cast32(upstream),
 	}
 
-	inMatrix := c.Layer.inputToMatrix32(cast32(input), i2c, matScratch)
+	inMatrix := c.Layer.inputToMatrix32(input, i2c, matScratch)
 
 	if filterGrad, ok := grad[c.Layer.FilterVar]; ok {
+		gradMat := c.Layer.filterGradMatrix(filterGrad)
 		destMat := blas32.General{
-			Rows:   len(c.Layer.Filters),
-			Cols:   c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Stride: c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Data:   cast32(filterGrad),
+			Rows:   gradMat.Rows,
+			Cols:   gradMat.Cols,
+			Stride: gradMat.Stride,
+			Data:   cast32(gradMat.Data),
 		}
 		blas32.Gemm(blas.Trans, blas.NoTrans, 1, upstreamMat, inMatrix, 1, destMat)
-		cast64InPlace(filterGrad, destMat.Data)
+		cast64InPlace(gradMat.Data, destMat.Data)
+		c.Layer.addFilterGrad(filterGrad, gradMat)
 	}
 
 	if downstream != nil {
 		inDeriv := inMatrix
 		filterMat := blas32.General{
 			Rows:   len(c.Layer.Filters),
-			Cols:   c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Stride: c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Data:   cast32(c.Layer.FilterVar.Vector),
+			Cols:   c.Layer.matrixCols(),
+			Stride: c.Layer.matrixCols(),
+			Data:   cast32(c.Layer.filterMatrix(c.Layer.FilterVar.Vector).Data),
 		}
 		blas32.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMat, filterMat, 0, inDeriv)
 		flattened := i2c.ToImage(inDeriv.Data)
-		cast64InPlace(downstream, flattened.Data)
+		c.Layer.unpadInput(downstream, cast64(flattened.Data))
 	}
 }
 
@@ -669,23 +790,18 @@ func (c *convLayerRResult) propagateSingle(input, inputR, upstream, upstreamR, d
 		// TODO: don't bother doing a full im2col here,
 		// since we overwrite it anyway.
 		inDeriv := c.Layer.inputToMatrix(input, i2c, matScratch)
-		filterMat := blas64.General{
-			Rows:   len(c.Layer.Filters),
-			Cols:   c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Stride: c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Data:   c.Layer.FilterVar.Vector,
-		}
+		filterMat := c.Layer.filterMatrix(c.Layer.FilterVar.Vector)
 		blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMat, filterMat, 0, inDeriv)
 		flattened := i2c.ToImage(inDeriv.Data)
-		copy(downstream, flattened.Data)
+		c.Layer.unpadInput(downstream, flattened.Data)
 
 		blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMatR, filterMat, 0, inDeriv)
 		if c.FiltersR != nil {
-			filterMat.Data = c.FiltersR
+			filterMat = c.Layer.filterMatrix(c.FiltersR)
 			blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, upstreamMat, filterMat, 1, inDeriv)
 		}
 		flattened = i2c.ToImage(inDeriv.Data)
-		copy(downstreamR, flattened.Data)
+		c.Layer.unpadInput(downstreamR, flattened.Data)
 	}
 
 	filterGrad, hasFilterGrad := grad[c.Layer.FilterVar]
@@ -697,25 +813,17 @@ func (c *convLayerRResult) propagateSingle(input, inputR, upstream, upstreamR, d
 	}
 
 	if hasFilterGrad {
-		destMat := blas64.General{
-			Rows:   len(c.Layer.Filters),
-			Cols:   c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Stride: c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Data:   filterGrad,
-		}
+		destMat := c.Layer.filterGradMatrix(filterGrad)
 		blas64.Gemm(blas.Trans, blas.NoTrans, 1, upstreamMat, inMatrix, 1, destMat)
+		c.Layer.addFilterGrad(filterGrad, destMat)
 	}
 
 	if hasFilterRGrad {
 		inMatrixR := c.Layer.inputToMatrix(inputR, i2c, matScratchR)
-		destMat := blas64.General{
-			Rows:   len(c.Layer.Filters),
-			Cols:   c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Stride: c.Layer.FilterWidth * c.Layer.FilterHeight * c.Layer.InputDepth,
-			Data:   filterRGrad,
-		}
+		destMat := c.Layer.filterGradMatrix(filterRGrad)
 		blas64.Gemm(blas.Trans, blas.NoTrans, 1, upstreamMatR, inMatrix, 1, destMat)
 		blas64.Gemm(blas.Trans, blas.NoTrans, 1, upstreamMat, inMatrixR, 1, destMat)
+		c.Layer.addFilterGrad(filterRGrad, destMat)
 	}
 }
 
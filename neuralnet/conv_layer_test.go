@@ -15,8 +15,8 @@ import (
 
 func TestConvDimensions(t *testing.T) {
 	layers := []*ConvLayer{
-		{1, 3, 3, 1, 9, 9, 1, nil, nil, nil},
-		{5, 4, 7, 2, 17, 56, 18, nil, nil, nil},
+		{1, 3, 3, 1, 9, 9, 1, nil, nil, nil, 0, 0, 0},
+		{5, 4, 7, 2, 17, 56, 18, nil, nil, nil, 0, 0, 0},
 	}
 
 	outputDims := [][]int{
@@ -34,6 +34,35 @@ func TestConvDimensions(t *testing.T) {
 	}
 }
 
+func TestConvDimensionsPaddingDilation(t *testing.T) {
+	layers := []*ConvLayer{
+		{FilterCount: 1, FilterWidth: 3, FilterHeight: 3, Stride: 1, InputWidth: 9,
+			InputHeight: 9, InputDepth: 1, PaddingX: 1, PaddingY: 1},
+		{FilterCount: 5, FilterWidth: 4, FilterHeight: 7, Stride: 2, InputWidth: 17,
+			InputHeight: 56, InputDepth: 18, PaddingX: 3, PaddingY: 1, Dilation: 1},
+		{FilterCount: 1, FilterWidth: 3, FilterHeight: 3, Stride: 1, InputWidth: 9,
+			InputHeight: 9, InputDepth: 1, Dilation: 2},
+		{FilterCount: 5, FilterWidth: 4, FilterHeight: 7, Stride: 2, InputWidth: 17,
+			InputHeight: 56, InputDepth: 18, PaddingX: 2, PaddingY: 3, Dilation: 3},
+	}
+
+	outputDims := [][]int{
+		{9, 9},
+		{10, 26},
+		{5, 5},
+		{6, 22},
+	}
+
+	for i, layer := range layers {
+		expOutDims := outputDims[i]
+		if layer.OutputWidth() != expOutDims[0] || layer.OutputHeight() != expOutDims[1] {
+			t.Errorf("test %d gave %d,%d output (expected %d,%d)", i,
+				layer.OutputWidth(), layer.OutputHeight(),
+				expOutDims[0], expOutDims[1])
+		}
+	}
+}
+
 func TestConvForward(t *testing.T) {
 	convTestBothSizes(t, func(t *testing.T) {
 		network, input, _ := convLayerTestInfo()
@@ -191,6 +220,140 @@ func TestConvLayerRProp(t *testing.T) {
 	})
 }
 
+func TestConvLayerPadding(t *testing.T) {
+	convTestBothSizes(t, func(t *testing.T) {
+		layer := &ConvLayer{
+			FilterCount:  3,
+			FilterWidth:  3,
+			FilterHeight: 2,
+			Stride:       1,
+			PaddingX:     1,
+			PaddingY:     2,
+			InputWidth:   5,
+			InputHeight:  4,
+			InputDepth:   2,
+		}
+		layer.Randomize()
+		unpadded := *layer
+		unpadded.PaddingX = 0
+		unpadded.PaddingY = 0
+		unpadded.InputWidth += 2
+		unpadded.InputHeight += 4
+		border := &BorderLayer{
+			InputWidth:   5,
+			InputHeight:  4,
+			InputDepth:   2,
+			LeftBorder:   1,
+			RightBorder:  1,
+			TopBorder:    2,
+			BottomBorder: 2,
+		}
+		testConvEquivalent(t, layer, Network{border, &unpadded})
+	})
+}
+
+func TestConvLayerDilation(t *testing.T) {
+	convTestBothSizes(t, func(t *testing.T) {
+		layer := &ConvLayer{
+			FilterCount:  3,
+			FilterWidth:  2,
+			FilterHeight: 3,
+			Stride:       2,
+			Dilation:     3,
+			InputWidth:   11,
+			InputHeight:  12,
+			InputDepth:   2,
+		}
+		layer.Randomize()
+		undilated := &ConvLayer{
+			FilterCount:  3,
+			FilterWidth:  4,
+			FilterHeight: 7,
+			Stride:       2,
+			InputWidth:   11,
+			InputHeight:  12,
+			InputDepth:   2,
+		}
+		undilated.Randomize()
+		copy(undilated.Biases.Vector, layer.Biases.Vector)
+		for i, filter := range undilated.Filters {
+			for y := 0; y < filter.Height; y++ {
+				for x := 0; x < filter.Width; x++ {
+					for z := 0; z < filter.Depth; z++ {
+						var val float64
+						if x%3 == 0 && y%3 == 0 {
+							val = layer.Filters[i].Get(x/3, y/3, z)
+						}
+						filter.Set(x, y, z, val)
+					}
+				}
+			}
+		}
+		testConvEquivalent(t, layer, undilated)
+	})
+}
+
+func TestConvLayerPaddingDilationRProp(t *testing.T) {
+	layer := &ConvLayer{
+		FilterCount:  2,
+		FilterWidth:  2,
+		FilterHeight: 3,
+		Stride:       2,
+		PaddingX:     2,
+		PaddingY:     1,
+		Dilation:     2,
+		InputWidth:   5,
+		InputHeight:  6,
+		InputDepth:   2,
+	}
+	layer.Randomize()
+
+	input := make(linalg.Vector, 5*6*2)
+	for i := range input {
+		input[i] = rand.Float64()*2 - 1
+	}
+	inVar := &autofunc.Variable{Vector: input}
+
+	variables := append(layer.Parameters(), inVar)
+	rVector := autofunc.RVector{}
+	for _, variable := range variables {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.Float64()*2 - 1
+		}
+	}
+	funcTest := &functest.RFuncChecker{
+		F:     layer,
+		Vars:  variables,
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.FullCheck(t)
+}
+
+func TestConvLayerDeserializeOld(t *testing.T) {
+	data := []byte(`{"FilterCount":1,"FilterWidth":2,"FilterHeight":1,"Stride":1,` +
+		`"InputWidth":3,"InputHeight":1,"InputDepth":1,"Filters":[{"Width":2,` +
+		`"Height":1,"Depth":1,"Data":[1,2]}],"Biases":{"Vector":[0.5]}}`)
+	layer, err := DeserializeConvLayer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layer.PaddingX != 0 || layer.PaddingY != 0 || layer.Dilation != 0 {
+		t.Errorf("unexpected padding or dilation: %v", layer)
+	}
+	output := layer.Apply(&autofunc.Variable{Vector: []float64{1, 2, 3}}).Output()
+	expected := []float64{5.5, 8.5}
+	if len(output) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(output))
+	}
+	for i, x := range expected {
+		if math.Abs(output[i]-x) > 1e-5 {
+			t.Errorf("output %d should be %f but got %f", i, x, output[i])
+		}
+	}
+}
+
 func TestConvLayerBatch(t *testing.T) {
 	convTestBothSizes(t, func(t *testing.T) {
 		layer := &ConvLayer{
@@ -251,6 +414,42 @@ func TestConvLayerBatchR(t *testing.T) {
 	})
 }
 
+// testConvEquivalent checks that a ConvLayer gives the
+// same outputs and input gradients as another function.
+func testConvEquivalent(t *testing.T, layer *ConvLayer, f autofunc.Func) {
+	input := make(linalg.Vector, layer.InputWidth*layer.InputHeight*layer.InputDepth)
+	for i := range input {
+		input[i] = rand.NormFloat64()
+	}
+	inVar := &autofunc.Variable{Vector: input}
+
+	expRes := f.Apply(inVar)
+	actualRes := layer.Apply(inVar)
+	if len(expRes.Output()) != len(actualRes.Output()) {
+		t.Fatalf("expected %d outputs but got %d", len(expRes.Output()),
+			len(actualRes.Output()))
+	}
+	for i, x := range expRes.Output() {
+		if a := actualRes.Output()[i]; math.Abs(a-x) > 1e-4 {
+			t.Fatalf("output %d should be %f but got %f", i, x, a)
+		}
+	}
+
+	upstream := make(linalg.Vector, len(expRes.Output()))
+	for i := range upstream {
+		upstream[i] = rand.NormFloat64()
+	}
+	expGrad := autofunc.NewGradient([]*autofunc.Variable{inVar})
+	actualGrad := autofunc.NewGradient([]*autofunc.Variable{inVar})
+	expRes.PropagateGradient(upstream, expGrad)
+	actualRes.PropagateGradient(upstream, actualGrad)
+	for i, x := range expGrad[inVar] {
+		if a := actualGrad[inVar][i]; math.Abs(a-x) > 1e-4 {
+			t.Fatalf("input gradient %d should be %f but got %f", i, x, a)
+		}
+	}
+}
+
 func convTestBothSizes(t *testing.T, f func(t *testing.T)) {
 	t.Run("float32", func(t *testing.T) {
 		SetConvLayer32Bit(true)
@@ -0,0 +1,603 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas32"
+	"github.com/gonum/blas/blas64"
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/tensor"
+)
+
+// DeconvLayer is a transposed convolutional layer (also
+// known as a fractionally-strided convolution) for a
+// neural network.
+// It increases the width and height of its input, making
+// it useful for decoders and generators.
+//
+// A DeconvLayer computes the transpose of the linear map
+// computed by a ConvLayer with the same filter size and
+// stride, an input depth of OutputDepth, and InputDepth
+// filters.
+//
+// Like ConvLayer, a DeconvLayer uses blas32 instead of
+// blas64 when ConvLayer32Bit is true.
+type DeconvLayer struct {
+	FilterWidth  int
+	FilterHeight int
+	Stride       int
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	OutputDepth int
+
+	// Filters contains one filter per input channel.
+	// Each filter has dimensions FilterWidth by
+	// FilterHeight by OutputDepth, and indicates how
+	// its input channel is spread out over the output.
+	Filters []*tensor.Float64
+
+	// Biases contains one bias per output channel.
+	Biases *autofunc.Variable
+
+	// FilterVar must contain the data for all of the
+	// filters in Filters, arranged one after the other.
+	// The array behind the slice in FilterVar should
+	// be re-used in Filters.
+	FilterVar *autofunc.Variable `json:"-"`
+}
+
+// DeserializeDeconvLayer deserializes a DeconvLayer.
+func DeserializeDeconvLayer(data []byte) (*DeconvLayer, error) {
+	var d DeconvLayer
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+
+	filterSize := d.filterSize()
+	weightSlice := make(linalg.Vector, d.InputDepth*filterSize)
+	for i, x := range d.Filters {
+		subSlice := weightSlice[i*filterSize : (i+1)*filterSize]
+		copy(subSlice, x.Data)
+		x.Data = subSlice
+	}
+	d.FilterVar = &autofunc.Variable{Vector: weightSlice}
+
+	return &d, nil
+}
+
+// OutputWidth computes the width of the output tensor.
+func (d *DeconvLayer) OutputWidth() int {
+	if d.InputWidth == 0 {
+		return 0
+	}
+	return (d.InputWidth-1)*d.Stride + d.FilterWidth
+}
+
+// OutputHeight computes the height of the output tensor.
+func (d *DeconvLayer) OutputHeight() int {
+	if d.InputHeight == 0 {
+		return 0
+	}
+	return (d.InputHeight-1)*d.Stride + d.FilterHeight
+}
+
+// Randomize randomly initializes the layer's
+// filters and biases.
+// This will allocate d.Filters, d.Biases, and
+// d.FilterVar if needed.
+func (d *DeconvLayer) Randomize() {
+	if d.Filters == nil {
+		filterSize := d.filterSize()
+		d.FilterVar = &autofunc.Variable{
+			Vector: make(linalg.Vector, d.InputDepth*filterSize),
+		}
+		for i := 0; i < d.InputDepth; i++ {
+			filter := &tensor.Float64{
+				Width:  d.FilterWidth,
+				Height: d.FilterHeight,
+				Depth:  d.OutputDepth,
+				Data:   d.FilterVar.Vector[i*filterSize : (i+1)*filterSize],
+			}
+			d.Filters = append(d.Filters, filter)
+		}
+	}
+	if d.Biases == nil {
+		d.Biases = &autofunc.Variable{Vector: make(linalg.Vector, d.OutputDepth)}
+	}
+	coeff := math.Sqrt(3.0 / float64(d.FilterWidth*d.FilterHeight*d.InputDepth))
+	for i := range d.FilterVar.Vector {
+		d.FilterVar.Vector[i] = coeff * ((rand.Float64() * 2) - 1)
+	}
+	for i := range d.Biases.Vector {
+		d.Biases.Vector[i] = (rand.Float64() * 2) - 1
+	}
+}
+
+// Parameters returns a slice containing the bias
+// and filter variables.
+func (d *DeconvLayer) Parameters() []*autofunc.Variable {
+	if d.Filters == nil || d.Biases == nil || d.FilterVar == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{d.Biases, d.FilterVar}
+}
+
+// Apply computes transposed convolutions on the input.
+// The result is only valid as long as the DeconvLayer
+// that produced it is not modified.
+func (d *DeconvLayer) Apply(in autofunc.Result) autofunc.Result {
+	return d.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for autofunc.RResults.
+func (d *DeconvLayer) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return d.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (d *DeconvLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	if d.Filters == nil || d.Biases == nil || d.FilterVar == nil {
+		panic(uninitPanicMessage)
+	}
+	outSize := d.outputSize()
+	inSize := d.inputSize()
+	if len(in.Output()) != n*inSize {
+		panic("invalid input size")
+	}
+	res := &deconvLayerResult{
+		OutputVec: make(linalg.Vector, outSize*n),
+		Input:     in,
+		N:         n,
+		Layer:     d,
+	}
+
+	dims := d.im2ColDims()
+
+	if ConvLayer32Bit() {
+		tempMat := make([]float32, dims.MatrixSize())
+		i2c := tensor.NewIm2Col32(dims)
+		for i := 0; i < n; i++ {
+			subIn := in.Output()[i*inSize : (i+1)*inSize]
+			subOut := res.OutputVec[i*outSize : (i+1)*outSize]
+			d.deconvolve32(cast32(subIn), i2c, tempMat, subOut)
+		}
+	} else {
+		tempMat := make([]float64, dims.MatrixSize())
+		i2c := tensor.NewIm2Col64(dims)
+		for i := 0; i < n; i++ {
+			subIn := in.Output()[i*inSize : (i+1)*inSize]
+			subOut := res.OutputVec[i*outSize : (i+1)*outSize]
+			d.deconvolve(subIn, d.FilterVar.Vector, i2c, tempMat, subOut)
+			d.addBiases(d.Biases.Vector, subOut)
+		}
+	}
+	return res
+}
+
+// BatchR is like Batch, but for RResults.
+func (d *DeconvLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	if d.Filters == nil || d.Biases == nil || d.FilterVar == nil {
+		panic(uninitPanicMessage)
+	}
+	outSize := d.outputSize()
+	inSize := d.inputSize()
+	if len(in.Output()) != n*inSize {
+		panic("invalid input size")
+	}
+	res := &deconvLayerRResult{
+		OutputVec:  make(linalg.Vector, outSize*n),
+		ROutputVec: make(linalg.Vector, outSize*n),
+		Input:      in,
+		FiltersR:   rv[d.FilterVar],
+		N:          n,
+		Layer:      d,
+	}
+
+	dims := d.im2ColDims()
+	tempMat := make([]float64, dims.MatrixSize())
+	i2c := tensor.NewIm2Col64(dims)
+	tempOut := make(linalg.Vector, outSize)
+
+	for i := 0; i < n; i++ {
+		subIn := in.Output()[i*inSize : (i+1)*inSize]
+		subOut := res.OutputVec[i*outSize : (i+1)*outSize]
+		d.deconvolve(subIn, d.FilterVar.Vector, i2c, tempMat, subOut)
+		d.addBiases(d.Biases.Vector, subOut)
+
+		subInR := in.ROutput()[i*inSize : (i+1)*inSize]
+		subOutR := res.ROutputVec[i*outSize : (i+1)*outSize]
+		d.deconvolve(subInR, d.FilterVar.Vector, i2c, tempMat, subOutR)
+		if res.FiltersR != nil {
+			d.deconvolve(subIn, res.FiltersR, i2c, tempMat, tempOut)
+			subOutR.Add(tempOut)
+		}
+		if biasR, ok := rv[d.Biases]; ok {
+			d.addBiases(biasR, subOutR)
+		}
+	}
+	return res
+}
+
+// Serialize serializes the layer.
+func (d *DeconvLayer) Serialize() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (d *DeconvLayer) SerializerType() string {
+	return serializerTypeDeconvLayer
+}
+
+func (d *DeconvLayer) filterSize() int {
+	return d.FilterWidth * d.FilterHeight * d.OutputDepth
+}
+
+func (d *DeconvLayer) inputSize() int {
+	return d.InputWidth * d.InputHeight * d.InputDepth
+}
+
+func (d *DeconvLayer) outputSize() int {
+	return d.OutputWidth() * d.OutputHeight() * d.OutputDepth
+}
+
+// im2ColDims returns the dimensions for converting an
+// output tensor into a matrix with one row per input
+// position.
+func (d *DeconvLayer) im2ColDims() *tensor.Im2ColDims {
+	return &tensor.Im2ColDims{
+		ImageWidth:  d.OutputWidth(),
+		ImageHeight: d.OutputHeight(),
+		ImageDepth:  d.OutputDepth,
+
+		FilterWidth:  d.FilterWidth,
+		FilterHeight: d.FilterHeight,
+		FilterStride: d.Stride,
+	}
+}
+
+func (d *DeconvLayer) inputMatrix(in []float64) blas64.General {
+	return blas64.General{
+		Rows:   d.InputWidth * d.InputHeight,
+		Cols:   d.InputDepth,
+		Stride: d.InputDepth,
+		Data:   in,
+	}
+}
+
+func (d *DeconvLayer) filterMatrix(filters []float64) blas64.General {
+	return blas64.General{
+		Rows:   d.InputDepth,
+		Cols:   d.filterSize(),
+		Stride: d.filterSize(),
+		Data:   filters,
+	}
+}
+
+func (d *DeconvLayer) columnMatrix(data []float64) blas64.General {
+	return blas64.General{
+		Rows:   d.InputWidth * d.InputHeight,
+		Cols:   d.filterSize(),
+		Stride: d.filterSize(),
+		Data:   data,
+	}
+}
+
+func (d *DeconvLayer) outputTensor(out []float64) *tensor.Float64 {
+	return &tensor.Float64{
+		Width:  d.OutputWidth(),
+		Height: d.OutputHeight(),
+		Depth:  d.OutputDepth,
+		Data:   out,
+	}
+}
+
+// deconvolve computes the transposed convolution of the
+// input and stores it in out, without adding biases.
+func (d *DeconvLayer) deconvolve(in, filters []float64, i2c tensor.Im2Col64,
+	matScratch []float64, out []float64) {
+	colMat := d.columnMatrix(matScratch)
+	blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, d.inputMatrix(in),
+		d.filterMatrix(filters), 0, colMat)
+	copy(out, i2c.ToImage(colMat.Data).Data)
+}
+
+func (d *DeconvLayer) deconvolve32(in []float32, i2c tensor.Im2Col32,
+	matScratch []float32, out []float64) {
+	inMat := blas32.General{
+		Rows:   d.InputWidth * d.InputHeight,
+		Cols:   d.InputDepth,
+		Stride: d.InputDepth,
+		Data:   in,
+	}
+	filterMat := blas32.General{
+		Rows:   d.InputDepth,
+		Cols:   d.filterSize(),
+		Stride: d.filterSize(),
+		Data:   cast32(d.FilterVar.Vector),
+	}
+	colMat := blas32.General{
+		Rows:   d.InputWidth * d.InputHeight,
+		Cols:   d.filterSize(),
+		Stride: d.filterSize(),
+		Data:   matScratch,
+	}
+	blas32.Gemm(blas.NoTrans, blas.NoTrans, 1, inMat, filterMat, 0, colMat)
+	cast64InPlace(out, i2c.ToImage(colMat.Data).Data)
+	d.addBiases(d.Biases.Vector, out)
+}
+
+func (d *DeconvLayer) addBiases(biases, out []float64) {
+	biasVec := blas64.Vector{Inc: 1, Data: biases}
+	for i := 0; i < len(out); i += d.OutputDepth {
+		outVec := blas64.Vector{Inc: 1, Data: out[i : i+d.OutputDepth]}
+		blas64.Axpy(d.OutputDepth, 1, biasVec, outVec)
+	}
+}
+
+// sumBiases adds the gradient of the biases, given the
+// upstream gradient of an output, to biasGrad.
+func (d *DeconvLayer) sumBiases(upstream, biasGrad []float64) {
+	biasGradVec := blas64.Vector{Inc: 1, Data: biasGrad}
+	for i := 0; i < len(upstream); i += d.OutputDepth {
+		row := blas64.Vector{Inc: 1, Data: upstream[i : i+d.OutputDepth]}
+		blas64.Axpy(d.OutputDepth, 1, row, biasGradVec)
+	}
+}
+
+type deconvLayerResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *DeconvLayer
+}
+
+func (d *deconvLayerResult) Output() linalg.Vector {
+	return d.OutputVec
+}
+
+func (d *deconvLayerResult) Constant(g autofunc.Gradient) bool {
+	if !d.Layer.Biases.Constant(g) {
+		return false
+	}
+	if !d.Input.Constant(g) {
+		return false
+	}
+	return d.Layer.FilterVar.Constant(g)
+}
+
+func (d *deconvLayerResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	if biasGrad, ok := grad[d.Layer.Biases]; ok {
+		d.Layer.sumBiases(upstream, biasGrad)
+	}
+
+	var inputDownstream linalg.Vector
+	if !d.Input.Constant(grad) {
+		inputDownstream = make(linalg.Vector, len(d.Input.Output()))
+	}
+
+	dims := d.Layer.im2ColDims()
+	var i2c32 tensor.Im2Col32
+	var i2c64 tensor.Im2Col64
+	var matScratch32 []float32
+	var matScratch64 []float64
+	if ConvLayer32Bit() {
+		i2c32 = tensor.NewIm2Col32(dims)
+		matScratch32 = make([]float32, dims.MatrixSize())
+	} else {
+		i2c64 = tensor.NewIm2Col64(dims)
+		matScratch64 = make([]float64, dims.MatrixSize())
+	}
+
+	subUpstreamSize := len(upstream) / d.N
+	subDownstreamSize := len(d.Input.Output()) / d.N
+	for i := 0; i < d.N; i++ {
+		subUpstream := upstream[i*subUpstreamSize : (i+1)*subUpstreamSize]
+		var subDownstream linalg.Vector
+		if inputDownstream != nil {
+			subDownstream = inputDownstream[i*subDownstreamSize : (i+1)*subDownstreamSize]
+		}
+		subInput := d.Input.Output()[i*subDownstreamSize : (i+1)*subDownstreamSize]
+		if i2c32 != nil {
+			d.propagateSingle32(subInput, subUpstream, subDownstream, grad,
+				i2c32, matScratch32)
+		} else {
+			d.propagateSingle(subInput, subUpstream, subDownstream, grad,
+				i2c64, matScratch64)
+		}
+	}
+
+	if inputDownstream != nil {
+		d.Input.PropagateGradient(inputDownstream, grad)
+	}
+}
+
+func (d *deconvLayerResult) propagateSingle(input, upstream, downstream linalg.Vector,
+	grad autofunc.Gradient, i2c tensor.Im2Col64, matScratch []float64) {
+	i2c.ToMatrix(matScratch, d.Layer.outputTensor(upstream))
+	upstreamMat := d.Layer.columnMatrix(matScratch)
+
+	if filterGrad, ok := grad[d.Layer.FilterVar]; ok {
+		blas64.Gemm(blas.Trans, blas.NoTrans, 1, d.Layer.inputMatrix(input),
+			upstreamMat, 1, d.Layer.filterMatrix(filterGrad))
+	}
+
+	if downstream != nil {
+		blas64.Gemm(blas.NoTrans, blas.Trans, 1, upstreamMat,
+			d.Layer.filterMatrix(d.Layer.FilterVar.Vector), 0,
+			d.Layer.inputMatrix(downstream))
+	}
+}
+
+func (d *deconvLayerResult) propagateSingle32(input, upstream, downstream linalg.Vector,
+	grad autofunc.Gradient, i2c tensor.Im2Col32, matScratch []float32) {
+	l := d.Layer
+	upTensor := &tensor.Float32{
+		Width:  l.OutputWidth(),
+		Height: l.OutputHeight(),
+		Depth:  l.OutputDepth,
+		Data:   cast32(upstream),
+	}
+	i2c.ToMatrix(matScratch, upTensor)
+	upstreamMat := blas32.General{
+		Rows:   l.InputWidth * l.InputHeight,
+		Cols:   l.filterSize(),
+		Stride: l.filterSize(),
+		Data:   matScratch,
+	}
+
+	if filterGrad, ok := grad[l.FilterVar]; ok {
+		inMat := blas32.General{
+			Rows:   l.InputWidth * l.InputHeight,
+			Cols:   l.InputDepth,
+			Stride: l.InputDepth,
+			Data:   cast32(input),
+		}
+		destMat := blas32.General{
+			Rows:   l.InputDepth,
+			Cols:   l.filterSize(),
+			Stride: l.filterSize(),
+			Data:   cast32(filterGrad),
+		}
+		blas32.Gemm(blas.Trans, blas.NoTrans, 1, inMat, upstreamMat, 1, destMat)
+		cast64InPlace(filterGrad, destMat.Data)
+	}
+
+	if downstream != nil {
+		filterMat := blas32.General{
+			Rows:   l.InputDepth,
+			Cols:   l.filterSize(),
+			Stride: l.filterSize(),
+			Data:   cast32(l.FilterVar.Vector),
+		}
+		downMat := blas32.General{
+			Rows:   l.InputWidth * l.InputHeight,
+			Cols:   l.InputDepth,
+			Stride: l.InputDepth,
+			Data:   make([]float32, len(downstream)),
+		}
+		blas32.Gemm(blas.NoTrans, blas.Trans, 1, upstreamMat, filterMat, 0, downMat)
+		cast64InPlace(downstream, downMat.Data)
+	}
+}
+
+type deconvLayerRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	FiltersR   linalg.Vector
+	N          int
+	Layer      *DeconvLayer
+}
+
+func (d *deconvLayerRResult) Output() linalg.Vector {
+	return d.OutputVec
+}
+
+func (d *deconvLayerRResult) ROutput() linalg.Vector {
+	return d.ROutputVec
+}
+
+func (d *deconvLayerRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !d.Layer.Biases.Constant(g) {
+		return false
+	} else if _, ok := rg[d.Layer.Biases]; ok {
+		return false
+	}
+
+	if !d.Layer.FilterVar.Constant(g) {
+		return false
+	} else if _, ok := rg[d.Layer.FilterVar]; ok {
+		return false
+	}
+
+	return d.Input.Constant(rg, g)
+}
+
+func (d *deconvLayerRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	if biasGrad, ok := grad[d.Layer.Biases]; ok {
+		d.Layer.sumBiases(upstream, biasGrad)
+	}
+	if biasRGrad, ok := rgrad[d.Layer.Biases]; ok {
+		d.Layer.sumBiases(upstreamR, biasRGrad)
+	}
+
+	var inputDownstream, inputDownstreamR linalg.Vector
+	if !d.Input.Constant(rgrad, grad) {
+		inputDownstream = make(linalg.Vector, len(d.Input.Output()))
+		inputDownstreamR = make(linalg.Vector, len(d.Input.Output()))
+	}
+
+	dims := d.Layer.im2ColDims()
+	i2c := tensor.NewIm2Col64(dims)
+	matScratch := make([]float64, dims.MatrixSize())
+	matScratchR := make([]float64, dims.MatrixSize())
+
+	subUpstreamSize := len(upstream) / d.N
+	subDownstreamSize := len(d.Input.Output()) / d.N
+	for i := 0; i < d.N; i++ {
+		subUpstream := upstream[i*subUpstreamSize : (i+1)*subUpstreamSize]
+		subUpstreamR := upstreamR[i*subUpstreamSize : (i+1)*subUpstreamSize]
+		var subDownstream, subDownstreamR linalg.Vector
+		if inputDownstream != nil {
+			subDownstream = inputDownstream[i*subDownstreamSize : (i+1)*subDownstreamSize]
+			subDownstreamR = inputDownstreamR[i*subDownstreamSize : (i+1)*subDownstreamSize]
+		}
+		subInput := d.Input.Output()[i*subDownstreamSize : (i+1)*subDownstreamSize]
+		subInputR := d.Input.ROutput()[i*subDownstreamSize : (i+1)*subDownstreamSize]
+		d.propagateSingle(subInput, subInputR, subUpstream, subUpstreamR,
+			subDownstream, subDownstreamR, rgrad, grad, i2c, matScratch,
+			matScratchR)
+	}
+
+	if inputDownstream != nil {
+		d.Input.PropagateRGradient(inputDownstream, inputDownstreamR, rgrad, grad)
+	}
+}
+
+func (d *deconvLayerRResult) propagateSingle(input, inputR, upstream, upstreamR, downstream,
+	downstreamR linalg.Vector, rgrad autofunc.RGradient, grad autofunc.Gradient,
+	i2c tensor.Im2Col64, matScratch, matScratchR []float64) {
+	l := d.Layer
+	i2c.ToMatrix(matScratch, l.outputTensor(upstream))
+	i2c.ToMatrix(matScratchR, l.outputTensor(upstreamR))
+	upstreamMat := l.columnMatrix(matScratch)
+	upstreamMatR := l.columnMatrix(matScratchR)
+
+	if downstream != nil {
+		filterMat := l.filterMatrix(l.FilterVar.Vector)
+		blas64.Gemm(blas.NoTrans, blas.Trans, 1, upstreamMat, filterMat, 0,
+			l.inputMatrix(downstream))
+		blas64.Gemm(blas.NoTrans, blas.Trans, 1, upstreamMatR, filterMat, 0,
+			l.inputMatrix(downstreamR))
+		if d.FiltersR != nil {
+			blas64.Gemm(blas.NoTrans, blas.Trans, 1, upstreamMat,
+				l.filterMatrix(d.FiltersR), 1, l.inputMatrix(downstreamR))
+		}
+	}
+
+	if filterGrad, ok := grad[l.FilterVar]; ok {
+		blas64.Gemm(blas.Trans, blas.NoTrans, 1, l.inputMatrix(input),
+			upstreamMat, 1, l.filterMatrix(filterGrad))
+	}
+
+	if filterRGrad, ok := rgrad[l.FilterVar]; ok {
+		destMat := l.filterMatrix(filterRGrad)
+		blas64.Gemm(blas.Trans, blas.NoTrans, 1, l.inputMatrix(input),
+			upstreamMatR, 1, destMat)
+		blas64.Gemm(blas.Trans, blas.NoTrans, 1, l.inputMatrix(inputR),
+			upstreamMat, 1, destMat)
+	}
+}
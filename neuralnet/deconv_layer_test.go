@@ -0,0 +1,225 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestDeconvDimensions(t *testing.T) {
+	layers := []*DeconvLayer{
+		{FilterWidth: 3, FilterHeight: 3, Stride: 1, InputWidth: 7, InputHeight: 7},
+		{FilterWidth: 4, FilterHeight: 7, Stride: 2, InputWidth: 7, InputHeight: 25},
+	}
+
+	outputDims := [][]int{
+		{9, 9},
+		{16, 55},
+	}
+
+	for i, layer := range layers {
+		expOutDims := outputDims[i]
+		if layer.OutputWidth() != expOutDims[0] || layer.OutputHeight() != expOutDims[1] {
+			t.Errorf("test %d gave %d,%d output (expected %d,%d)", i,
+				layer.OutputWidth(), layer.OutputHeight(),
+				expOutDims[0], expOutDims[1])
+		}
+	}
+}
+
+// TestDeconvTranspose verifies that a DeconvLayer computes
+// the transpose of the corresponding ConvLayer.
+func TestDeconvTranspose(t *testing.T) {
+	convTestBothSizes(t, func(t *testing.T) {
+		conv := &ConvLayer{
+			FilterCount:  3,
+			FilterWidth:  3,
+			FilterHeight: 2,
+			Stride:       2,
+			InputWidth:   9,
+			InputHeight:  6,
+			InputDepth:   2,
+		}
+		conv.Randomize()
+		deconv := &DeconvLayer{
+			FilterWidth:  3,
+			FilterHeight: 2,
+			Stride:       2,
+			InputWidth:   conv.OutputWidth(),
+			InputHeight:  conv.OutputHeight(),
+			InputDepth:   3,
+			OutputDepth:  2,
+		}
+		deconv.Randomize()
+		copy(deconv.FilterVar.Vector, conv.FilterVar.Vector)
+		for i := range conv.Biases.Vector {
+			conv.Biases.Vector[i] = 0
+		}
+		for i := range deconv.Biases.Vector {
+			deconv.Biases.Vector[i] = 0
+		}
+
+		x := make(linalg.Vector, 9*6*2)
+		for i := range x {
+			x[i] = rand.NormFloat64()
+		}
+		y := make(linalg.Vector, deconv.InputWidth*deconv.InputHeight*3)
+		for i := range y {
+			y[i] = rand.NormFloat64()
+		}
+
+		convOut := conv.Apply(&autofunc.Variable{Vector: x}).Output()
+		deconvOut := deconv.Apply(&autofunc.Variable{Vector: y}).Output()
+		if len(deconvOut) != len(x) {
+			t.Fatalf("expected %d outputs but got %d", len(x), len(deconvOut))
+		}
+		expected := convOut.Dot(y)
+		actual := deconvOut.Dot(x)
+		if math.Abs(expected-actual) > 1e-3 {
+			t.Errorf("expected dot product %f but got %f", expected, actual)
+		}
+	})
+}
+
+func TestDeconvLayerRProp(t *testing.T) {
+	layer := &DeconvLayer{
+		FilterWidth:  2,
+		FilterHeight: 3,
+		Stride:       2,
+		InputWidth:   3,
+		InputHeight:  4,
+		InputDepth:   2,
+		OutputDepth:  3,
+	}
+	layer.Randomize()
+
+	input := make(linalg.Vector, 3*4*2)
+	for i := range input {
+		input[i] = rand.Float64()*2 - 1
+	}
+	inVar := &autofunc.Variable{Vector: input}
+
+	variables := append(layer.Parameters(), inVar)
+	rVector := autofunc.RVector{}
+	for _, variable := range variables {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.Float64()*2 - 1
+		}
+	}
+	funcTest := &functest.RFuncChecker{
+		F:     layer,
+		Vars:  variables,
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.FullCheck(t)
+}
+
+func TestDeconvLayerBatch(t *testing.T) {
+	convTestBothSizes(t, func(t *testing.T) {
+		layer := &DeconvLayer{
+			FilterWidth:  4,
+			FilterHeight: 3,
+			Stride:       3,
+			InputWidth:   6,
+			InputHeight:  5,
+			InputDepth:   4,
+			OutputDepth:  3,
+		}
+		layer.Randomize()
+
+		n := 3
+		batchInput := make(linalg.Vector, n*layer.InputWidth*layer.InputHeight*layer.InputDepth)
+		for i := range batchInput {
+			batchInput[i] = rand.NormFloat64()
+		}
+		batchRes := &autofunc.Variable{Vector: batchInput}
+
+		testBatcher(t, layer, batchRes, n, []*autofunc.Variable{batchRes, layer.Biases,
+			layer.FilterVar})
+	})
+}
+
+func TestDeconvLayerBatchR(t *testing.T) {
+	layer := &DeconvLayer{
+		FilterWidth:  4,
+		FilterHeight: 3,
+		Stride:       3,
+		InputWidth:   6,
+		InputHeight:  5,
+		InputDepth:   4,
+		OutputDepth:  3,
+	}
+	layer.Randomize()
+
+	n := 3
+	batchInput := make(linalg.Vector, n*layer.InputWidth*layer.InputHeight*layer.InputDepth)
+	for i := range batchInput {
+		batchInput[i] = rand.NormFloat64()
+	}
+	batchRes := &autofunc.Variable{Vector: batchInput}
+
+	params := []*autofunc.Variable{batchRes, layer.Biases, layer.FilterVar}
+
+	rVec := autofunc.RVector{}
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+		rVec[param] = vec
+	}
+
+	testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec), n, params)
+}
+
+func TestDeconvLayerSerialize(t *testing.T) {
+	layer := &DeconvLayer{
+		FilterWidth:  2,
+		FilterHeight: 3,
+		Stride:       2,
+		InputWidth:   4,
+		InputHeight:  5,
+		InputDepth:   2,
+		OutputDepth:  3,
+	}
+	layer.Randomize()
+
+	data, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := serializer.GetDeserializer(layer.SerializerType())(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := l.(*DeconvLayer)
+	if !ok {
+		t.Fatalf("expected *DeconvLayer but got %T", l)
+	}
+
+	if len(newLayer.Filters) != len(layer.Filters) {
+		t.Fatalf("expected %d filters but got %d", len(layer.Filters), len(newLayer.Filters))
+	}
+	for i, x := range layer.FilterVar.Vector {
+		if newLayer.FilterVar.Vector[i] != x {
+			t.Fatalf("filter value %d should be %f but got %f", i, x,
+				newLayer.FilterVar.Vector[i])
+		}
+	}
+	for i, x := range layer.Biases.Vector {
+		if newLayer.Biases.Vector[i] != x {
+			t.Fatalf("bias %d should be %f but got %f", i, x, newLayer.Biases.Vector[i])
+		}
+	}
+	newLayer.FilterVar.Vector[0] = 1337
+	if newLayer.Filters[0].Data[0] != 1337 {
+		t.Error("Filters do not share memory with FilterVar")
+	}
+}
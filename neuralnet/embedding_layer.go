@@ -0,0 +1,275 @@
+package neuralnet
+
+import (
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+// An EmbeddingLayer maps integer tokens to learned
+// vectors, known as embeddings.
+// Its input is a vector of token indices, each of which
+// is replaced by the corresponding embedding to form the
+// layer's output.
+//
+// An EmbeddingLayer is much faster than a DenseLayer
+// applied to one-hot vectors, both because it does not
+// perform any multiplications and because gradients are
+// only accumulated for the embeddings which were used.
+type EmbeddingLayer struct {
+	// VocabSize is the number of distinct tokens.
+	// Every token index must be less than VocabSize.
+	VocabSize int
+
+	// EmbeddingSize is the number of components in
+	// each embedding.
+	EmbeddingSize int
+
+	// TokenCount is the number of leading entries in
+	// each input which are treated as tokens.
+	// The remaining entries are appended to the output
+	// unchanged.
+	// If TokenCount is 0, every entry is a token.
+	//
+	// This makes it possible to put an EmbeddingLayer at
+	// the bottom of an rnn.NetworkBlock, whose inputs are
+	// followed by the block's state.
+	TokenCount int
+
+	// Embeddings stores the embeddings one after the
+	// other, ordered by token index.
+	Embeddings *autofunc.Variable
+}
+
+// NewEmbeddingLayer creates a randomized EmbeddingLayer
+// with the given vocabulary and embedding sizes.
+func NewEmbeddingLayer(vocabSize, embeddingSize int) *EmbeddingLayer {
+	res := &EmbeddingLayer{VocabSize: vocabSize, EmbeddingSize: embeddingSize}
+	res.Randomize()
+	return res
+}
+
+// DeserializeEmbeddingLayer deserializes an
+// EmbeddingLayer.
+func DeserializeEmbeddingLayer(d []byte) (*EmbeddingLayer, error) {
+	var vocabSize, embeddingSize, tokenCount serializer.Int
+	var res EmbeddingLayer
+	err := serializer.DeserializeAny(d, &vocabSize, &embeddingSize, &tokenCount,
+		&res.Embeddings)
+	if err != nil {
+		return nil, err
+	}
+	res.VocabSize = int(vocabSize)
+	res.EmbeddingSize = int(embeddingSize)
+	res.TokenCount = int(tokenCount)
+	return &res, nil
+}
+
+// Randomize initializes the embeddings with normally
+// distributed values.
+// This will allocate e.Embeddings if needed.
+func (e *EmbeddingLayer) Randomize() {
+	if e.Embeddings == nil {
+		e.Embeddings = &autofunc.Variable{
+			Vector: make(linalg.Vector, e.VocabSize*e.EmbeddingSize),
+		}
+	}
+	for i := range e.Embeddings.Vector {
+		e.Embeddings.Vector[i] = rand.NormFloat64()
+	}
+}
+
+// Parameters returns a slice containing the embedding
+// variable.
+func (e *EmbeddingLayer) Parameters() []*autofunc.Variable {
+	if e.Embeddings == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{e.Embeddings}
+}
+
+// Apply looks up the embeddings for the tokens in the
+// input vector.
+func (e *EmbeddingLayer) Apply(in autofunc.Result) autofunc.Result {
+	return e.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+// The R-operator only applies to the embeddings, since
+// tokens are not differentiable.
+func (e *EmbeddingLayer) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return e.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (e *EmbeddingLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	if e.Embeddings == nil {
+		panic(uninitPanicMessage)
+	}
+	return &embeddingResult{
+		OutputVec: e.embed(e.Embeddings.Vector, in.Output(), in.Output(), n),
+		Input:     in,
+		N:         n,
+		Layer:     e,
+	}
+}
+
+// BatchR is like Batch, but for RResults.
+func (e *EmbeddingLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	if e.Embeddings == nil {
+		panic(uninitPanicMessage)
+	}
+	return &embeddingRResult{
+		OutputVec:  e.embed(e.Embeddings.Vector, in.Output(), in.Output(), n),
+		ROutputVec: e.embed(rv[e.Embeddings], in.Output(), in.ROutput(), n),
+		Input:      in,
+		N:          n,
+		Layer:      e,
+	}
+}
+
+// Serialize serializes the layer.
+func (e *EmbeddingLayer) Serialize() ([]byte, error) {
+	return serializer.SerializeAny(
+		serializer.Int(e.VocabSize),
+		serializer.Int(e.EmbeddingSize),
+		serializer.Int(e.TokenCount),
+		e.Embeddings,
+	)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (e *EmbeddingLayer) SerializerType() string {
+	return serializerTypeEmbeddingLayer
+}
+
+func (e *EmbeddingLayer) tokenCount(inSize int) int {
+	if e.TokenCount == 0 {
+		return inSize
+	} else if e.TokenCount > inSize {
+		panic("invalid input size")
+	}
+	return e.TokenCount
+}
+
+// embed produces the output for a batch of inputs.
+// The embeddings for the tokens in in are read from
+// table, which may be nil to indicate all zeros, and
+// the non-token entries are copied from extra.
+func (e *EmbeddingLayer) embed(table, in, extra linalg.Vector, n int) linalg.Vector {
+	inSize := len(in) / n
+	tokenCount := e.tokenCount(inSize)
+	res := make(linalg.Vector, 0, n*(tokenCount*e.EmbeddingSize+inSize-tokenCount))
+	for i := 0; i < n; i++ {
+		sample := in[i*inSize : (i+1)*inSize]
+		for _, x := range sample[:tokenCount] {
+			if table == nil {
+				res = append(res, make(linalg.Vector, e.EmbeddingSize)...)
+			} else {
+				idx := e.tokenIndex(x)
+				res = append(res, table[idx*e.EmbeddingSize:(idx+1)*e.EmbeddingSize]...)
+			}
+		}
+		res = append(res, extra[i*inSize+tokenCount:(i+1)*inSize]...)
+	}
+	return res
+}
+
+// propagate adds the gradient of the embeddings to
+// embGrad (which may be nil) and returns the gradient of
+// the input, whose token entries are always zero.
+func (e *EmbeddingLayer) propagate(in, upstream, embGrad linalg.Vector,
+	n int) linalg.Vector {
+	inSize := len(in) / n
+	tokenCount := e.tokenCount(inSize)
+	downstream := make(linalg.Vector, len(in))
+	var upIdx int
+	for i := 0; i < n; i++ {
+		sample := in[i*inSize : (i+1)*inSize]
+		for _, x := range sample[:tokenCount] {
+			if embGrad != nil {
+				idx := e.tokenIndex(x)
+				embGrad[idx*e.EmbeddingSize : (idx+1)*e.EmbeddingSize].Add(
+					upstream[upIdx : upIdx+e.EmbeddingSize])
+			}
+			upIdx += e.EmbeddingSize
+		}
+		extraCount := inSize - tokenCount
+		copy(downstream[i*inSize+tokenCount:(i+1)*inSize], upstream[upIdx:upIdx+extraCount])
+		upIdx += extraCount
+	}
+	return downstream
+}
+
+func (e *EmbeddingLayer) tokenIndex(x float64) int {
+	idx := int(x + 0.5)
+	if idx < 0 || idx >= e.VocabSize {
+		panic("token index out of range")
+	}
+	return idx
+}
+
+type embeddingResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *EmbeddingLayer
+}
+
+func (e *embeddingResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *embeddingResult) Constant(g autofunc.Gradient) bool {
+	return e.Layer.Embeddings.Constant(g) && e.Input.Constant(g)
+}
+
+func (e *embeddingResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	embGrad := grad[e.Layer.Embeddings]
+	downstream := e.Layer.propagate(e.Input.Output(), upstream, embGrad, e.N)
+	if !e.Input.Constant(grad) {
+		e.Input.PropagateGradient(downstream, grad)
+	}
+}
+
+type embeddingRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	N          int
+	Layer      *EmbeddingLayer
+}
+
+func (e *embeddingRResult) Output() linalg.Vector {
+	return e.OutputVec
+}
+
+func (e *embeddingRResult) ROutput() linalg.Vector {
+	return e.ROutputVec
+}
+
+func (e *embeddingRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !e.Layer.Embeddings.Constant(g) {
+		return false
+	} else if _, ok := rg[e.Layer.Embeddings]; ok {
+		return false
+	}
+	return e.Input.Constant(rg, g)
+}
+
+func (e *embeddingRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if grad == nil {
+		grad = autofunc.Gradient{}
+	}
+	in := e.Input.Output()
+	downstream := e.Layer.propagate(in, upstream, grad[e.Layer.Embeddings], e.N)
+	downstreamR := e.Layer.propagate(in, upstreamR, rgrad[e.Layer.Embeddings], e.N)
+	if !e.Input.Constant(rgrad, grad) {
+		e.Input.PropagateRGradient(downstream, downstreamR, rgrad, grad)
+	}
+}
@@ -0,0 +1,108 @@
+package neuralnet
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestEmbeddingForward(t *testing.T) {
+	layer := &EmbeddingLayer{
+		VocabSize:     3,
+		EmbeddingSize: 2,
+		TokenCount:    2,
+		Embeddings: &autofunc.Variable{
+			Vector: linalg.Vector{1, 2, 3, 4, 5, 6},
+		},
+	}
+	input := &autofunc.Variable{Vector: linalg.Vector{2, 0, -1, 7}}
+	actual := layer.Apply(input).Output()
+	expected := []float64{5, 6, 1, 2, -1, 7}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		if actual[i] != x {
+			t.Errorf("output %d should be %f but got %f", i, x, actual[i])
+		}
+	}
+}
+
+func TestEmbeddingRProp(t *testing.T) {
+	layer := NewEmbeddingLayer(5, 3)
+	layer.TokenCount = 4
+	inVar := &autofunc.Variable{
+		Vector: linalg.Vector{3, 1, 3, 0, 0.5, -0.3},
+	}
+	variables := append(layer.Parameters(), inVar)
+	rVector := autofunc.RVector{}
+	for _, variable := range variables {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.Float64()*2 - 1
+		}
+	}
+	funcTest := &functest.RFuncChecker{
+		F:     layer,
+		Vars:  variables,
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.FullCheck(t)
+}
+
+func TestEmbeddingBatch(t *testing.T) {
+	for _, tokenCount := range []int{0, 3} {
+		layer := NewEmbeddingLayer(7, 4)
+		layer.TokenCount = tokenCount
+
+		n := 3
+		batchRes := &autofunc.Variable{Vector: make(linalg.Vector, n*5)}
+		for i := range batchRes.Vector {
+			batchRes.Vector[i] = float64(rand.Intn(layer.VocabSize))
+		}
+		params := []*autofunc.Variable{batchRes, layer.Embeddings}
+		rVec := autofunc.RVector{}
+		for _, param := range params {
+			rVec[param] = make(linalg.Vector, len(param.Vector))
+			for i := range rVec[param] {
+				rVec[param][i] = rand.NormFloat64()
+			}
+		}
+
+		testBatcher(t, layer, batchRes, n, params)
+		testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec), n, params)
+	}
+}
+
+func TestEmbeddingSerialize(t *testing.T) {
+	layer := NewEmbeddingLayer(4, 3)
+	layer.TokenCount = 2
+	encoded, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*EmbeddingLayer)
+	if !ok {
+		t.Fatalf("expected *EmbeddingLayer but got %T", decoded)
+	}
+	if newLayer.VocabSize != layer.VocabSize ||
+		newLayer.EmbeddingSize != layer.EmbeddingSize ||
+		newLayer.TokenCount != layer.TokenCount {
+		t.Fatalf("expected %v but got %v", layer, newLayer)
+	}
+	for i, x := range layer.Embeddings.Vector {
+		if newLayer.Embeddings.Vector[i] != x {
+			t.Errorf("embedding value %d should be %f but got %f", i, x,
+				newLayer.Embeddings.Vector[i])
+		}
+	}
+}
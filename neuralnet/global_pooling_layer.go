@@ -0,0 +1,153 @@
+package neuralnet
+
+import (
+	"encoding/json"
+
+	"github.com/unixpickle/autofunc"
+)
+
+// A GlobalAveragePoolingLayer collapses each depth layer
+// of an input tensor into a single value by averaging
+// all of the values in that depth layer.
+//
+// The output is a vector with InputDepth components.
+type GlobalAveragePoolingLayer struct {
+	// InputWidth indicates the width of the
+	// layer's input tensor.
+	InputWidth int
+
+	// InputHeight indicates the height of the
+	// layer's input tensor.
+	InputHeight int
+
+	// InputDepth indicates the depth of the
+	// layer's input tensor.
+	InputDepth int
+}
+
+// DeserializeGlobalAveragePoolingLayer deserializes a
+// GlobalAveragePoolingLayer.
+func DeserializeGlobalAveragePoolingLayer(d []byte) (*GlobalAveragePoolingLayer, error) {
+	var res GlobalAveragePoolingLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Apply applies the layer to an input, which is treated
+// as a tensor.
+func (g *GlobalAveragePoolingLayer) Apply(in autofunc.Result) autofunc.Result {
+	return g.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (g *GlobalAveragePoolingLayer) ApplyR(rv autofunc.RVector,
+	in autofunc.RResult) autofunc.RResult {
+	return g.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (g *GlobalAveragePoolingLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	return g.poolingLayer().Batch(in, n)
+}
+
+// BatchR is like Batch, but for RResults.
+func (g *GlobalAveragePoolingLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	return g.poolingLayer().BatchR(rv, in, n)
+}
+
+// Serialize serializes the layer.
+func (g *GlobalAveragePoolingLayer) Serialize() ([]byte, error) {
+	return json.Marshal(g)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (g *GlobalAveragePoolingLayer) SerializerType() string {
+	return serializerTypeGlobalAveragePoolingLayer
+}
+
+func (g *GlobalAveragePoolingLayer) poolingLayer() *AveragePoolingLayer {
+	return &AveragePoolingLayer{
+		XSpan:       g.InputWidth,
+		YSpan:       g.InputHeight,
+		InputWidth:  g.InputWidth,
+		InputHeight: g.InputHeight,
+		InputDepth:  g.InputDepth,
+	}
+}
+
+// A GlobalMaxPoolingLayer collapses each depth layer of
+// an input tensor into a single value by taking the
+// maximum value in that depth layer.
+//
+// The output is a vector with InputDepth components.
+type GlobalMaxPoolingLayer struct {
+	// InputWidth indicates the width of the
+	// layer's input tensor.
+	InputWidth int
+
+	// InputHeight indicates the height of the
+	// layer's input tensor.
+	InputHeight int
+
+	// InputDepth indicates the depth of the
+	// layer's input tensor.
+	InputDepth int
+}
+
+// DeserializeGlobalMaxPoolingLayer deserializes a
+// GlobalMaxPoolingLayer.
+func DeserializeGlobalMaxPoolingLayer(d []byte) (*GlobalMaxPoolingLayer, error) {
+	var res GlobalMaxPoolingLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Apply applies the layer to an input, which is treated
+// as a tensor.
+func (g *GlobalMaxPoolingLayer) Apply(in autofunc.Result) autofunc.Result {
+	return g.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (g *GlobalMaxPoolingLayer) ApplyR(rv autofunc.RVector,
+	in autofunc.RResult) autofunc.RResult {
+	return g.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (g *GlobalMaxPoolingLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	return g.poolingLayer().Batch(in, n)
+}
+
+// BatchR is like Batch, but for RResults.
+func (g *GlobalMaxPoolingLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	return g.poolingLayer().BatchR(rv, in, n)
+}
+
+// Serialize serializes the layer.
+func (g *GlobalMaxPoolingLayer) Serialize() ([]byte, error) {
+	return json.Marshal(g)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (g *GlobalMaxPoolingLayer) SerializerType() string {
+	return serializerTypeGlobalMaxPoolingLayer
+}
+
+func (g *GlobalMaxPoolingLayer) poolingLayer() *MaxPoolingLayer {
+	return &MaxPoolingLayer{
+		XSpan:       g.InputWidth,
+		YSpan:       g.InputHeight,
+		InputWidth:  g.InputWidth,
+		InputHeight: g.InputHeight,
+		InputDepth:  g.InputDepth,
+	}
+}
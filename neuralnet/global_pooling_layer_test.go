@@ -0,0 +1,112 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestGlobalPoolingForward(t *testing.T) {
+	input := []float64{
+		1, -2, 3, 4, 5, -6,
+		7, 8, -9, 10, 11, 12,
+	}
+	avgLayer := &GlobalAveragePoolingLayer{3, 2, 2}
+	maxLayer := &GlobalMaxPoolingLayer{3, 2, 2}
+	expected := [][]float64{
+		{(1 + 3 + 5 + 7 - 9 + 11) / 6.0, (-2 + 4 - 6 + 8 + 10 + 12) / 6.0},
+		{11, 12},
+	}
+	for i, layer := range []autofunc.Func{avgLayer, maxLayer} {
+		actual := layer.Apply(&autofunc.Variable{Vector: input}).Output()
+		if len(actual) != len(expected[i]) {
+			t.Errorf("layer %d: expected %d outputs but got %d", i, len(expected[i]),
+				len(actual))
+			continue
+		}
+		for j, x := range expected[i] {
+			if math.Abs(actual[j]-x) > 1e-5 {
+				t.Errorf("layer %d: output %d should be %f but got %f", i, j, x, actual[j])
+			}
+		}
+	}
+}
+
+func TestGlobalPoolingRProp(t *testing.T) {
+	layers := []autofunc.RFunc{
+		&GlobalAveragePoolingLayer{5, 4, 3},
+		&GlobalMaxPoolingLayer{5, 4, 3},
+	}
+	for _, layer := range layers {
+		inputVar := &autofunc.Variable{Vector: make(linalg.Vector, 5*4*3)}
+		rVector := autofunc.RVector{inputVar: make(linalg.Vector, 5*4*3)}
+		for i := range inputVar.Vector {
+			inputVar.Vector[i] = rand.Float64()*2 - 1
+			rVector[inputVar][i] = rand.Float64()*2 - 1
+		}
+		funcTest := &functest.RFuncChecker{
+			F:     layer,
+			Vars:  []*autofunc.Variable{inputVar},
+			Input: inputVar,
+			RV:    rVector,
+		}
+		funcTest.FullCheck(t)
+	}
+}
+
+func TestGlobalPoolingBatch(t *testing.T) {
+	layers := []batchFuncR{
+		&GlobalAveragePoolingLayer{7, 6, 3},
+		&GlobalMaxPoolingLayer{7, 6, 3},
+	}
+	for _, layer := range layers {
+		n := 3
+		batchRes := &autofunc.Variable{Vector: make(linalg.Vector, n*7*6*3)}
+		rVec := autofunc.RVector{batchRes: make(linalg.Vector, len(batchRes.Vector))}
+		for i := range batchRes.Vector {
+			batchRes.Vector[i] = rand.NormFloat64()
+			rVec[batchRes][i] = rand.NormFloat64()
+		}
+		testBatcher(t, layer, batchRes, n, []*autofunc.Variable{batchRes})
+		testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec),
+			n, []*autofunc.Variable{batchRes})
+	}
+}
+
+func TestGlobalPoolingSerialize(t *testing.T) {
+	layers := []serializer.Serializer{
+		&GlobalAveragePoolingLayer{3, 4, 5},
+		&GlobalMaxPoolingLayer{3, 4, 5},
+	}
+	for _, layer := range layers {
+		encoded, err := layer.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := serializer.GetDeserializer(layer.SerializerType())(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch layer := layer.(type) {
+		case *GlobalAveragePoolingLayer:
+			newLayer, ok := decoded.(*GlobalAveragePoolingLayer)
+			if !ok {
+				t.Errorf("expected *GlobalAveragePoolingLayer but got %T", decoded)
+			} else if *newLayer != *layer {
+				t.Errorf("expected %v but got %v", *layer, *newLayer)
+			}
+		case *GlobalMaxPoolingLayer:
+			newLayer, ok := decoded.(*GlobalMaxPoolingLayer)
+			if !ok {
+				t.Errorf("expected *GlobalMaxPoolingLayer but got %T", decoded)
+			} else if *newLayer != *layer {
+				t.Errorf("expected %v but got %v", *layer, *newLayer)
+			}
+		}
+	}
+}
@@ -38,6 +38,10 @@ type GradHelper struct {
 	// caches gradients and assumes static parameters.
 	Learner sgd.Learner
 
+	// Processor post-processes every gradient before it
+	// is returned, e.g. to clip it.
+	Processor GradProcessor
+
 	CompGrad  func(g autofunc.Gradient, s sgd.SampleSet)
 	CompRGrad func(rv autofunc.RVector, rg autofunc.RGradient,
 		g autofunc.Gradient, s sgd.SampleSet)
@@ -73,6 +77,7 @@ func (g *GradHelper) batch(rv autofunc.RVector, s sgd.SampleSet) (grad autofunc.
 	} else {
 		grad, rgrad = g.runAsync(rv, s)
 	}
+	g.Processor.Process(grad, rgrad)
 	g.lastGradResult = grad
 	g.lastRGradResult = rgrad
 	return
@@ -0,0 +1,109 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+)
+
+// A GradProcessor post-processes gradients before they
+// are returned by a gradienter.
+// It can clip gradients, which helps to prevent exploding
+// gradients in RNNs, and add noise to them.
+//
+// The zero value of GradProcessor leaves gradients
+// unchanged.
+//
+// The steps are performed in the order that the fields
+// are listed: first ClipValue, then ClipVarNorm, then
+// ClipNorm, and finally Noise.
+//
+// When an R-gradient is computed along with a gradient,
+// the R-gradient is clipped along with the gradient, as
+// if the clipping thresholds and scales were constants.
+// Noise is never added to R-gradients.
+type GradProcessor struct {
+	// NormFunc, if non-nil, is called with the L2 norm of
+	// every gradient before it is processed.
+	// This can be used to log gradient norms.
+	NormFunc func(norm float64)
+
+	// ClipValue, if non-zero, is the maximum absolute
+	// value of any gradient component.
+	ClipValue float64
+
+	// ClipVarNorm, if non-zero, is the maximum L2 norm of
+	// the gradient for any single variable.
+	// Variables with larger gradients have their gradients
+	// scaled down.
+	ClipVarNorm float64
+
+	// ClipNorm, if non-zero, is the maximum L2 norm of the
+	// entire gradient.
+	// Larger gradients are scaled down.
+	ClipNorm float64
+
+	// Noise, if non-zero, is the standard deviation of
+	// Gaussian noise to add to each gradient component.
+	// It can be decreased over the course of training to
+	// anneal the noise.
+	Noise float64
+}
+
+// Process processes a gradient and its corresponding
+// R-gradient in place.
+// The R-gradient may be nil.
+func (g *GradProcessor) Process(grad autofunc.Gradient, rgrad autofunc.RGradient) {
+	if g.NormFunc != nil {
+		g.NormFunc(gradNorm(grad))
+	}
+	if g.ClipValue != 0 {
+		for variable, vec := range grad {
+			rvec := rgrad[variable]
+			for i, x := range vec {
+				if math.Abs(x) > g.ClipValue {
+					vec[i] = math.Copysign(g.ClipValue, x)
+					if rvec != nil {
+						rvec[i] = 0
+					}
+				}
+			}
+		}
+	}
+	if g.ClipVarNorm != 0 {
+		for variable, vec := range grad {
+			if norm := vec.Dot(vec); norm > g.ClipVarNorm*g.ClipVarNorm {
+				scale := g.ClipVarNorm / math.Sqrt(norm)
+				vec.Scale(scale)
+				if rvec := rgrad[variable]; rvec != nil {
+					rvec.Scale(scale)
+				}
+			}
+		}
+	}
+	if g.ClipNorm != 0 {
+		if norm := gradNorm(grad); norm > g.ClipNorm {
+			scale := g.ClipNorm / norm
+			grad.Scale(scale)
+			if rgrad != nil {
+				rgrad.Scale(scale)
+			}
+		}
+	}
+	if g.Noise != 0 {
+		for _, vec := range grad {
+			for i := range vec {
+				vec[i] += rand.NormFloat64() * g.Noise
+			}
+		}
+	}
+}
+
+func gradNorm(g autofunc.Gradient) float64 {
+	var sum float64
+	for _, vec := range g {
+		sum += vec.Dot(vec)
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,122 @@
+package neuralnet
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestGradProcessorClipping(t *testing.T) {
+	v1 := &autofunc.Variable{Vector: linalg.Vector{0, 0}}
+	v2 := &autofunc.Variable{Vector: linalg.Vector{0}}
+	makeGrads := func() (autofunc.Gradient, autofunc.RGradient) {
+		return autofunc.Gradient{v1: linalg.Vector{3, -4}, v2: linalg.Vector{12}},
+			autofunc.RGradient{v1: linalg.Vector{1, 1}, v2: linalg.Vector{2}}
+	}
+	processors := []*GradProcessor{
+		{},
+		{ClipValue: 3.5},
+		{ClipVarNorm: 2.5},
+		{ClipNorm: 6.5},
+		{ClipValue: 5, ClipNorm: 5},
+	}
+	// After value clipping, the gradient is (3, -4, 5).
+	scale := 5 / math.Sqrt(50)
+	expected := []map[*autofunc.Variable][2]linalg.Vector{
+		{v1: {{3, -4}, {1, 1}}, v2: {{12}, {2}}},
+		{v1: {{3, -3.5}, {1, 0}}, v2: {{3.5}, {0}}},
+		{v1: {{1.5, -2}, {0.5, 0.5}}, v2: {{2.5}, {5.0 / 12}}},
+		{v1: {{1.5, -2}, {0.5, 0.5}}, v2: {{6}, {1}}},
+		{v1: {{3 * scale, -4 * scale}, {scale, scale}}, v2: {{5 * scale}, {0}}},
+	}
+	for i, processor := range processors {
+		var reportedNorm float64
+		processor.NormFunc = func(n float64) {
+			reportedNorm = n
+		}
+		grad, rgrad := makeGrads()
+		processor.Process(grad, rgrad)
+		if math.Abs(reportedNorm-13) > 1e-8 {
+			t.Errorf("processor %d: expected norm 13 but got %f", i, reportedNorm)
+		}
+		for variable, vecs := range expected[i] {
+			for j, x := range vecs[0] {
+				if math.Abs(grad[variable][j]-x) > 1e-8 {
+					t.Errorf("processor %d: expected gradient %v but got %v", i,
+						vecs[0], grad[variable])
+					break
+				}
+			}
+			for j, x := range vecs[1] {
+				if math.Abs(rgrad[variable][j]-x) > 1e-8 {
+					t.Errorf("processor %d: expected r-gradient %v but got %v", i,
+						vecs[1], rgrad[variable])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestGradProcessorNoise(t *testing.T) {
+	v := &autofunc.Variable{Vector: make(linalg.Vector, 10000)}
+	grad := autofunc.Gradient{v: make(linalg.Vector, len(v.Vector))}
+	rgrad := autofunc.RGradient{v: make(linalg.Vector, len(v.Vector))}
+	(&GradProcessor{Noise: 2}).Process(grad, rgrad)
+	stddev := math.Sqrt(grad[v].Dot(grad[v]) / float64(len(v.Vector)))
+	if math.Abs(stddev-2) > 0.1 {
+		t.Errorf("expected standard deviation 2 but got %f", stddev)
+	}
+	if rgrad[v].MaxAbs() != 0 {
+		t.Error("noise should not be added to the r-gradient")
+	}
+}
+
+func TestBatchRGradienterClipping(t *testing.T) {
+	net := Network{
+		&DenseLayer{InputCount: 3, OutputCount: 4},
+		&Sigmoid{},
+		&DenseLayer{InputCount: 4, OutputCount: 2},
+	}
+	net.Randomize()
+	var inputs, outputs []linalg.Vector
+	for i := 0; i < 10; i++ {
+		inputs = append(inputs, linalg.RandVector(3))
+		outputs = append(outputs, linalg.RandVector(2).Scale(10))
+	}
+	samples := VectorSampleSet(inputs, outputs)
+
+	unclipped := (&BatchRGradienter{
+		Learner:  net.BatchLearner(),
+		CostFunc: MeanSquaredCost{},
+	}).Gradient(samples)
+	expectedNorm := gradNorm(unclipped)
+
+	var reportedNorm float64
+	gradienter := &BatchRGradienter{
+		Learner:       net.BatchLearner(),
+		CostFunc:      MeanSquaredCost{},
+		MaxGoroutines: 2,
+		MaxBatchSize:  3,
+		Processor: GradProcessor{
+			ClipNorm: expectedNorm / 2,
+			NormFunc: func(n float64) {
+				reportedNorm = n
+			},
+		},
+	}
+	clipped := gradienter.Gradient(samples)
+	if math.Abs(reportedNorm-expectedNorm) > 1e-8 {
+		t.Errorf("expected norm %f but got %f", expectedNorm, reportedNorm)
+	}
+	for variable, vec := range unclipped {
+		for i, x := range vec {
+			if math.Abs(clipped[variable][i]-x/2) > 1e-8 {
+				t.Fatalf("expected clipped gradient %v but got %v",
+					vec.Copy().Scale(0.5), clipped[variable])
+			}
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const defaultLayerNormEpsilon = 1e-5
+
+// LayerNormLayer implements layer normalization, as
+// described in https://arxiv.org/abs/1607.06450.
+//
+// Inputs are treated as rows of InputCount features,
+// and every row is normalized to have a mean of 0 and
+// a variance of 1 before the learned gains and biases
+// are applied.
+// Unlike a BatchNormLayer, a LayerNormLayer does not
+// depend on any other samples, so it behaves the same
+// way during training and usage, and it can be used
+// one timestep at a time inside an RNN.
+type LayerNormLayer struct {
+	// InputCount is the number of features in each
+	// normalized row.
+	InputCount int
+
+	// Gains and Biases are the learned affine
+	// transformation applied after normalization.
+	Gains  *autofunc.Variable
+	Biases *autofunc.Variable
+
+	// Epsilon is added to every variance to avoid
+	// dividing by zero.
+	// If this is 0, a reasonable default is used.
+	Epsilon float64
+}
+
+// NewLayerNormLayer creates a LayerNormLayer with the
+// given number of features.
+func NewLayerNormLayer(inCount int) *LayerNormLayer {
+	res := &LayerNormLayer{InputCount: inCount}
+	res.Randomize()
+	return res
+}
+
+// DeserializeLayerNormLayer deserializes a
+// LayerNormLayer.
+func DeserializeLayerNormLayer(d []byte) (*LayerNormLayer, error) {
+	var res LayerNormLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Randomize sets the gains to 1 and the biases to 0.
+//
+// This will allocate l.Gains and l.Biases if they are
+// nil.
+func (l *LayerNormLayer) Randomize() {
+	if l.Gains == nil {
+		l.Gains = &autofunc.Variable{Vector: make(linalg.Vector, l.InputCount)}
+	}
+	if l.Biases == nil {
+		l.Biases = &autofunc.Variable{Vector: make(linalg.Vector, l.InputCount)}
+	}
+	for i := 0; i < l.InputCount; i++ {
+		l.Gains.Vector[i] = 1
+		l.Biases.Vector[i] = 0
+	}
+}
+
+// Parameters returns a slice containing the gain
+// variable followed by the bias variable.
+func (l *LayerNormLayer) Parameters() []*autofunc.Variable {
+	if l.Gains == nil || l.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{l.Gains, l.Biases}
+}
+
+// Apply normalizes every row of the input.
+func (l *LayerNormLayer) Apply(in autofunc.Result) autofunc.Result {
+	return l.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (l *LayerNormLayer) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return l.BatchR(v, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+// Since every row is normalized independently, this is
+// equivalent to applying the layer to each input.
+func (l *LayerNormLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	if l.Gains == nil || l.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	stats := l.normalize(in.Output())
+	res := &layerNormResult{
+		OutputVec: make(linalg.Vector, len(stats.Normalized)),
+		Input:     in,
+		Stats:     stats,
+		Layer:     l,
+	}
+	for i, x := range stats.Normalized {
+		j := i % l.InputCount
+		res.OutputVec[i] = x*l.Gains.Vector[j] + l.Biases.Vector[j]
+	}
+	return res
+}
+
+// BatchR is like Batch, but for RResults.
+func (l *LayerNormLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	if l.Gains == nil || l.Biases == nil {
+		panic(uninitPanicMessage)
+	}
+	stats := l.normalizeR(in.Output(), in.ROutput())
+	res := &layerNormRResult{
+		OutputVec:  make(linalg.Vector, len(stats.Normalized)),
+		ROutputVec: make(linalg.Vector, len(stats.Normalized)),
+		Input:      in,
+		Stats:      stats,
+		GainsR:     rv[l.Gains],
+		BiasesR:    rv[l.Biases],
+		Layer:      l,
+	}
+	for i, x := range stats.Normalized {
+		j := i % l.InputCount
+		res.OutputVec[i] = x*l.Gains.Vector[j] + l.Biases.Vector[j]
+		res.ROutputVec[i] = stats.RNormalized[i] * l.Gains.Vector[j]
+		if res.GainsR != nil {
+			res.ROutputVec[i] += x * res.GainsR[j]
+		}
+		if res.BiasesR != nil {
+			res.ROutputVec[i] += res.BiasesR[j]
+		}
+	}
+	return res
+}
+
+// Serialize serializes the layer.
+func (l *LayerNormLayer) Serialize() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (l *LayerNormLayer) SerializerType() string {
+	return serializerTypeLayerNormLayer
+}
+
+func (l *LayerNormLayer) normalize(in linalg.Vector) *layerNormStats {
+	if len(in)%l.InputCount != 0 {
+		panic("invalid input size")
+	}
+	rows := len(in) / l.InputCount
+	res := &layerNormStats{
+		Cols:       l.InputCount,
+		Centered:   make(linalg.Vector, len(in)),
+		Normalized: make(linalg.Vector, len(in)),
+		InvStd:     make(linalg.Vector, rows),
+	}
+
+	eps := l.Epsilon
+	if eps == 0 {
+		eps = defaultLayerNormEpsilon
+	}
+	cols := float64(l.InputCount)
+	for row := 0; row < rows; row++ {
+		start := row * l.InputCount
+		rowVec := in[start : start+l.InputCount]
+		var mean float64
+		for _, x := range rowVec {
+			mean += x
+		}
+		mean /= cols
+		var variance float64
+		for i, x := range rowVec {
+			res.Centered[start+i] = x - mean
+			variance += (x - mean) * (x - mean)
+		}
+		variance /= cols
+		res.InvStd[row] = 1 / math.Sqrt(variance+eps)
+		for i := start; i < start+l.InputCount; i++ {
+			res.Normalized[i] = res.Centered[i] * res.InvStd[row]
+		}
+	}
+	return res
+}
+
+func (l *LayerNormLayer) normalizeR(in, inR linalg.Vector) *layerNormStats {
+	res := l.normalize(in)
+	res.RNormalized = make(linalg.Vector, len(in))
+	res.InvStdR = make(linalg.Vector, len(res.InvStd))
+
+	cols := float64(l.InputCount)
+	for row, s := range res.InvStd {
+		start := row * l.InputCount
+		var meanR float64
+		for _, x := range inR[start : start+l.InputCount] {
+			meanR += x
+		}
+		meanR /= cols
+		var varianceR float64
+		for i := start; i < start+l.InputCount; i++ {
+			varianceR += res.Centered[i] * (inR[i] - meanR)
+		}
+		res.InvStdR[row] = -s * s * s * varianceR / cols
+		for i := start; i < start+l.InputCount; i++ {
+			res.RNormalized[i] = (inR[i]-meanR)*s + res.Centered[i]*res.InvStdR[row]
+		}
+	}
+	return res
+}
+
+// layerNormStats stores the intermediate values of a
+// normalization so that they can be used during
+// back-propagation.
+type layerNormStats struct {
+	Cols       int
+	InvStd     linalg.Vector
+	Centered   linalg.Vector
+	Normalized linalg.Vector
+
+	// These are only set for R-operator results.
+	InvStdR     linalg.Vector
+	RNormalized linalg.Vector
+}
+
+// propagate computes the gradient with respect to the
+// input given the gradient with respect to Normalized.
+func (l *layerNormStats) propagate(normGrad linalg.Vector) linalg.Vector {
+	res := make(linalg.Vector, len(normGrad))
+	sums, dots := l.gradientSums(normGrad, l.Normalized)
+	cols := float64(l.Cols)
+	for i, x := range normGrad {
+		row := i / l.Cols
+		res[i] = l.InvStd[row] * (x - (sums[row]+l.Normalized[i]*dots[row])/cols)
+	}
+	return res
+}
+
+// propagateR is like propagate, but it also computes
+// the R-derivative of the input gradient.
+func (l *layerNormStats) propagateR(normGrad, normGradR linalg.Vector) (grad,
+	gradR linalg.Vector) {
+	grad = make(linalg.Vector, len(normGrad))
+	gradR = make(linalg.Vector, len(normGrad))
+
+	sums, dots := l.gradientSums(normGrad, l.Normalized)
+	sumsR, dotsR := l.gradientSums(normGradR, l.Normalized)
+	_, extraDotsR := l.gradientSums(normGrad, l.RNormalized)
+	dotsR.Add(extraDotsR)
+
+	cols := float64(l.Cols)
+	for i, x := range normGrad {
+		row := i / l.Cols
+		inner := x - (sums[row]+l.Normalized[i]*dots[row])/cols
+		innerR := normGradR[i] - (sumsR[row]+l.RNormalized[i]*dots[row]+
+			l.Normalized[i]*dotsR[row])/cols
+		grad[i] = l.InvStd[row] * inner
+		gradR[i] = l.InvStdR[row]*inner + l.InvStd[row]*innerR
+	}
+	return
+}
+
+// gradientSums computes the per-row sums of vec and the
+// per-row dot products of vec and other.
+func (l *layerNormStats) gradientSums(vec, other linalg.Vector) (sums, dots linalg.Vector) {
+	sums = make(linalg.Vector, len(l.InvStd))
+	dots = make(linalg.Vector, len(l.InvStd))
+	for i, x := range vec {
+		sums[i/l.Cols] += x
+		dots[i/l.Cols] += x * other[i]
+	}
+	return
+}
+
+type layerNormResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	Stats     *layerNormStats
+	Layer     *LayerNormLayer
+}
+
+func (l *layerNormResult) Output() linalg.Vector {
+	return l.OutputVec
+}
+
+func (l *layerNormResult) Constant(g autofunc.Gradient) bool {
+	return l.Input.Constant(g) && l.Layer.Gains.Constant(g) &&
+		l.Layer.Biases.Constant(g)
+}
+
+func (l *layerNormResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	cols := l.Layer.InputCount
+	if gainGrad, ok := grad[l.Layer.Gains]; ok {
+		for i, x := range upstream {
+			gainGrad[i%cols] += x * l.Stats.Normalized[i]
+		}
+	}
+	if biasGrad, ok := grad[l.Layer.Biases]; ok {
+		for i, x := range upstream {
+			biasGrad[i%cols] += x
+		}
+	}
+	if !l.Input.Constant(grad) {
+		normGrad := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			normGrad[i] = x * l.Layer.Gains.Vector[i%cols]
+		}
+		l.Input.PropagateGradient(l.Stats.propagate(normGrad), grad)
+	}
+}
+
+type layerNormRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	Stats      *layerNormStats
+	GainsR     linalg.Vector
+	BiasesR    linalg.Vector
+	Layer      *LayerNormLayer
+}
+
+func (l *layerNormRResult) Output() linalg.Vector {
+	return l.OutputVec
+}
+
+func (l *layerNormRResult) ROutput() linalg.Vector {
+	return l.ROutputVec
+}
+
+func (l *layerNormRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	for _, v := range []*autofunc.Variable{l.Layer.Gains, l.Layer.Biases} {
+		if !v.Constant(g) {
+			return false
+		} else if _, ok := rg[v]; ok {
+			return false
+		}
+	}
+	return l.Input.Constant(rg, g)
+}
+
+func (l *layerNormRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	cols := l.Layer.InputCount
+	if gainGrad, ok := grad[l.Layer.Gains]; ok {
+		for i, x := range upstream {
+			gainGrad[i%cols] += x * l.Stats.Normalized[i]
+		}
+	}
+	if gainGradR, ok := rgrad[l.Layer.Gains]; ok {
+		for i, x := range upstreamR {
+			gainGradR[i%cols] += x*l.Stats.Normalized[i] +
+				upstream[i]*l.Stats.RNormalized[i]
+		}
+	}
+	if biasGrad, ok := grad[l.Layer.Biases]; ok {
+		for i, x := range upstream {
+			biasGrad[i%cols] += x
+		}
+	}
+	if biasGradR, ok := rgrad[l.Layer.Biases]; ok {
+		for i, x := range upstreamR {
+			biasGradR[i%cols] += x
+		}
+	}
+	if !l.Input.Constant(rgrad, grad) {
+		normGrad := make(linalg.Vector, len(upstream))
+		normGradR := make(linalg.Vector, len(upstream))
+		for i, x := range upstream {
+			j := i % cols
+			normGrad[i] = x * l.Layer.Gains.Vector[j]
+			normGradR[i] = upstreamR[i] * l.Layer.Gains.Vector[j]
+			if l.GainsR != nil {
+				normGradR[i] += x * l.GainsR[j]
+			}
+		}
+		inGrad, inGradR := l.Stats.propagateR(normGrad, normGradR)
+		l.Input.PropagateRGradient(inGrad, inGradR, rgrad, grad)
+	}
+}
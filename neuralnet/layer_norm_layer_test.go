@@ -0,0 +1,119 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestLayerNormOutput(t *testing.T) {
+	layer := NewLayerNormLayer(5)
+	input := &autofunc.Variable{Vector: make(linalg.Vector, 5*3)}
+	for i := range input.Vector {
+		input.Vector[i] = rand.NormFloat64()*float64(i/5+1) + float64(i/5)
+	}
+	output := layer.Apply(input).Output()
+	for row := 0; row < 3; row++ {
+		var mean, variance float64
+		for _, x := range output[row*5 : (row+1)*5] {
+			mean += x
+			variance += x * x
+		}
+		mean /= 5
+		variance = variance/5 - mean*mean
+		if math.Abs(mean) > 1e-5 || math.Abs(variance-1) > 1e-3 {
+			t.Errorf("row %d: bad mean %f or variance %f", row, mean, variance)
+		}
+	}
+}
+
+func TestLayerNormRProp(t *testing.T) {
+	layer := NewLayerNormLayer(4)
+	for i := range layer.Gains.Vector {
+		layer.Gains.Vector[i] = rand.NormFloat64()
+		layer.Biases.Vector[i] = rand.NormFloat64()
+	}
+
+	inVar := &autofunc.Variable{Vector: make(linalg.Vector, 4*3)}
+	for i := range inVar.Vector {
+		inVar.Vector[i] = rand.NormFloat64()
+	}
+
+	variables := append(layer.Parameters(), inVar)
+	rVector := autofunc.RVector{}
+	for _, variable := range variables {
+		rVector[variable] = make(linalg.Vector, len(variable.Vector))
+		for i := range rVector[variable] {
+			rVector[variable][i] = rand.Float64()*2 - 1
+		}
+	}
+	funcTest := &functest.RFuncChecker{
+		F:     layer,
+		Vars:  variables,
+		Input: inVar,
+		RV:    rVector,
+	}
+	funcTest.FullCheck(t)
+}
+
+func TestLayerNormBatch(t *testing.T) {
+	layer := NewLayerNormLayer(4)
+	for i := range layer.Gains.Vector {
+		layer.Gains.Vector[i] = rand.NormFloat64()
+		layer.Biases.Vector[i] = rand.NormFloat64()
+	}
+
+	n := 3
+	batchRes := &autofunc.Variable{Vector: make(linalg.Vector, n*4*2)}
+	for i := range batchRes.Vector {
+		batchRes.Vector[i] = rand.NormFloat64()
+	}
+	params := []*autofunc.Variable{batchRes, layer.Gains, layer.Biases}
+
+	rVec := autofunc.RVector{}
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+		rVec[param] = vec
+	}
+
+	testBatcher(t, layer, batchRes, n, params)
+	testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec), n, params)
+}
+
+func TestLayerNormSerialize(t *testing.T) {
+	layer := NewLayerNormLayer(3)
+	layer.Epsilon = 1e-3
+	for i := range layer.Gains.Vector {
+		layer.Gains.Vector[i] = rand.NormFloat64()
+		layer.Biases.Vector[i] = rand.NormFloat64()
+	}
+
+	encoded, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*LayerNormLayer)
+	if !ok {
+		t.Fatalf("expected *LayerNormLayer but got %T", decoded)
+	}
+	if newLayer.InputCount != layer.InputCount || newLayer.Epsilon != layer.Epsilon {
+		t.Fatalf("expected %v but got %v", layer, newLayer)
+	}
+	for i, x := range layer.Gains.Vector {
+		if newLayer.Gains.Vector[i] != x || newLayer.Biases.Vector[i] != layer.Biases.Vector[i] {
+			t.Errorf("parameters for feature %d were not preserved", i)
+		}
+	}
+}
@@ -13,6 +13,8 @@
 // Both packages depend on the sgd.Gradienter interface,
 // which is implemented by BatchRGradienter and
 // SingleRGradienter.
+// The training sub-package provides step rules, such as
+// momentum and Adam, which work with any sgd.Gradienter.
 //
 // Here is how you could train a simple neural network:
 //
@@ -0,0 +1,256 @@
+// Package neuralnettest provides utilities for testing
+// neuralnet Layers.
+package neuralnettest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// A LayerChecker performs gradient checking and other
+// consistency checks on a Layer.
+type LayerChecker struct {
+	// L is the Layer to test.
+	L neuralnet.Layer
+
+	// Batcher is the batched version of L.
+	// If it is nil, batch checks are skipped.
+	Batcher autofunc.RBatcher
+
+	// Input is the list of input samples to use.
+	// Single-sample checks use the first input, and batch
+	// checks use all of the inputs at once.
+	Input []*autofunc.Variable
+
+	// Params is the list of parameters whose gradients
+	// should be checked.
+	Params []*autofunc.Variable
+
+	// RV stores the first derivatives of the inputs and
+	// parameters.
+	RV autofunc.RVector
+
+	// Delta is the delta used for gradient approximation.
+	// If it is 0, functest.DefaultDelta is used.
+	Delta float64
+
+	// Prec is the precision to use when comparing values.
+	// If it is 0, functest.DefaultPrec is used.
+	Prec float64
+}
+
+// NewChecker creates a LayerChecker which feeds a layer
+// random inputs with the given number of values each.
+//
+// If l is an sgd.Learner, its parameters are checked.
+// If l is an autofunc.RBatcher or a neuralnet.Network, the
+// batch checks are enabled.
+func NewChecker(l neuralnet.Layer, inputSize, batchSize int) *LayerChecker {
+	res := &LayerChecker{
+		L:  l,
+		RV: autofunc.RVector{},
+	}
+	switch l := l.(type) {
+	case neuralnet.Network:
+		res.Batcher = l.BatchLearner()
+	case autofunc.RBatcher:
+		res.Batcher = l
+	}
+	if learner, ok := l.(sgd.Learner); ok {
+		res.Params = learner.Parameters()
+	}
+	for i := 0; i < batchSize; i++ {
+		res.Input = append(res.Input, &autofunc.Variable{Vector: randVector(inputSize)})
+	}
+	for _, v := range append(append([]*autofunc.Variable{}, res.Input...), res.Params...) {
+		res.RV[v] = randVector(len(v.Vector))
+	}
+	return res
+}
+
+// FullCheck performs gradient checking on Apply and
+// ApplyR (and on Batch and BatchR if possible), checks
+// that batches match individual samples, and checks
+// that the layer survives serialization.
+func (l *LayerChecker) FullCheck(t *testing.T) {
+	t.Run("Apply", func(t *testing.T) {
+		checker := &functest.RFuncChecker{
+			F:     l.L,
+			Vars:  append([]*autofunc.Variable{l.Input[0]}, l.Params...),
+			Input: l.Input[0],
+			RV:    l.RV,
+			Delta: l.Delta,
+			Prec:  l.Prec,
+		}
+		checker.FullCheck(t)
+	})
+	if l.Batcher != nil {
+		t.Run("Batch", func(t *testing.T) {
+			joined, rv := l.joinedInput()
+			checker := &functest.RFuncChecker{
+				F:     &batchFunc{B: l.Batcher, N: len(l.Input)},
+				Vars:  append([]*autofunc.Variable{joined}, l.Params...),
+				Input: joined,
+				RV:    rv,
+				Delta: l.Delta,
+				Prec:  l.Prec,
+			}
+			checker.FullCheck(t)
+		})
+		t.Run("Batch Consistency", l.testBatchConsistency)
+	}
+	t.Run("Serialize", l.testSerialize)
+}
+
+func (l *LayerChecker) testBatchConsistency(t *testing.T) {
+	joined, rv := l.joinedInput()
+	batchOut := l.Batcher.BatchR(rv, autofunc.NewRVariable(joined, rv), len(l.Input))
+
+	var expected, expectedR linalg.Vector
+	for _, in := range l.Input {
+		out := l.L.ApplyR(l.RV, autofunc.NewRVariable(in, l.RV))
+		expected = append(expected, out.Output()...)
+		expectedR = append(expectedR, out.ROutput()...)
+	}
+	if !l.vecsEqual(batchOut.Output(), expected) {
+		t.Errorf("batch output should be %v but got %v", expected, batchOut.Output())
+	}
+	if !l.vecsEqual(batchOut.ROutput(), expectedR) {
+		t.Errorf("batch r-output should be %v but got %v", expectedR, batchOut.ROutput())
+	}
+
+	upstream := randVector(len(expected))
+	batchGrad := autofunc.NewGradient(append([]*autofunc.Variable{joined}, l.Params...))
+	l.Batcher.Batch(joined, len(l.Input)).PropagateGradient(upstream.Copy(), batchGrad)
+
+	grad := autofunc.NewGradient(append(append([]*autofunc.Variable{}, l.Input...),
+		l.Params...))
+	var offset int
+	for _, in := range l.Input {
+		out := l.L.Apply(in)
+		size := len(out.Output())
+		out.PropagateGradient(upstream[offset:offset+size].Copy(), grad)
+		offset += size
+	}
+
+	var expectedInGrad linalg.Vector
+	for _, in := range l.Input {
+		expectedInGrad = append(expectedInGrad, grad[in]...)
+	}
+	if !l.vecsEqual(batchGrad[joined], expectedInGrad) {
+		t.Errorf("batch input gradient should be %v but got %v", expectedInGrad,
+			batchGrad[joined])
+	}
+	for i, param := range l.Params {
+		if !l.vecsEqual(batchGrad[param], grad[param]) {
+			t.Errorf("batch gradient for param %d should be %v but got %v", i,
+				grad[param], batchGrad[param])
+		}
+	}
+}
+
+func (l *LayerChecker) testSerialize(t *testing.T) {
+	data, err := serializer.SerializeWithType(l.L)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.DeserializeWithType(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(neuralnet.Layer)
+	if !ok {
+		t.Fatalf("expected a Layer but got %T", decoded)
+	}
+	if learner, ok := newLayer.(sgd.Learner); ok {
+		newParams := learner.Parameters()
+		if len(newParams) != len(l.Params) {
+			t.Fatalf("expected %d parameters but got %d", len(l.Params), len(newParams))
+		}
+		for i, param := range l.Params {
+			if !l.vecsEqual(newParams[i].Vector, param.Vector) {
+				t.Errorf("parameter %d should be %v but got %v", i, param.Vector,
+					newParams[i].Vector)
+			}
+		}
+	} else if len(l.Params) != 0 {
+		t.Errorf("decoded layer %T has no parameters", newLayer)
+	}
+	for i, in := range l.Input {
+		expected := l.L.Apply(in).Output()
+		actual := newLayer.Apply(in).Output()
+		if !l.vecsEqual(actual, expected) {
+			t.Errorf("output %d should be %v but got %v", i, expected, actual)
+		}
+	}
+}
+
+// joinedInput concatenates the inputs into a single
+// variable and creates an RVector for it.
+func (l *LayerChecker) joinedInput() (*autofunc.Variable, autofunc.RVector) {
+	joined := &autofunc.Variable{}
+	var joinedR linalg.Vector
+	for _, in := range l.Input {
+		joined.Vector = append(joined.Vector, in.Vector...)
+		if r, ok := l.RV[in]; ok {
+			joinedR = append(joinedR, r...)
+		} else {
+			joinedR = append(joinedR, make(linalg.Vector, len(in.Vector))...)
+		}
+	}
+	rv := autofunc.RVector{joined: joinedR}
+	for _, param := range l.Params {
+		if r, ok := l.RV[param]; ok {
+			rv[param] = r
+		}
+	}
+	return joined, rv
+}
+
+func (l *LayerChecker) vecsEqual(v1, v2 linalg.Vector) bool {
+	if len(v1) != len(v2) {
+		return false
+	}
+	prec := l.Prec
+	if prec == 0 {
+		prec = functest.DefaultPrec
+	}
+	for i, x := range v1 {
+		y := v2[i]
+		if math.IsNaN(x) != math.IsNaN(y) || math.Abs(x-y) > prec {
+			return false
+		}
+	}
+	return true
+}
+
+// batchFunc turns a batcher into an RFunc which acts on
+// a fixed number of inputs.
+type batchFunc struct {
+	B autofunc.RBatcher
+	N int
+}
+
+func (b *batchFunc) Apply(in autofunc.Result) autofunc.Result {
+	return b.B.Batch(in, b.N)
+}
+
+func (b *batchFunc) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return b.B.BatchR(rv, in, b.N)
+}
+
+func randVector(size int) linalg.Vector {
+	res := make(linalg.Vector, size)
+	for i := range res {
+		res[i] = rand.NormFloat64()
+	}
+	return res
+}
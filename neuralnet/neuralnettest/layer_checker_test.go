@@ -0,0 +1,37 @@
+package neuralnettest
+
+import (
+	"testing"
+
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestDenseLayer(t *testing.T) {
+	layer := &neuralnet.DenseLayer{InputCount: 4, OutputCount: 3}
+	layer.Randomize()
+	NewChecker(layer, 4, 3).FullCheck(t)
+}
+
+func TestActivationLayers(t *testing.T) {
+	layers := map[string]neuralnet.Layer{
+		"Sigmoid":           &neuralnet.Sigmoid{},
+		"HyperbolicTangent": &neuralnet.HyperbolicTangent{},
+	}
+	for name, layer := range layers {
+		t.Run(name, func(t *testing.T) {
+			NewChecker(layer, 5, 2).FullCheck(t)
+		})
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{InputCount: 4, OutputCount: 5},
+		&neuralnet.HyperbolicTangent{},
+		neuralnet.NewLayerNormLayer(5),
+		&neuralnet.DenseLayer{InputCount: 5, OutputCount: 2},
+		&neuralnet.Sigmoid{},
+	}
+	network.Randomize()
+	NewChecker(network, 4, 3).FullCheck(t)
+}
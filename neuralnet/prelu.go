@@ -0,0 +1,218 @@
+package neuralnet
+
+import (
+	"encoding/json"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const defaultPReLUSlope = 0.25
+
+// PReLU is a parametric ReLU, as described in
+// https://arxiv.org/abs/1502.01852.
+// It is like LeakyReLU, except that the slopes for
+// negative inputs are learned.
+//
+// Inputs are treated as rows of len(Slopes) features,
+// and every feature has its own slope.
+// With a single slope, every input component shares
+// the same slope.
+type PReLU struct {
+	Slopes *autofunc.Variable
+}
+
+// NewPReLU creates a PReLU with the given number of
+// slopes, each of which is initialized to 0.25.
+func NewPReLU(slopeCount int) *PReLU {
+	res := &PReLU{
+		Slopes: &autofunc.Variable{Vector: make(linalg.Vector, slopeCount)},
+	}
+	for i := range res.Slopes.Vector {
+		res.Slopes.Vector[i] = defaultPReLUSlope
+	}
+	return res
+}
+
+// DeserializePReLU deserializes a PReLU.
+func DeserializePReLU(d []byte) (*PReLU, error) {
+	var res PReLU
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Parameters returns a slice containing the slope
+// variable.
+func (p *PReLU) Parameters() []*autofunc.Variable {
+	if p.Slopes == nil {
+		panic(uninitPanicMessage)
+	}
+	return []*autofunc.Variable{p.Slopes}
+}
+
+func (p *PReLU) Apply(r autofunc.Result) autofunc.Result {
+	if p.Slopes == nil {
+		panic(uninitPanicMessage)
+	}
+	inVec := r.Output()
+	vec := make(linalg.Vector, len(inVec))
+	for i, x := range inVec {
+		if x > 0 {
+			vec[i] = x
+		} else {
+			vec[i] = x * p.slope(p.Slopes.Vector, i)
+		}
+	}
+	return &pReLUResult{
+		OutputVec: vec,
+		Input:     r,
+		Layer:     p,
+	}
+}
+
+func (p *PReLU) ApplyR(v autofunc.RVector, r autofunc.RResult) autofunc.RResult {
+	if p.Slopes == nil {
+		panic(uninitPanicMessage)
+	}
+	slopesR := v[p.Slopes]
+	inVec := r.Output()
+	inVecR := r.ROutput()
+	vec := make(linalg.Vector, len(inVec))
+	vecR := make(linalg.Vector, len(inVec))
+	for i, x := range inVec {
+		if x > 0 {
+			vec[i] = x
+			vecR[i] = inVecR[i]
+		} else {
+			slope := p.slope(p.Slopes.Vector, i)
+			vec[i] = x * slope
+			vecR[i] = inVecR[i] * slope
+			if slopesR != nil {
+				vecR[i] += x * p.slope(slopesR, i)
+			}
+		}
+	}
+	return &pReLURResult{
+		OutputVec:  vec,
+		ROutputVec: vecR,
+		SlopesR:    slopesR,
+		Input:      r,
+		Layer:      p,
+	}
+}
+
+func (p *PReLU) Batch(inputs autofunc.Result, n int) autofunc.Result {
+	return p.Apply(inputs)
+}
+
+func (p *PReLU) BatchR(v autofunc.RVector, inputs autofunc.RResult, n int) autofunc.RResult {
+	return p.ApplyR(v, inputs)
+}
+
+func (p *PReLU) Serialize() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *PReLU) SerializerType() string {
+	return serializerTypePReLU
+}
+
+func (p *PReLU) slope(slopes linalg.Vector, idx int) float64 {
+	return slopes[idx%len(slopes)]
+}
+
+type pReLUResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	Layer     *PReLU
+}
+
+func (p *pReLUResult) Output() linalg.Vector {
+	return p.OutputVec
+}
+
+func (p *pReLUResult) Constant(g autofunc.Gradient) bool {
+	return p.Input.Constant(g) && p.Layer.Slopes.Constant(g)
+}
+
+func (p *pReLUResult) PropagateGradient(upstream linalg.Vector, grad autofunc.Gradient) {
+	slopes := p.Layer.Slopes.Vector
+	if slopeGrad, ok := grad[p.Layer.Slopes]; ok {
+		for i, x := range p.Input.Output() {
+			if x <= 0 {
+				slopeGrad[i%len(slopeGrad)] += x * upstream[i]
+			}
+		}
+	}
+	if p.Input.Constant(grad) {
+		return
+	}
+	for i, x := range p.Input.Output() {
+		if x <= 0 {
+			upstream[i] *= p.Layer.slope(slopes, i)
+		}
+	}
+	p.Input.PropagateGradient(upstream, grad)
+}
+
+type pReLURResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	SlopesR    linalg.Vector
+	Input      autofunc.RResult
+	Layer      *PReLU
+}
+
+func (p *pReLURResult) Output() linalg.Vector {
+	return p.OutputVec
+}
+
+func (p *pReLURResult) ROutput() linalg.Vector {
+	return p.ROutputVec
+}
+
+func (p *pReLURResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	if !p.Layer.Slopes.Constant(g) {
+		return false
+	} else if _, ok := rg[p.Layer.Slopes]; ok {
+		return false
+	}
+	return p.Input.Constant(rg, g)
+}
+
+func (p *pReLURResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	slopes := p.Layer.Slopes.Vector
+	inVec := p.Input.Output()
+	inVecR := p.Input.ROutput()
+	if slopeGrad, ok := grad[p.Layer.Slopes]; ok {
+		for i, x := range inVec {
+			if x <= 0 {
+				slopeGrad[i%len(slopeGrad)] += x * upstream[i]
+			}
+		}
+	}
+	if slopeGradR, ok := rgrad[p.Layer.Slopes]; ok {
+		for i, x := range inVec {
+			if x <= 0 {
+				slopeGradR[i%len(slopeGradR)] += x*upstreamR[i] + inVecR[i]*upstream[i]
+			}
+		}
+	}
+	if p.Input.Constant(rgrad, grad) {
+		return
+	}
+	for i, x := range inVec {
+		if x <= 0 {
+			slope := p.Layer.slope(slopes, i)
+			upstreamR[i] *= slope
+			if p.SlopesR != nil {
+				upstreamR[i] += upstream[i] * p.Layer.slope(p.SlopesR, i)
+			}
+			upstream[i] *= slope
+		}
+	}
+	p.Input.PropagateRGradient(upstream, upstreamR, rgrad, grad)
+}
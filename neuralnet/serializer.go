@@ -3,24 +3,40 @@ package neuralnet
 import "github.com/unixpickle/serializer"
 
 const (
-	serializerTypePrefix            = "github.com/unixpickle/weakai/neuralnet."
-	serializerTypeHyperbolicTangent = serializerTypePrefix + "HyperbolicTangent"
-	serializerTypeSigmoid           = serializerTypePrefix + "Sigmoid"
-	serializerTypeSin               = serializerTypePrefix + "Sin"
-	serializerTypeBorderLayer       = serializerTypePrefix + "BorderLayer"
-	serializerTypeUnstackLayer      = serializerTypePrefix + "UnstackLayer"
-	serializerTypeConvLayer         = serializerTypePrefix + "ConvLayer"
-	serializerTypeDenseLayer        = serializerTypePrefix + "DenseLayer"
-	serializerTypeMaxPoolingLayer   = serializerTypePrefix + "MaxPoolingLayer"
-	serializerTypeSoftmaxLayer      = serializerTypePrefix + "SoftmaxLayer"
-	serializerTypeLogSoftmaxLayer   = serializerTypePrefix + "LogSoftmaxLayer"
-	serializerTypeNetwork           = serializerTypePrefix + "Network"
-	serializerTypeReLU              = serializerTypePrefix + "ReLU"
-	serializerTypeRescaleLayer      = serializerTypePrefix + "RescaleLayer"
-	serializerTypeDropoutLayer      = serializerTypePrefix + "DropoutLayer"
-	serializerTypeVecRescaleLayer   = serializerTypePrefix + "VecRescaleLayer"
-	serializerTypeGaussNoiseLayer   = serializerTypePrefix + "GaussNoiseLayer"
-	serializerTypeResidualLayer     = serializerTypePrefix + "ResidualLayer"
+	serializerTypePrefix                    = "github.com/unixpickle/weakai/neuralnet."
+	serializerTypeHyperbolicTangent         = serializerTypePrefix + "HyperbolicTangent"
+	serializerTypeSigmoid                   = serializerTypePrefix + "Sigmoid"
+	serializerTypeSin                       = serializerTypePrefix + "Sin"
+	serializerTypeBorderLayer               = serializerTypePrefix + "BorderLayer"
+	serializerTypeUnstackLayer              = serializerTypePrefix + "UnstackLayer"
+	serializerTypeConvLayer                 = serializerTypePrefix + "ConvLayer"
+	serializerTypeDenseLayer                = serializerTypePrefix + "DenseLayer"
+	serializerTypeMaxPoolingLayer           = serializerTypePrefix + "MaxPoolingLayer"
+	serializerTypeSoftmaxLayer              = serializerTypePrefix + "SoftmaxLayer"
+	serializerTypeLogSoftmaxLayer           = serializerTypePrefix + "LogSoftmaxLayer"
+	serializerTypeNetwork                   = serializerTypePrefix + "Network"
+	serializerTypeReLU                      = serializerTypePrefix + "ReLU"
+	serializerTypeRescaleLayer              = serializerTypePrefix + "RescaleLayer"
+	serializerTypeDropoutLayer              = serializerTypePrefix + "DropoutLayer"
+	serializerTypeVecRescaleLayer           = serializerTypePrefix + "VecRescaleLayer"
+	serializerTypeGaussNoiseLayer           = serializerTypePrefix + "GaussNoiseLayer"
+	serializerTypeResidualLayer             = serializerTypePrefix + "ResidualLayer"
+	serializerTypeBatchNormLayer            = serializerTypePrefix + "BatchNormLayer"
+	serializerTypeAveragePoolingLayer       = serializerTypePrefix + "AveragePoolingLayer"
+	serializerTypeGlobalAveragePoolingLayer = serializerTypePrefix + "GlobalAveragePoolingLayer"
+	serializerTypeGlobalMaxPoolingLayer     = serializerTypePrefix + "GlobalMaxPoolingLayer"
+	serializerTypeDeconvLayer               = serializerTypePrefix + "DeconvLayer"
+	serializerTypeUpsampleLayer             = serializerTypePrefix + "UpsampleLayer"
+	serializerTypeEmbeddingLayer            = serializerTypePrefix + "EmbeddingLayer"
+	serializerTypeLayerNormLayer            = serializerTypePrefix + "LayerNormLayer"
+	serializerTypeLeakyReLU                 = serializerTypePrefix + "LeakyReLU"
+	serializerTypeELU                       = serializerTypePrefix + "ELU"
+	serializerTypeSELU                      = serializerTypePrefix + "SELU"
+	serializerTypeSoftplus                  = serializerTypePrefix + "Softplus"
+	serializerTypeSwish                     = serializerTypePrefix + "Swish"
+	serializerTypeGELU                      = serializerTypePrefix + "GELU"
+	serializerTypeHardSigmoid               = serializerTypePrefix + "HardSigmoid"
+	serializerTypePReLU                     = serializerTypePrefix + "PReLU"
 )
 
 func init() {
@@ -66,4 +82,46 @@ func init() {
 		DeserializeGaussNoiseLayer)
 	serializer.RegisterTypedDeserializer(serializerTypeResidualLayer,
 		DeserializeResidualLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeBatchNormLayer,
+		DeserializeBatchNormLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeAveragePoolingLayer,
+		DeserializeAveragePoolingLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeGlobalAveragePoolingLayer,
+		DeserializeGlobalAveragePoolingLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeGlobalMaxPoolingLayer,
+		DeserializeGlobalMaxPoolingLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeDeconvLayer,
+		DeserializeDeconvLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeUpsampleLayer,
+		DeserializeUpsampleLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeEmbeddingLayer,
+		DeserializeEmbeddingLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeLayerNormLayer,
+		DeserializeLayerNormLayer)
+	serializer.RegisterTypedDeserializer(serializerTypeLeakyReLU,
+		DeserializeLeakyReLU)
+	serializer.RegisterTypedDeserializer(serializerTypeELU,
+		DeserializeELU)
+	serializer.RegisterDeserializer(serializerTypeSELU,
+		func(d []byte) (serializer.Serializer, error) {
+			return &SELU{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeSoftplus,
+		func(d []byte) (serializer.Serializer, error) {
+			return &Softplus{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeSwish,
+		func(d []byte) (serializer.Serializer, error) {
+			return &Swish{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeGELU,
+		func(d []byte) (serializer.Serializer, error) {
+			return &GELU{}, nil
+		})
+	serializer.RegisterDeserializer(serializerTypeHardSigmoid,
+		func(d []byte) (serializer.Serializer, error) {
+			return &HardSigmoid{}, nil
+		})
+	serializer.RegisterTypedDeserializer(serializerTypePReLU,
+		DeserializePReLU)
 }
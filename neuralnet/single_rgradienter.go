@@ -21,6 +21,10 @@ type SingleRGradienter struct {
 	Learner  SingleLearner
 	CostFunc CostFunc
 
+	// Processor is used to clip gradients and add noise
+	// to them.
+	Processor GradProcessor
+
 	gradCache  autofunc.Gradient
 	rgradCache autofunc.RGradient
 }
@@ -42,6 +46,7 @@ func (b *SingleRGradienter) Gradient(s sgd.SampleSet) autofunc.Gradient {
 		cost.PropagateGradient(linalg.Vector{1}, b.gradCache)
 	}
 
+	b.Processor.Process(b.gradCache, nil)
 	return b.gradCache
 }
 
@@ -70,5 +75,6 @@ func (b *SingleRGradienter) RGradient(rv autofunc.RVector, s sgd.SampleSet) (aut
 			b.rgradCache, b.gradCache)
 	}
 
+	b.Processor.Process(b.gradCache, b.rgradCache)
 	return b.gradCache, b.rgradCache
 }
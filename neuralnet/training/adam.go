@@ -0,0 +1,101 @@
+package training
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+)
+
+const (
+	defaultAdamBeta1 = 0.9
+	defaultAdamBeta2 = 0.999
+)
+
+// Adam is a StepRule which implements the Adam optimizer,
+// as defined in https://arxiv.org/abs/1412.6980.
+type Adam struct {
+	// Beta1 is the decay rate of the first moment.
+	// If this is 0, 0.9 is used.
+	Beta1 float64
+
+	// Beta2 is the decay rate of the second moment.
+	// If this is 0, 0.999 is used.
+	Beta2 float64
+
+	// Epsilon is added to the denominator for numerical
+	// stability.
+	// If this is 0, 1e-8 is used.
+	Epsilon float64
+
+	state stateMap
+}
+
+// Transform updates the moment estimates and replaces the
+// gradient with the bias-corrected Adam directions.
+func (a *Adam) Transform(g autofunc.Gradient) autofunc.Gradient {
+	beta1, beta2, eps := a.Beta1, a.Beta2, a.Epsilon
+	if beta1 == 0 {
+		beta1 = defaultAdamBeta1
+	}
+	if beta2 == 0 {
+		beta2 = defaultAdamBeta2
+	}
+	if eps == 0 {
+		eps = defaultEpsilon
+	}
+	for variable, grad := range g {
+		state := a.state.get(variable, 2)
+		state.Steps++
+		firstMoment, secondMoment := state.Slots[0], state.Slots[1]
+		correction1 := 1 - math.Pow(beta1, float64(state.Steps))
+		correction2 := 1 - math.Pow(beta2, float64(state.Steps))
+		for i, x := range grad {
+			firstMoment[i] = beta1*firstMoment[i] + (1-beta1)*x
+			secondMoment[i] = beta2*secondMoment[i] + (1-beta2)*x*x
+			m := firstMoment[i] / correction1
+			v := secondMoment[i] / correction2
+			grad[i] = m / (math.Sqrt(v) + eps)
+		}
+	}
+	return g
+}
+
+// SaveState saves the moment estimates and step counts.
+func (a *Adam) SaveState(params []*autofunc.Variable) ([]byte, error) {
+	return a.state.save(params)
+}
+
+// LoadState loads the moment estimates and step counts.
+func (a *Adam) LoadState(params []*autofunc.Variable, data []byte) error {
+	state, err := loadStateMap(params, data, 2)
+	if err != nil {
+		return err
+	}
+	a.state = state
+	return nil
+}
+
+// AdamW is a StepRule which implements Adam with
+// decoupled weight decay, as defined in
+// https://arxiv.org/abs/1711.05101.
+//
+// Unlike L2 regularization, the weight decay term is not
+// scaled by Adam's adaptive denominators.
+type AdamW struct {
+	Adam
+
+	// WeightDecay is the decay coefficient.
+	// Each step moves a variable by the step size times
+	// WeightDecay times the variable's current value.
+	WeightDecay float64
+}
+
+// Transform computes the Adam directions and adds the
+// weight decay term to them.
+func (a *AdamW) Transform(g autofunc.Gradient) autofunc.Gradient {
+	a.Adam.Transform(g)
+	for variable, grad := range g {
+		grad.Add(variable.Vector.Copy().Scale(a.WeightDecay))
+	}
+	return g
+}
@@ -0,0 +1,111 @@
+package training
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+)
+
+const (
+	defaultEpsilon      = 1e-8
+	defaultRMSPropDecay = 0.9
+)
+
+// Adagrad is a StepRule which divides each gradient
+// component by the root of the sum of that component's
+// squares over all previous steps.
+type Adagrad struct {
+	// Epsilon is added to the denominator for numerical
+	// stability.
+	// If this is 0, 1e-8 is used.
+	Epsilon float64
+
+	state stateMap
+}
+
+// Transform updates the squared sums and scales the
+// gradient accordingly.
+func (a *Adagrad) Transform(g autofunc.Gradient) autofunc.Gradient {
+	eps := a.Epsilon
+	if eps == 0 {
+		eps = defaultEpsilon
+	}
+	for variable, grad := range g {
+		state := a.state.get(variable, 1)
+		state.Steps++
+		sqSum := state.Slots[0]
+		for i, x := range grad {
+			sqSum[i] += x * x
+			grad[i] = x / (math.Sqrt(sqSum[i]) + eps)
+		}
+	}
+	return g
+}
+
+// SaveState saves the squared sums.
+func (a *Adagrad) SaveState(params []*autofunc.Variable) ([]byte, error) {
+	return a.state.save(params)
+}
+
+// LoadState loads the squared sums.
+func (a *Adagrad) LoadState(params []*autofunc.Variable, data []byte) error {
+	state, err := loadStateMap(params, data, 1)
+	if err != nil {
+		return err
+	}
+	a.state = state
+	return nil
+}
+
+// RMSProp is a StepRule which divides each gradient
+// component by the root of a running average of that
+// component's square.
+type RMSProp struct {
+	// Decay is the decay rate of the running average.
+	// If this is 0, 0.9 is used.
+	Decay float64
+
+	// Epsilon is added to the denominator for numerical
+	// stability.
+	// If this is 0, 1e-8 is used.
+	Epsilon float64
+
+	state stateMap
+}
+
+// Transform updates the running averages and scales the
+// gradient accordingly.
+func (r *RMSProp) Transform(g autofunc.Gradient) autofunc.Gradient {
+	decay, eps := r.Decay, r.Epsilon
+	if decay == 0 {
+		decay = defaultRMSPropDecay
+	}
+	if eps == 0 {
+		eps = defaultEpsilon
+	}
+	for variable, grad := range g {
+		state := r.state.get(variable, 1)
+		state.Steps++
+		sqAvg := state.Slots[0]
+		for i, x := range grad {
+			sqAvg[i] = decay*sqAvg[i] + (1-decay)*x*x
+			grad[i] = x / (math.Sqrt(sqAvg[i]) + eps)
+		}
+	}
+	return g
+}
+
+// SaveState saves the running averages.
+func (r *RMSProp) SaveState(params []*autofunc.Variable) ([]byte, error) {
+	return r.state.save(params)
+}
+
+// LoadState loads the running averages.
+func (r *RMSProp) LoadState(params []*autofunc.Variable, data []byte) error {
+	state, err := loadStateMap(params, data, 1)
+	if err != nil {
+		return err
+	}
+	r.state = state
+	return nil
+}
@@ -0,0 +1,245 @@
+package training
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var c Checkpoint
+	serializer.RegisterTypedDeserializer(c.SerializerType(), DeserializeCheckpoint)
+}
+
+// A Checkpoint stores everything needed to resume
+// training exactly where it left off.
+//
+// The model may be any serializer.Serializer, such as a
+// neuralnet.Network or an rnn.Block.
+type Checkpoint struct {
+	// Model is the model being trained.
+	Model serializer.Serializer
+
+	// RuleState is the state of the Trainer's StepRule,
+	// as returned by StepRule.SaveState.
+	// It is nil if the Trainer had no StepRule.
+	RuleState []byte
+
+	// Epoch and Iteration indicate how far along training
+	// is, which also determines the position in the
+	// learning-rate schedule.
+	Epoch     int
+	Iteration int
+
+	// Seed is the Trainer's shuffle seed.
+	Seed int64
+
+	// BestParams and BestCost store the best parameters
+	// seen during validation, or nil if there was no
+	// validation.
+	BestParams []linalg.Vector
+	BestCost   float64
+
+	// BadEpochs is the number of epochs since the
+	// validation cost last improved.
+	BadEpochs int
+}
+
+// checkpointInfo is the JSON-encoded part of a Checkpoint.
+//
+// BestCost is stored as its IEEE 754 bits, since JSON
+// cannot represent NaN or infinite costs.
+type checkpointInfo struct {
+	Epoch      int
+	Iteration  int
+	Seed       int64
+	BestParams []linalg.Vector
+	BestCost   uint64
+	BadEpochs  int
+	HasRule    bool
+}
+
+// DeserializeCheckpoint deserializes a Checkpoint.
+func DeserializeCheckpoint(d []byte) (*Checkpoint, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 3 {
+		return nil, errors.New("invalid slice length in Checkpoint")
+	}
+	infoData, ok1 := slice[1].(serializer.Bytes)
+	ruleState, ok2 := slice[2].(serializer.Bytes)
+	if !ok1 || !ok2 {
+		return nil, errors.New("invalid types in Checkpoint slice")
+	}
+	var info checkpointInfo
+	if err := json.Unmarshal(infoData, &info); err != nil {
+		return nil, err
+	}
+	res := &Checkpoint{
+		Model:      slice[0],
+		Epoch:      info.Epoch,
+		Iteration:  info.Iteration,
+		Seed:       info.Seed,
+		BestParams: info.BestParams,
+		BestCost:   math.Float64frombits(info.BestCost),
+		BadEpochs:  info.BadEpochs,
+	}
+	if info.HasRule {
+		res.RuleState = []byte(ruleState)
+	}
+	return res, nil
+}
+
+// LoadCheckpoint reads a Checkpoint from a file.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DeserializeCheckpoint(data)
+}
+
+// Save writes the Checkpoint to a file.
+//
+// The file is written atomically, so an existing
+// checkpoint at the same path is never left corrupted,
+// even if the process dies while saving.
+// If the file already exists, its mode is preserved.
+// Otherwise, the new file has mode 0644.
+func (c *Checkpoint) Save(path string) (err error) {
+	data, err := c.Serialize()
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+		}
+	}()
+	mode := os.FileMode(0644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = tempFile.Chmod(mode); err != nil {
+		return err
+	}
+	if _, err = tempFile.Write(data); err != nil {
+		return err
+	}
+	if err = tempFile.Sync(); err != nil {
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), path)
+}
+
+// Serialize serializes the Checkpoint.
+func (c *Checkpoint) Serialize() ([]byte, error) {
+	info := checkpointInfo{
+		Epoch:      c.Epoch,
+		Iteration:  c.Iteration,
+		Seed:       c.Seed,
+		BestParams: c.BestParams,
+		BadEpochs:  c.BadEpochs,
+		HasRule:    c.RuleState != nil,
+	}
+	if c.BestParams != nil {
+		info.BestCost = math.Float64bits(c.BestCost)
+	}
+	infoData, err := json.Marshal(&info)
+	if err != nil {
+		return nil, err
+	}
+	return serializer.SerializeSlice([]serializer.Serializer{
+		c.Model,
+		serializer.Bytes(infoData),
+		serializer.Bytes(c.RuleState),
+	})
+}
+
+// SerializerType returns the unique ID used to serialize
+// a Checkpoint with the serializer package.
+func (c *Checkpoint) SerializerType() string {
+	return "github.com/unixpickle/weakai/neuralnet/training.Checkpoint"
+}
+
+// Checkpoint creates a Checkpoint for the Trainer's
+// current state.
+// The model should be the model that t.Learner refers to.
+//
+// Since Train restores the best parameters when it
+// returns, checkpoints for resuming training should be
+// made from the Trainer's EpochFunc.
+func (t *Trainer) Checkpoint(model serializer.Serializer) (*Checkpoint, error) {
+	res := &Checkpoint{
+		Model:     model,
+		Epoch:     t.Epoch,
+		Iteration: t.Iteration,
+		Seed:      t.Seed,
+		BestCost:  t.bestCost,
+		BadEpochs: t.badEpochs,
+	}
+	for _, p := range t.bestParams {
+		res.BestParams = append(res.BestParams, p.Copy())
+	}
+	if t.Rule != nil {
+		var err error
+		res.RuleState, err = t.Rule.SaveState(t.Learner.Parameters())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Resume restores the Trainer's state from a Checkpoint.
+//
+// The Trainer should be set up the same way it was when
+// the Checkpoint was created, except that its Learner and
+// Gradienter should use the Checkpoint's Model.
+func (t *Trainer) Resume(c *Checkpoint) error {
+	if c.BestParams != nil {
+		params := t.Learner.Parameters()
+		if len(params) != len(c.BestParams) {
+			return errors.New("checkpoint does not match parameter count")
+		}
+		for i, p := range params {
+			if len(p.Vector) != len(c.BestParams[i]) {
+				return errors.New("checkpoint does not match parameter size")
+			}
+		}
+	}
+	if c.RuleState != nil {
+		if t.Rule == nil {
+			return errors.New("checkpoint has step rule state but trainer has no rule")
+		}
+		if err := t.Rule.LoadState(t.Learner.Parameters(), c.RuleState); err != nil {
+			return err
+		}
+	}
+	t.Epoch = c.Epoch
+	t.Iteration = c.Iteration
+	t.Seed = c.Seed
+	t.bestCost = c.BestCost
+	t.badEpochs = c.BadEpochs
+	t.bestParams = nil
+	for _, p := range c.BestParams {
+		t.bestParams = append(t.bestParams, p.Copy())
+	}
+	return nil
+}
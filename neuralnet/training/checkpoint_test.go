@@ -0,0 +1,189 @@
+package training
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	var inputs, outputs []linalg.Vector
+	for i := 0; i < 20; i++ {
+		inputs = append(inputs, linalg.RandVector(3))
+		outputs = append(outputs, linalg.RandVector(2))
+	}
+	samples := neuralnet.VectorSampleSet(inputs, outputs)
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{InputCount: 3, OutputCount: 4},
+		&neuralnet.HyperbolicTangent{},
+		&neuralnet.DenseLayer{InputCount: 4, OutputCount: 2},
+	}
+	network.Randomize()
+
+	trainer := checkpointTestTrainer(network, samples)
+	trainer.EpochFunc = func(epoch int, cost float64) bool {
+		if epoch == 3 {
+			checkpoint, err := trainer.Checkpoint(network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkpoint.Save(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return true
+	}
+	trainer.Train(samples, 6)
+
+	checkpoint, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Epoch != 3 || checkpoint.Iteration != 12 {
+		t.Errorf("unexpected position: epoch=%d iteration=%d", checkpoint.Epoch,
+			checkpoint.Iteration)
+	}
+	newNetwork, ok := checkpoint.Model.(neuralnet.Network)
+	if !ok {
+		t.Fatalf("expected neuralnet.Network but got %T", checkpoint.Model)
+	}
+	resumed := checkpointTestTrainer(newNetwork, samples)
+	if err := resumed.Resume(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	resumed.Train(samples, 6)
+
+	expected := network.Parameters()
+	actual := newNetwork.Parameters()
+	for i, param := range expected {
+		for j, x := range param.Vector {
+			if actual[i].Vector[j] != x {
+				t.Fatalf("parameter %d differs at index %d", i, j)
+			}
+		}
+	}
+	if resumed.BestCost() != trainer.BestCost() {
+		t.Errorf("expected best cost %f but got %f", trainer.BestCost(), resumed.BestCost())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 {
+		t.Errorf("expected 1 file but found %d", len(files))
+	}
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	layer := &neuralnet.DenseLayer{InputCount: 3, OutputCount: 2}
+	layer.Randomize()
+	trainer := &Trainer{Learner: layer, Rule: &Adam{}}
+	checkpoint, err := trainer.Checkpoint(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &neuralnet.DenseLayer{InputCount: 2, OutputCount: 2}
+	other.Randomize()
+	if err := (&Trainer{Learner: other, Rule: &Adam{}}).Resume(checkpoint); err != nil {
+		t.Error("unexpected error for empty rule state:", err)
+	}
+	if err := (&Trainer{Learner: other}).Resume(checkpoint); err == nil {
+		t.Error("expected error for missing step rule")
+	}
+}
+
+func TestCheckpointNonFiniteCost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	layer := &neuralnet.DenseLayer{InputCount: 3, OutputCount: 2}
+	layer.Randomize()
+	for _, cost := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		checkpoint := &Checkpoint{
+			Model:      layer,
+			BestParams: []linalg.Vector{{1, 2}},
+			BestCost:   cost,
+		}
+		if err := checkpoint.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.IsNaN(cost) {
+			if !math.IsNaN(loaded.BestCost) {
+				t.Errorf("expected NaN but got %f", loaded.BestCost)
+			}
+		} else if loaded.BestCost != cost {
+			t.Errorf("expected %f but got %f", cost, loaded.BestCost)
+		}
+	}
+}
+
+func TestCheckpointFileMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	layer := &neuralnet.DenseLayer{InputCount: 3, OutputCount: 2}
+	layer.Randomize()
+	checkpoint := &Checkpoint{Model: layer}
+	if err := checkpoint.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("expected mode 0644 but got %o", info.Mode().Perm())
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 but got %o", info.Mode().Perm())
+	}
+}
+
+func checkpointTestTrainer(n neuralnet.Network, samples sgd.SampleSet) *Trainer {
+	return &Trainer{
+		Gradienter: &neuralnet.BatchRGradienter{
+			Learner:  n.BatchLearner(),
+			CostFunc: neuralnet.MeanSquaredCost{},
+		},
+		Learner:    n,
+		Rule:       &Adam{},
+		Schedule:   &ExpSchedule{Initial: 0.01, Decay: 0.99},
+		BatchSize:  5,
+		Seed:       1337,
+		Validation: samples,
+		CostFunc:   neuralnet.MeanSquaredCost{},
+		Batcher:    n.BatchLearner(),
+	}
+}
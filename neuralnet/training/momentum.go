@@ -0,0 +1,49 @@
+package training
+
+import "github.com/unixpickle/autofunc"
+
+// Momentum is a StepRule which implements classical
+// momentum or Nesterov momentum.
+type Momentum struct {
+	// Momentum is the decay rate for the velocity,
+	// typically something like 0.9.
+	Momentum float64
+
+	// Nesterov indicates whether or not to use Nesterov's
+	// accelerated gradient rather than classical momentum.
+	Nesterov bool
+
+	state stateMap
+}
+
+// Transform updates the velocities and replaces the
+// gradient with the velocity-based update directions.
+func (m *Momentum) Transform(g autofunc.Gradient) autofunc.Gradient {
+	for variable, grad := range g {
+		state := m.state.get(variable, 1)
+		state.Steps++
+		velocity := state.Slots[0]
+		velocity.Scale(m.Momentum).Add(grad)
+		if m.Nesterov {
+			grad.Add(velocity.Copy().Scale(m.Momentum))
+		} else {
+			copy(grad, velocity)
+		}
+	}
+	return g
+}
+
+// SaveState saves the velocities.
+func (m *Momentum) SaveState(params []*autofunc.Variable) ([]byte, error) {
+	return m.state.save(params)
+}
+
+// LoadState loads the velocities.
+func (m *Momentum) LoadState(params []*autofunc.Variable, data []byte) error {
+	state, err := loadStateMap(params, data, 1)
+	if err != nil {
+		return err
+	}
+	m.state = state
+	return nil
+}
@@ -0,0 +1,91 @@
+package training
+
+import "math"
+
+// A Schedule determines the step size (learning rate) to
+// use at each iteration of training.
+//
+// Iterations are counted in mini-batches, starting at 0.
+type Schedule interface {
+	StepSize(iteration int) float64
+}
+
+// ConstSchedule is a Schedule which always uses the same
+// step size.
+type ConstSchedule float64
+
+// StepSize returns the constant step size.
+func (c ConstSchedule) StepSize(iteration int) float64 {
+	return float64(c)
+}
+
+// StepSchedule is a Schedule which multiplies the step
+// size by a constant factor every Interval iterations.
+//
+// If Interval is 0, the step size never decays.
+type StepSchedule struct {
+	Initial  float64
+	Decay    float64
+	Interval int
+}
+
+// StepSize returns Initial*Decay^floor(iteration/Interval).
+func (s *StepSchedule) StepSize(iteration int) float64 {
+	if s.Interval <= 0 {
+		return s.Initial
+	}
+	return s.Initial * math.Pow(s.Decay, float64(iteration/s.Interval))
+}
+
+// ExpSchedule is a Schedule which multiplies the step
+// size by a constant factor every iteration.
+type ExpSchedule struct {
+	Initial float64
+	Decay   float64
+}
+
+// StepSize returns Initial*Decay^iteration.
+func (e *ExpSchedule) StepSize(iteration int) float64 {
+	return e.Initial * math.Pow(e.Decay, float64(iteration))
+}
+
+// CosineSchedule is a Schedule which anneals the step
+// size from Initial to Final along half of a cosine wave,
+// as described in https://arxiv.org/abs/1608.03983.
+//
+// After Iterations iterations, the step size stays at
+// Final.
+type CosineSchedule struct {
+	Initial    float64
+	Final      float64
+	Iterations int
+}
+
+// StepSize returns the annealed step size.
+func (c *CosineSchedule) StepSize(iteration int) float64 {
+	if iteration >= c.Iterations {
+		return c.Final
+	}
+	frac := float64(iteration) / float64(c.Iterations)
+	return c.Final + (c.Initial-c.Final)*(1+math.Cos(math.Pi*frac))/2
+}
+
+// WarmupSchedule is a Schedule which linearly increases
+// the step size from nearly zero for the first Iterations
+// iterations, and then defers to another Schedule.
+//
+// The wrapped Schedule starts at iteration 0 once the
+// warmup is complete.
+type WarmupSchedule struct {
+	Iterations int
+	Schedule   Schedule
+}
+
+// StepSize returns the warmed up step size.
+func (w *WarmupSchedule) StepSize(iteration int) float64 {
+	if iteration < w.Iterations {
+		scale := float64(iteration+1) / float64(w.Iterations)
+		return scale * w.Schedule.StepSize(0)
+	}
+	return w.Schedule.StepSize(iteration - w.Iterations)
+}
@@ -0,0 +1,33 @@
+package training
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchedules(t *testing.T) {
+	schedules := []Schedule{
+		ConstSchedule(0.5),
+		&StepSchedule{Initial: 1, Decay: 0.5, Interval: 2},
+		&StepSchedule{Initial: 1, Decay: 0.5},
+		&ExpSchedule{Initial: 1, Decay: 0.5},
+		&CosineSchedule{Initial: 1, Final: 0.2, Iterations: 4},
+		&WarmupSchedule{Iterations: 2, Schedule: &ExpSchedule{Initial: 1, Decay: 0.5}},
+	}
+	expected := [][]float64{
+		{0.5, 0.5, 0.5, 0.5, 0.5, 0.5},
+		{1, 1, 0.5, 0.5, 0.25, 0.25},
+		{1, 1, 1, 1, 1, 1},
+		{1, 0.5, 0.25, 0.125, 0.0625, 0.03125},
+		{1, 0.2 + 0.8*(1+math.Sqrt(0.5))/2, 0.6, 0.2 + 0.8*(1-math.Sqrt(0.5))/2, 0.2, 0.2},
+		{0.5, 1, 1, 0.5, 0.25, 0.125},
+	}
+	for i, schedule := range schedules {
+		for iter, x := range expected[i] {
+			if actual := schedule.StepSize(iter); math.Abs(actual-x) > 1e-8 {
+				t.Errorf("schedule %d iteration %d: expected %f but got %f", i, iter,
+					x, actual)
+			}
+		}
+	}
+}
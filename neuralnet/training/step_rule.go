@@ -0,0 +1,136 @@
+// Package training provides tools for training neural
+// networks on top of the sgd package.
+//
+// The step rules in this package (e.g. Momentum and Adam)
+// turn raw gradients into update directions.
+// Since they operate on plain autofunc.Gradients, they
+// work with any sgd.Gradienter, including those from the
+// neuralnet and rnn/seqtoseq packages:
+//
+//	gradienter := &training.RuleGradienter{
+//	    Gradienter: &neuralnet.BatchRGradienter{
+//	        Learner:  network.BatchLearner(),
+//	        CostFunc: neuralnet.MeanSquaredCost{},
+//	    },
+//	    Rule: &training.Adam{},
+//	}
+//	sgd.SGD(gradienter, samples, 0.001, 100, 32)
+//
+// For more control over training, a Trainer can be used
+// in place of sgd.SGD.
+// It supports learning-rate schedules, validation, and
+// early stopping.
+package training
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// A StepRule transforms gradients into update directions.
+//
+// A StepRule keeps separate state for every variable it
+// sees, so the same StepRule should not be shared between
+// unrelated models.
+type StepRule interface {
+	// Transform replaces the entries of a gradient with
+	// the directions in which the corresponding variables
+	// should be moved (with the sign of the gradient).
+	// The gradient is modified in place and returned.
+	Transform(g autofunc.Gradient) autofunc.Gradient
+
+	// SaveState serializes the rule's per-variable state.
+	// The params list determines the order in which the
+	// state is saved, and must be the same list passed
+	// to LoadState.
+	SaveState(params []*autofunc.Variable) ([]byte, error)
+
+	// LoadState restores state saved by SaveState,
+	// replacing any existing state.
+	LoadState(params []*autofunc.Variable, data []byte) error
+}
+
+// RuleGradienter is an sgd.Gradienter which uses a
+// StepRule to transform the gradients of an underlying
+// sgd.Gradienter.
+//
+// This makes it possible to use any StepRule with sgd.SGD.
+type RuleGradienter struct {
+	Gradienter sgd.Gradienter
+	Rule       StepRule
+}
+
+// Gradient computes the gradient from the underlying
+// Gradienter and transforms it with the StepRule.
+func (r *RuleGradienter) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	return r.Rule.Transform(r.Gradienter.Gradient(s))
+}
+
+// paramState is the state a StepRule stores for a single
+// variable.
+type paramState struct {
+	// Steps is the number of gradients which have been
+	// applied to the variable.
+	Steps int
+
+	// Slots stores running statistics, each with the
+	// same length as the variable.
+	Slots []linalg.Vector
+}
+
+type stateMap map[*autofunc.Variable]*paramState
+
+// get returns the state for a variable, creating it with
+// the given number of slots if necessary.
+func (s *stateMap) get(v *autofunc.Variable, slots int) *paramState {
+	if *s == nil {
+		*s = stateMap{}
+	}
+	if res, ok := (*s)[v]; ok {
+		return res
+	}
+	res := &paramState{Slots: make([]linalg.Vector, slots)}
+	for i := range res.Slots {
+		res.Slots[i] = make(linalg.Vector, len(v.Vector))
+	}
+	(*s)[v] = res
+	return res
+}
+
+func (s stateMap) save(params []*autofunc.Variable) ([]byte, error) {
+	list := make([]*paramState, len(params))
+	for i, p := range params {
+		list[i] = s[p]
+	}
+	return json.Marshal(list)
+}
+
+func loadStateMap(params []*autofunc.Variable, data []byte, slots int) (stateMap, error) {
+	var list []*paramState
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if len(list) != len(params) {
+		return nil, errors.New("state does not match parameter count")
+	}
+	res := stateMap{}
+	for i, state := range list {
+		if state == nil {
+			continue
+		}
+		if len(state.Slots) != slots {
+			return nil, errors.New("state has unexpected number of slots")
+		}
+		for _, slot := range state.Slots {
+			if len(slot) != len(params[i].Vector) {
+				return nil, errors.New("state does not match parameter size")
+			}
+		}
+		res[params[i]] = state
+	}
+	return res, nil
+}
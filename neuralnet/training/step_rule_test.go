@@ -0,0 +1,170 @@
+package training
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestMomentumDirections(t *testing.T) {
+	for _, nesterov := range []bool{false, true} {
+		rule := &Momentum{Momentum: 0.5, Nesterov: nesterov}
+		variable := &autofunc.Variable{Vector: linalg.Vector{0, 0}}
+		expected := []float64{1, 1.5, 1.75}
+		if nesterov {
+			expected = []float64{1.5, 1.75, 1.875}
+		}
+		for i, x := range expected {
+			grad := autofunc.Gradient{variable: linalg.Vector{1, -1}}
+			rule.Transform(grad)
+			actual := grad[variable]
+			if math.Abs(actual[0]-x) > 1e-8 || math.Abs(actual[1]+x) > 1e-8 {
+				t.Errorf("nesterov=%v step %d: expected %f but got %v", nesterov, i, x, actual)
+			}
+		}
+	}
+}
+
+func TestAdamFirstStep(t *testing.T) {
+	rule := &Adam{}
+	variable := &autofunc.Variable{Vector: linalg.Vector{1, 2, 3}}
+	grad := autofunc.Gradient{variable: linalg.Vector{0.001, -5, 30}}
+	rule.Transform(grad)
+	for i, x := range []float64{1, -1, 1} {
+		if math.Abs(grad[variable][i]-x) > 1e-4 {
+			t.Errorf("expected %v but got %v", []float64{1, -1, 1}, grad[variable])
+			break
+		}
+	}
+}
+
+func TestAdamWDecay(t *testing.T) {
+	rule := &AdamW{WeightDecay: 0.1}
+	variable := &autofunc.Variable{Vector: linalg.Vector{2, -4}}
+	grad := autofunc.Gradient{variable: linalg.Vector{0, 0}}
+	rule.Transform(grad)
+	expected := linalg.Vector{0.2, -0.4}
+	for i, x := range expected {
+		if math.Abs(grad[variable][i]-x) > 1e-8 {
+			t.Errorf("expected %v but got %v", expected, grad[variable])
+			break
+		}
+	}
+}
+
+func TestStepRulesMinimize(t *testing.T) {
+	rules := map[string]StepRule{
+		"Momentum": &Momentum{Momentum: 0.9},
+		"Nesterov": &Momentum{Momentum: 0.9, Nesterov: true},
+		"Adagrad":  &Adagrad{},
+		"RMSProp":  &RMSProp{},
+		"Adam":     &Adam{},
+		"AdamW":    &AdamW{WeightDecay: 0.01},
+	}
+	stepSizes := map[string]float64{
+		"Momentum": 0.01,
+		"Nesterov": 0.01,
+		"Adagrad":  0.5,
+		"RMSProp":  0.01,
+		"Adam":     0.05,
+		"AdamW":    0.05,
+	}
+	for name, rule := range rules {
+		g := &quadraticGradienter{
+			Variable: &autofunc.Variable{Vector: linalg.Vector{3, -2, 1}},
+			Scales:   linalg.Vector{1, 5, 10},
+		}
+		initCost := g.Cost()
+		sgd.SGD(&RuleGradienter{Gradienter: g, Rule: rule}, sgd.SliceSampleSet{nil},
+			stepSizes[name], 300, 1)
+		if cost := g.Cost(); cost > initCost*1e-2 {
+			t.Errorf("%s: cost went from %f to %f", name, initCost, cost)
+		}
+	}
+}
+
+func TestStepRuleState(t *testing.T) {
+	rules := []func() StepRule{
+		func() StepRule { return &Momentum{Momentum: 0.9, Nesterov: true} },
+		func() StepRule { return &Adagrad{} },
+		func() StepRule { return &RMSProp{} },
+		func() StepRule { return &Adam{} },
+		func() StepRule { return &AdamW{WeightDecay: 0.1} },
+	}
+	params := []*autofunc.Variable{
+		{Vector: linalg.RandVector(3)},
+		{Vector: linalg.RandVector(2)},
+		{Vector: linalg.RandVector(4)},
+	}
+	randGrad := func() autofunc.Gradient {
+		// The last parameter never gets a gradient.
+		return autofunc.Gradient{
+			params[0]: linalg.RandVector(3),
+			params[1]: linalg.RandVector(2),
+		}
+	}
+	for i, ruleMaker := range rules {
+		rule := ruleMaker()
+		for j := 0; j < 3; j++ {
+			rule.Transform(randGrad())
+		}
+		data, err := rule.SaveState(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := ruleMaker()
+		restored.Transform(randGrad())
+		if err := restored.LoadState(params, data); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 2; j++ {
+			grad := randGrad()
+			expected := rule.Transform(copyGrad(grad))
+			actual := restored.Transform(grad)
+			for v, expVec := range expected {
+				for k, x := range expVec {
+					if math.Abs(actual[v][k]-x) > 1e-8 {
+						t.Errorf("rule %d step %d: expected %v but got %v", i, j,
+							expVec, actual[v])
+						break
+					}
+				}
+			}
+		}
+		if err := restored.LoadState(params[:2], data); err == nil {
+			t.Errorf("rule %d: expected error for mismatched parameters", i)
+		}
+	}
+}
+
+type quadraticGradienter struct {
+	Variable *autofunc.Variable
+	Scales   linalg.Vector
+}
+
+func (q *quadraticGradienter) Cost() float64 {
+	var res float64
+	for i, x := range q.Variable.Vector {
+		res += 0.5 * q.Scales[i] * x * x
+	}
+	return res
+}
+
+func (q *quadraticGradienter) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	grad := make(linalg.Vector, len(q.Variable.Vector))
+	for i, x := range q.Variable.Vector {
+		grad[i] = q.Scales[i] * x
+	}
+	return autofunc.Gradient{q.Variable: grad}
+}
+
+func copyGrad(g autofunc.Gradient) autofunc.Gradient {
+	res := autofunc.Gradient{}
+	for v, x := range g {
+		res[v] = x.Copy()
+	}
+	return res
+}
@@ -0,0 +1,192 @@
+package training
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// A Trainer runs mini-batch gradient descent for a number
+// of epochs, optionally evaluating the model on a
+// validation set after every epoch.
+//
+// When a validation set is used, the Trainer keeps track
+// of the parameters with the lowest validation cost.
+// It restores those parameters when training ends, and it
+// can stop training early once the validation cost stops
+// improving.
+type Trainer struct {
+	// Gradienter computes the gradients for mini-batches.
+	Gradienter sgd.Gradienter
+
+	// Learner provides the parameters of the model.
+	// It is required when a validation set is used, so
+	// that the best parameters can be saved.
+	Learner sgd.Learner
+
+	// Rule transforms gradients before they are applied.
+	// If this is nil, plain SGD is used.
+	Rule StepRule
+
+	// Schedule determines the step size for each
+	// mini-batch.
+	Schedule Schedule
+
+	// BatchSize is the number of samples per mini-batch.
+	// If this is 0, a batch size of 1 is used.
+	BatchSize int
+
+	// Seed determines the order in which samples are
+	// visited.
+	// The order for each epoch is a function of Seed and
+	// the epoch number, so that training is reproducible.
+	Seed int64
+
+	// Validation is the set of VectorSamples used to
+	// evaluate the model after each epoch.
+	// If this is nil, no validation is performed.
+	Validation sgd.SampleSet
+
+	// CostFunc is the cost function used for validation.
+	CostFunc neuralnet.CostFunc
+
+	// Batcher is used to evaluate the validation set with
+	// neuralnet.TotalCostBatcher.
+	// If this is nil, Func is used with
+	// neuralnet.TotalCost instead.
+	Batcher autofunc.Batcher
+
+	// Func is used to evaluate the validation set if
+	// Batcher is nil.
+	Func autofunc.Func
+
+	// Patience is the number of epochs without an
+	// improvement in validation cost after which training
+	// is stopped.
+	// If this is 0, training never stops early.
+	Patience int
+
+	// EpochFunc, if non-nil, is called after every epoch.
+	// The validation cost is NaN if there is no
+	// validation set.
+	// If EpochFunc returns false, training is stopped.
+	EpochFunc func(epoch int, validationCost float64) bool
+
+	// Epoch is the number of epochs that have been
+	// completed.
+	Epoch int
+
+	// Iteration is the number of mini-batches that have
+	// been trained on.
+	Iteration int
+
+	bestCost   float64
+	bestParams []linalg.Vector
+	badEpochs  int
+}
+
+// Train trains on s until Epoch reaches the given number
+// of epochs, training stops early, or EpochFunc returns
+// false.
+// If epochs is 0, training continues until it is stopped
+// some other way.
+//
+// Since Epoch and Iteration are preserved between calls,
+// calling Train again continues where it left off.
+func (t *Trainer) Train(s sgd.SampleSet, epochs int) {
+	for epochs == 0 || t.Epoch < epochs {
+		t.trainEpoch(s)
+		t.Epoch++
+		if !t.endEpoch() {
+			break
+		}
+	}
+	t.restoreBest()
+}
+
+// BestCost returns the lowest validation cost seen so
+// far, or NaN if no validation has been done.
+func (t *Trainer) BestCost() float64 {
+	if t.bestParams == nil {
+		return math.NaN()
+	}
+	return t.bestCost
+}
+
+func (t *Trainer) trainEpoch(s sgd.SampleSet) {
+	s = s.Copy()
+	rng := rand.New(rand.NewSource(t.Seed + int64(t.Epoch)))
+	for i := 0; i < s.Len(); i++ {
+		s.Swap(i, i+rng.Intn(s.Len()-i))
+	}
+	batchSize := t.batchSize()
+	for i := 0; i < s.Len(); i += batchSize {
+		bs := batchSize
+		if bs > s.Len()-i {
+			bs = s.Len() - i
+		}
+		grad := t.Gradienter.Gradient(s.Subset(i, i+bs))
+		if t.Rule != nil {
+			grad = t.Rule.Transform(grad)
+		}
+		grad.AddToVars(-t.Schedule.StepSize(t.Iteration))
+		t.Iteration++
+	}
+}
+
+// endEpoch runs validation and returns false if training
+// should stop.
+func (t *Trainer) endEpoch() bool {
+	cost := math.NaN()
+	keepGoing := true
+	if t.Validation != nil {
+		if t.Batcher != nil {
+			cost = neuralnet.TotalCostBatcher(t.CostFunc, t.Batcher, t.Validation,
+				t.batchSize())
+		} else {
+			cost = neuralnet.TotalCost(t.CostFunc, t.Func, t.Validation)
+		}
+		if t.bestParams == nil || cost < t.bestCost {
+			t.bestCost = cost
+			t.saveBest()
+			t.badEpochs = 0
+		} else {
+			t.badEpochs++
+			if t.Patience > 0 && t.badEpochs >= t.Patience {
+				keepGoing = false
+			}
+		}
+	}
+	if t.EpochFunc != nil && !t.EpochFunc(t.Epoch, cost) {
+		keepGoing = false
+	}
+	return keepGoing
+}
+
+func (t *Trainer) batchSize() int {
+	if t.BatchSize <= 0 {
+		return 1
+	}
+	return t.BatchSize
+}
+
+func (t *Trainer) saveBest() {
+	params := t.Learner.Parameters()
+	t.bestParams = make([]linalg.Vector, len(params))
+	for i, p := range params {
+		t.bestParams[i] = p.Vector.Copy()
+	}
+}
+
+func (t *Trainer) restoreBest() {
+	if t.bestParams == nil {
+		return
+	}
+	for i, p := range t.Learner.Parameters() {
+		copy(p.Vector, t.bestParams[i])
+	}
+}
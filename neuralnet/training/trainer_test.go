@@ -0,0 +1,143 @@
+package training
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestTrainerFit(t *testing.T) {
+	var inputs, outputs []linalg.Vector
+	for i := 0; i < 50; i++ {
+		in := linalg.RandVector(2)
+		inputs = append(inputs, in)
+		outputs = append(outputs, linalg.Vector{2*in[0] - in[1] + 0.5})
+	}
+	samples := neuralnet.VectorSampleSet(inputs, outputs)
+	layer := &neuralnet.DenseLayer{InputCount: 2, OutputCount: 1}
+	layer.Randomize()
+	trainer := &Trainer{
+		Gradienter: &neuralnet.BatchRGradienter{
+			Learner:  layer,
+			CostFunc: neuralnet.MeanSquaredCost{},
+		},
+		Learner: layer,
+		Rule:    &Adam{},
+		Schedule: &WarmupSchedule{
+			Iterations: 10,
+			Schedule:   &CosineSchedule{Initial: 0.05, Final: 0.001, Iterations: 500},
+		},
+		BatchSize:  10,
+		Validation: samples,
+		CostFunc:   neuralnet.MeanSquaredCost{},
+		Batcher:    layer,
+	}
+	var epochs int
+	trainer.EpochFunc = func(epoch int, cost float64) bool {
+		epochs++
+		if epoch != epochs {
+			t.Errorf("expected epoch %d but got %d", epochs, epoch)
+		}
+		return true
+	}
+	trainer.Train(samples, 100)
+	if epochs != 100 || trainer.Epoch != 100 || trainer.Iteration != 500 {
+		t.Errorf("unexpected counters: calls=%d epoch=%d iteration=%d", epochs,
+			trainer.Epoch, trainer.Iteration)
+	}
+	if cost := trainer.BestCost(); cost > 1e-3 {
+		t.Errorf("validation cost too high: %f", cost)
+	}
+}
+
+func TestTrainerEarlyStopping(t *testing.T) {
+	param := &autofunc.Variable{Vector: linalg.Vector{0}}
+	trainer := &Trainer{
+		Gradienter: &constGradienter{Variable: param, Grad: linalg.Vector{-1}},
+		Learner:    varLearner{param},
+		Schedule:   ConstSchedule(0.5),
+		BatchSize:  1,
+		Validation: neuralnet.VectorSampleSet([]linalg.Vector{{0}}, []linalg.Vector{{1}}),
+		CostFunc:   neuralnet.MeanSquaredCost{},
+		Func:       paramFunc{param},
+		Patience:   2,
+	}
+	trainer.Train(sgd.SliceSampleSet{nil}, 0)
+	if trainer.Epoch != 4 {
+		t.Errorf("expected 4 epochs but got %d", trainer.Epoch)
+	}
+	if math.Abs(param.Vector[0]-1) > 1e-8 {
+		t.Errorf("expected best parameter 1 but got %f", param.Vector[0])
+	}
+	if math.Abs(trainer.BestCost()) > 1e-8 {
+		t.Errorf("expected best cost 0 but got %f", trainer.BestCost())
+	}
+}
+
+func TestTrainerNoValidation(t *testing.T) {
+	param := &autofunc.Variable{Vector: linalg.Vector{0}}
+	trainer := &Trainer{
+		Gradienter: &constGradienter{Variable: param, Grad: linalg.Vector{-1}},
+		Schedule:   &StepSchedule{Initial: 1, Decay: 0.5, Interval: 2},
+		BatchSize:  2,
+		EpochFunc: func(epoch int, cost float64) bool {
+			if !math.IsNaN(cost) {
+				t.Errorf("expected NaN cost but got %f", cost)
+			}
+			return epoch < 3
+		},
+	}
+	trainer.Train(sgd.SliceSampleSet{nil, nil, nil}, 10)
+	if trainer.Epoch != 3 {
+		t.Errorf("expected 3 epochs but got %d", trainer.Epoch)
+	}
+	// Six mini-batches with step sizes 1, 1, 0.5, 0.5, 0.25, 0.25.
+	if math.Abs(param.Vector[0]-3.5) > 1e-8 {
+		t.Errorf("expected parameter 3.5 but got %f", param.Vector[0])
+	}
+	if !math.IsNaN(trainer.BestCost()) {
+		t.Errorf("expected NaN best cost but got %f", trainer.BestCost())
+	}
+}
+
+func TestTrainerDefaultBatchSize(t *testing.T) {
+	param := &autofunc.Variable{Vector: linalg.Vector{0}}
+	trainer := &Trainer{
+		Gradienter: &constGradienter{Variable: param, Grad: linalg.Vector{-1}},
+		Schedule:   ConstSchedule(1),
+	}
+	trainer.Train(sgd.SliceSampleSet{nil, nil, nil}, 2)
+	if trainer.Iteration != 6 {
+		t.Errorf("expected 6 iterations but got %d", trainer.Iteration)
+	}
+	if math.Abs(param.Vector[0]-6) > 1e-8 {
+		t.Errorf("expected parameter 6 but got %f", param.Vector[0])
+	}
+}
+
+type constGradienter struct {
+	Variable *autofunc.Variable
+	Grad     linalg.Vector
+}
+
+func (c *constGradienter) Gradient(s sgd.SampleSet) autofunc.Gradient {
+	return autofunc.Gradient{c.Variable: c.Grad.Copy()}
+}
+
+type paramFunc struct {
+	Variable *autofunc.Variable
+}
+
+func (p paramFunc) Apply(in autofunc.Result) autofunc.Result {
+	return p.Variable
+}
+
+type varLearner []*autofunc.Variable
+
+func (v varLearner) Parameters() []*autofunc.Variable {
+	return v
+}
@@ -0,0 +1,261 @@
+package neuralnet
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/tensor"
+)
+
+// UpsampleMode determines how an UpsampleLayer computes
+// the values in its enlarged output.
+type UpsampleMode int
+
+const (
+	// UpsampleNearest copies each input value into an
+	// XScale by YScale region of the output.
+	UpsampleNearest UpsampleMode = iota
+
+	// UpsampleBilinear interpolates linearly between the
+	// nearest input values in each direction, treating
+	// every input value as the center of its region.
+	UpsampleBilinear
+)
+
+// An UpsampleLayer enlarges the width and height of an
+// input tensor by integer factors.
+// The depth of the tensor is unchanged.
+type UpsampleLayer struct {
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	// XScale and YScale are the factors by which the
+	// width and height of the input are multiplied.
+	XScale int
+	YScale int
+
+	Mode UpsampleMode
+}
+
+// DeserializeUpsampleLayer deserializes an UpsampleLayer.
+func DeserializeUpsampleLayer(d []byte) (*UpsampleLayer, error) {
+	var res UpsampleLayer
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OutputWidth returns the output tensor width.
+func (u *UpsampleLayer) OutputWidth() int {
+	return u.InputWidth * u.XScale
+}
+
+// OutputHeight returns the output tensor height.
+func (u *UpsampleLayer) OutputHeight() int {
+	return u.InputHeight * u.YScale
+}
+
+// Apply applies the layer to an input, which is treated
+// as a tensor.
+func (u *UpsampleLayer) Apply(in autofunc.Result) autofunc.Result {
+	return u.Batch(in, 1)
+}
+
+// ApplyR is like Apply, but for RResults.
+func (u *UpsampleLayer) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return u.BatchR(rv, in, 1)
+}
+
+// Batch applies the layer to inputs in batch.
+func (u *UpsampleLayer) Batch(in autofunc.Result, n int) autofunc.Result {
+	if len(in.Output()) != n*u.inputSize() {
+		panic("invalid input size")
+	}
+	return &upsampleLayerResult{
+		OutputVec: u.upsample(in.Output(), n),
+		Input:     in,
+		N:         n,
+		Layer:     u,
+	}
+}
+
+// BatchR is like Batch, but for RResults.
+func (u *UpsampleLayer) BatchR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	if len(in.Output()) != n*u.inputSize() {
+		panic("invalid input size")
+	}
+	return &upsampleLayerRResult{
+		OutputVec:  u.upsample(in.Output(), n),
+		ROutputVec: u.upsample(in.ROutput(), n),
+		Input:      in,
+		N:          n,
+		Layer:      u,
+	}
+}
+
+// Serialize serializes the layer.
+func (u *UpsampleLayer) Serialize() ([]byte, error) {
+	return json.Marshal(u)
+}
+
+// SerializerType returns the unique ID used to serialize
+// this layer with the serializer package.
+func (u *UpsampleLayer) SerializerType() string {
+	return serializerTypeUpsampleLayer
+}
+
+func (u *UpsampleLayer) inputSize() int {
+	return u.InputWidth * u.InputHeight * u.InputDepth
+}
+
+func (u *UpsampleLayer) outputSize() int {
+	return u.OutputWidth() * u.OutputHeight() * u.InputDepth
+}
+
+// upsample enlarges every tensor in a batch.
+func (u *UpsampleLayer) upsample(in linalg.Vector, n int) linalg.Vector {
+	inSize := u.inputSize()
+	outSize := u.outputSize()
+	res := make(linalg.Vector, n*outSize)
+	for i := 0; i < n; i++ {
+		inTensor := u.inputTensor(in[i*inSize : (i+1)*inSize])
+		outTensor := u.outputTensor(res[i*outSize : (i+1)*outSize])
+		u.forEachSource(func(x, y, inX, inY int, weight float64) {
+			for z := 0; z < u.InputDepth; z++ {
+				val := outTensor.Get(x, y, z) + weight*inTensor.Get(inX, inY, z)
+				outTensor.Set(x, y, z, val)
+			}
+		})
+	}
+	return res
+}
+
+// downsample computes the gradient of upsample with
+// respect to its input, given the upstream gradient.
+func (u *UpsampleLayer) downsample(upstream linalg.Vector, n int) linalg.Vector {
+	inSize := u.inputSize()
+	outSize := u.outputSize()
+	res := make(linalg.Vector, n*inSize)
+	for i := 0; i < n; i++ {
+		upTensor := u.outputTensor(upstream[i*outSize : (i+1)*outSize])
+		downTensor := u.inputTensor(res[i*inSize : (i+1)*inSize])
+		u.forEachSource(func(x, y, inX, inY int, weight float64) {
+			for z := 0; z < u.InputDepth; z++ {
+				val := downTensor.Get(inX, inY, z) + weight*upTensor.Get(x, y, z)
+				downTensor.Set(inX, inY, z, val)
+			}
+		})
+	}
+	return res
+}
+
+// forEachSource calls f for every input coordinate which
+// contributes to every output coordinate, along with the
+// weight of the contribution.
+func (u *UpsampleLayer) forEachSource(f func(x, y, inX, inY int, weight float64)) {
+	for y := 0; y < u.OutputHeight(); y++ {
+		ys, yWeights := u.sourceIndices(y, u.YScale, u.InputHeight)
+		for x := 0; x < u.OutputWidth(); x++ {
+			xs, xWeights := u.sourceIndices(x, u.XScale, u.InputWidth)
+			for i, inY := range ys {
+				for j, inX := range xs {
+					f(x, y, inX, inY, yWeights[i]*xWeights[j])
+				}
+			}
+		}
+	}
+}
+
+// sourceIndices returns the input indices along one axis
+// which contribute to an output index, along with their
+// corresponding weights.
+func (u *UpsampleLayer) sourceIndices(outIdx, scale, inSize int) ([]int, []float64) {
+	switch u.Mode {
+	case UpsampleNearest:
+		return []int{outIdx / scale}, []float64{1}
+	case UpsampleBilinear:
+		pos := (float64(outIdx)+0.5)/float64(scale) - 0.5
+		pos = math.Max(0, math.Min(float64(inSize-1), pos))
+		idx := int(pos)
+		frac := pos - float64(idx)
+		if frac == 0 {
+			return []int{idx}, []float64{1}
+		}
+		return []int{idx, idx + 1}, []float64{1 - frac, frac}
+	default:
+		panic("unknown upsample mode")
+	}
+}
+
+func (u *UpsampleLayer) inputTensor(inVec linalg.Vector) *tensor.Float64 {
+	return &tensor.Float64{
+		Width:  u.InputWidth,
+		Height: u.InputHeight,
+		Depth:  u.InputDepth,
+		Data:   inVec,
+	}
+}
+
+func (u *UpsampleLayer) outputTensor(outVec linalg.Vector) *tensor.Float64 {
+	return &tensor.Float64{
+		Width:  u.OutputWidth(),
+		Height: u.OutputHeight(),
+		Depth:  u.InputDepth,
+		Data:   outVec,
+	}
+}
+
+type upsampleLayerResult struct {
+	OutputVec linalg.Vector
+	Input     autofunc.Result
+	N         int
+	Layer     *UpsampleLayer
+}
+
+func (u *upsampleLayerResult) Output() linalg.Vector {
+	return u.OutputVec
+}
+
+func (u *upsampleLayerResult) Constant(g autofunc.Gradient) bool {
+	return u.Input.Constant(g)
+}
+
+func (u *upsampleLayerResult) PropagateGradient(upstream linalg.Vector,
+	grad autofunc.Gradient) {
+	if !u.Input.Constant(grad) {
+		u.Input.PropagateGradient(u.Layer.downsample(upstream, u.N), grad)
+	}
+}
+
+type upsampleLayerRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	Input      autofunc.RResult
+	N          int
+	Layer      *UpsampleLayer
+}
+
+func (u *upsampleLayerRResult) Output() linalg.Vector {
+	return u.OutputVec
+}
+
+func (u *upsampleLayerRResult) ROutput() linalg.Vector {
+	return u.ROutputVec
+}
+
+func (u *upsampleLayerRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return u.Input.Constant(rg, g)
+}
+
+func (u *upsampleLayerRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rgrad autofunc.RGradient, grad autofunc.Gradient) {
+	if !u.Input.Constant(rgrad, grad) {
+		u.Input.PropagateRGradient(u.Layer.downsample(upstream, u.N),
+			u.Layer.downsample(upstreamR, u.N), rgrad, grad)
+	}
+}
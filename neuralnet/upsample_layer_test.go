@@ -0,0 +1,118 @@
+package neuralnet
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func TestUpsampleForward(t *testing.T) {
+	layers := []*UpsampleLayer{
+		{InputWidth: 2, InputHeight: 2, InputDepth: 2, XScale: 2, YScale: 1,
+			Mode: UpsampleNearest},
+		{InputWidth: 2, InputHeight: 1, InputDepth: 1, XScale: 2, YScale: 2,
+			Mode: UpsampleBilinear},
+	}
+	inputs := []linalg.Vector{
+		{1, 2, 3, 4, 5, 6, 7, 8},
+		{0, 4},
+	}
+	outputs := []linalg.Vector{
+		{1, 2, 1, 2, 3, 4, 3, 4, 5, 6, 5, 6, 7, 8, 7, 8},
+		{0, 1, 3, 4, 0, 1, 3, 4},
+	}
+	for i, layer := range layers {
+		actual := layer.Apply(&autofunc.Variable{Vector: inputs[i]}).Output()
+		expected := outputs[i]
+		if len(actual) != len(expected) {
+			t.Errorf("layer %d: expected %d outputs but got %d", i, len(expected),
+				len(actual))
+			continue
+		}
+		for j, x := range expected {
+			if math.Abs(actual[j]-x) > 1e-5 {
+				t.Errorf("layer %d: output %d should be %f but got %f", i, j, x, actual[j])
+			}
+		}
+	}
+}
+
+func TestUpsampleRProp(t *testing.T) {
+	for _, mode := range []UpsampleMode{UpsampleNearest, UpsampleBilinear} {
+		layer := &UpsampleLayer{
+			InputWidth:  4,
+			InputHeight: 3,
+			InputDepth:  2,
+			XScale:      3,
+			YScale:      2,
+			Mode:        mode,
+		}
+		inputVar := &autofunc.Variable{Vector: make(linalg.Vector, 4*3*2)}
+		rVector := autofunc.RVector{inputVar: make(linalg.Vector, 4*3*2)}
+		for i := range inputVar.Vector {
+			inputVar.Vector[i] = rand.Float64()*2 - 1
+			rVector[inputVar][i] = rand.Float64()*2 - 1
+		}
+		funcTest := &functest.RFuncChecker{
+			F:     layer,
+			Vars:  []*autofunc.Variable{inputVar},
+			Input: inputVar,
+			RV:    rVector,
+		}
+		funcTest.FullCheck(t)
+	}
+}
+
+func TestUpsampleBatch(t *testing.T) {
+	for _, mode := range []UpsampleMode{UpsampleNearest, UpsampleBilinear} {
+		layer := &UpsampleLayer{
+			InputWidth:  5,
+			InputHeight: 4,
+			InputDepth:  3,
+			XScale:      2,
+			YScale:      3,
+			Mode:        mode,
+		}
+		n := 3
+		batchRes := &autofunc.Variable{Vector: make(linalg.Vector, n*5*4*3)}
+		rVec := autofunc.RVector{batchRes: make(linalg.Vector, len(batchRes.Vector))}
+		for i := range batchRes.Vector {
+			batchRes.Vector[i] = rand.NormFloat64()
+			rVec[batchRes][i] = rand.NormFloat64()
+		}
+		testBatcher(t, layer, batchRes, n, []*autofunc.Variable{batchRes})
+		testRBatcher(t, rVec, layer, autofunc.NewRVariable(batchRes, rVec),
+			n, []*autofunc.Variable{batchRes})
+	}
+}
+
+func TestUpsampleSerialize(t *testing.T) {
+	layer := &UpsampleLayer{
+		InputWidth:  3,
+		InputHeight: 4,
+		InputDepth:  5,
+		XScale:      2,
+		YScale:      3,
+		Mode:        UpsampleBilinear,
+	}
+	encoded, err := layer.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.GetDeserializer(layer.SerializerType())(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLayer, ok := decoded.(*UpsampleLayer)
+	if !ok {
+		t.Fatalf("expected *UpsampleLayer but got %T", decoded)
+	}
+	if *newLayer != *layer {
+		t.Errorf("expected %v but got %v", *layer, *newLayer)
+	}
+}
@@ -0,0 +1,411 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/seqfunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func init() {
+	var a Attention
+	serializer.RegisterTypedDeserializer(a.SerializerType(), DeserializeAttention)
+}
+
+// AttentionMode determines how an Attention scores the
+// compatibility between a query and a key.
+type AttentionMode int
+
+const (
+	// DotProductAttention scores keys by their dot product
+	// with the query, scaled by the inverse square root of
+	// the attention size, as described in
+	// https://arxiv.org/abs/1706.03762.
+	DotProductAttention AttentionMode = iota
+
+	// AdditiveAttention scores keys by feeding the sum of
+	// the query and the key through tanh and dotting the
+	// result with a learned vector, as described in
+	// https://arxiv.org/abs/1409.0473.
+	AdditiveAttention
+)
+
+// Attention is a seqfunc.RFunc which implements learned
+// attention over a sequence.
+//
+// When used as a seqfunc.RFunc, every time step of an
+// input sequence is used as a query, and the entire
+// input sequence is used as the memory which is attended
+// over (i.e. self-attention).
+// This makes it possible to put an Attention after an
+// encoder, such as a Bidirectional, to give every output
+// access to the entire encoded sequence.
+//
+// The Query, Key, and Value layers project queries and
+// memory vectors before they are used.
+// The output at each time step is the weighted sum of
+// the projected values, so its size is determined by the
+// output size of Value.
+type Attention struct {
+	Mode AttentionMode
+
+	Query *neuralnet.DenseLayer
+	Key   *neuralnet.DenseLayer
+	Value *neuralnet.DenseLayer
+
+	// Score is the vector which is dotted with the hidden
+	// scores in AdditiveAttention mode.
+	// It is nil for DotProductAttention.
+	Score *autofunc.Variable
+}
+
+// NewAttention creates an Attention with randomized
+// projections.
+//
+// The inputSize is the size of queries and memory vectors.
+// The attentionSize is the size of projected queries and
+// keys, and valueSize is the size of the outputs.
+func NewAttention(mode AttentionMode, inputSize, attentionSize,
+	valueSize int) *Attention {
+	res := &Attention{
+		Mode:  mode,
+		Query: neuralnet.NewDenseLayer(inputSize, attentionSize),
+		Key:   neuralnet.NewDenseLayer(inputSize, attentionSize),
+		Value: neuralnet.NewDenseLayer(inputSize, valueSize),
+	}
+	if mode == AdditiveAttention {
+		res.Score = &autofunc.Variable{Vector: make(linalg.Vector, attentionSize)}
+		scale := 1 / math.Sqrt(float64(attentionSize))
+		for i := range res.Score.Vector {
+			res.Score.Vector[i] = (rand.Float64()*2 - 1) * scale
+		}
+	}
+	return res
+}
+
+// DeserializeAttention deserializes an Attention.
+func DeserializeAttention(d []byte) (*Attention, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 4 && len(slice) != 5 {
+		return nil, errors.New("invalid slice length in Attention")
+	}
+	mode, ok := slice[0].(serializer.Int)
+	query, ok1 := slice[1].(*neuralnet.DenseLayer)
+	key, ok2 := slice[2].(*neuralnet.DenseLayer)
+	value, ok3 := slice[3].(*neuralnet.DenseLayer)
+	if !ok || !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("invalid types in Attention slice")
+	}
+	res := &Attention{
+		Mode:  AttentionMode(mode),
+		Query: query,
+		Key:   key,
+		Value: value,
+	}
+	if len(slice) == 5 {
+		scoreData, ok := slice[4].(serializer.Bytes)
+		if !ok {
+			return nil, errors.New("invalid score in Attention slice")
+		}
+		var score autofunc.Variable
+		if err := json.Unmarshal(scoreData, &score); err != nil {
+			return nil, errors.New("invalid score in Attention slice")
+		}
+		res.Score = &score
+	}
+	return res, nil
+}
+
+// ApplySeqs applies self-attention to each sequence.
+func (a *Attention) ApplySeqs(in seqfunc.Result) seqfunc.Result {
+	inSeqs := in.OutputSeqs()
+	res := &attentionResult{
+		Input:   in,
+		InPool:  make([][]*autofunc.Variable, len(inSeqs)),
+		Results: make([]autofunc.Result, len(inSeqs)),
+		Output:  make([][]linalg.Vector, len(inSeqs)),
+	}
+	for lane, seq := range inSeqs {
+		if len(seq) == 0 {
+			continue
+		}
+		var steps []autofunc.Result
+		for _, x := range seq {
+			v := &autofunc.Variable{Vector: x}
+			res.InPool[lane] = append(res.InPool[lane], v)
+			steps = append(steps, v)
+		}
+		out := a.Attend(steps, steps)
+		res.Results[lane] = out
+		res.Output[lane] = splitVectors(out.Output(), len(seq))
+	}
+	return res
+}
+
+// ApplySeqsR applies self-attention to each sequence.
+func (a *Attention) ApplySeqsR(rv autofunc.RVector, in seqfunc.RResult) seqfunc.RResult {
+	inSeqs := in.OutputSeqs()
+	inSeqsR := in.ROutputSeqs()
+	res := &attentionRResult{
+		Input:   in,
+		InPool:  make([][]*autofunc.Variable, len(inSeqs)),
+		Results: make([]autofunc.RResult, len(inSeqs)),
+		Output:  make([][]linalg.Vector, len(inSeqs)),
+		ROutput: make([][]linalg.Vector, len(inSeqs)),
+	}
+	for lane, seq := range inSeqs {
+		if len(seq) == 0 {
+			continue
+		}
+		var steps []autofunc.RResult
+		for t, x := range seq {
+			v := &autofunc.Variable{Vector: x}
+			res.InPool[lane] = append(res.InPool[lane], v)
+			steps = append(steps, &autofunc.RVariable{
+				Variable:   v,
+				ROutputVec: inSeqsR[lane][t],
+			})
+		}
+		out := a.AttendR(rv, steps, steps)
+		res.Results[lane] = out
+		res.Output[lane] = splitVectors(out.Output(), len(seq))
+		res.ROutput[lane] = splitVectors(out.ROutput(), len(seq))
+	}
+	return res
+}
+
+// Attend computes the attention output for each of the
+// queries, attending over the memory vectors.
+// The resulting outputs are packed one after another.
+//
+// The queries need not have the same size as the memory
+// vectors, provided that the Query layer is set up to
+// accept them.
+func (a *Attention) Attend(queries, memory []autofunc.Result) autofunc.Result {
+	n := len(memory)
+	joinedMem := autofunc.Concat(memory...)
+	keys := a.Key.Batch(joinedMem, n)
+	return autofunc.Pool(keys, func(keys autofunc.Result) autofunc.Result {
+		vals := a.Value.Batch(joinedMem, n)
+		return autofunc.Pool(vals, func(vals autofunc.Result) autofunc.Result {
+			keyList := autofunc.Split(n, keys)
+			valList := autofunc.Split(n, vals)
+			var outs []autofunc.Result
+			for _, query := range queries {
+				projected := a.Query.Apply(query)
+				var scores []autofunc.Result
+				for _, key := range keyList {
+					scores = append(scores, a.score(projected, key))
+				}
+				weights := (&autofunc.Softmax{}).Apply(autofunc.Concat(scores...))
+				var sum autofunc.Result
+				for i, val := range valList {
+					weighted := autofunc.ScaleFirst(val, autofunc.Slice(weights, i, i+1))
+					if sum == nil {
+						sum = weighted
+					} else {
+						sum = autofunc.Add(sum, weighted)
+					}
+				}
+				outs = append(outs, sum)
+			}
+			return autofunc.Concat(outs...)
+		})
+	})
+}
+
+// AttendR is like Attend, but with RResults.
+func (a *Attention) AttendR(rv autofunc.RVector, queries,
+	memory []autofunc.RResult) autofunc.RResult {
+	n := len(memory)
+	joinedMem := autofunc.ConcatR(memory...)
+	keys := a.Key.BatchR(rv, joinedMem, n)
+	return autofunc.PoolR(keys, func(keys autofunc.RResult) autofunc.RResult {
+		vals := a.Value.BatchR(rv, joinedMem, n)
+		return autofunc.PoolR(vals, func(vals autofunc.RResult) autofunc.RResult {
+			keyList := autofunc.SplitR(n, keys)
+			valList := autofunc.SplitR(n, vals)
+			var outs []autofunc.RResult
+			for _, query := range queries {
+				projected := a.Query.ApplyR(rv, query)
+				var scores []autofunc.RResult
+				for _, key := range keyList {
+					scores = append(scores, a.scoreR(rv, projected, key))
+				}
+				weights := (&autofunc.Softmax{}).ApplyR(rv, autofunc.ConcatR(scores...))
+				var sum autofunc.RResult
+				for i, val := range valList {
+					weighted := autofunc.ScaleFirstR(val, autofunc.SliceR(weights, i, i+1))
+					if sum == nil {
+						sum = weighted
+					} else {
+						sum = autofunc.AddR(sum, weighted)
+					}
+				}
+				outs = append(outs, sum)
+			}
+			return autofunc.ConcatR(outs...)
+		})
+	})
+}
+
+// Parameters returns the parameters of the projections,
+// followed by the score vector if there is one.
+func (a *Attention) Parameters() []*autofunc.Variable {
+	var res []*autofunc.Variable
+	for _, layer := range []*neuralnet.DenseLayer{a.Query, a.Key, a.Value} {
+		res = append(res, layer.Parameters()...)
+	}
+	if a.Score != nil {
+		res = append(res, a.Score)
+	}
+	return res
+}
+
+// SerializerType returns the unique ID used to serialize
+// an Attention with the serializer package.
+func (a *Attention) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.Attention"
+}
+
+// Serialize serializes the Attention.
+func (a *Attention) Serialize() ([]byte, error) {
+	slist := []serializer.Serializer{
+		serializer.Int(a.Mode),
+		a.Query,
+		a.Key,
+		a.Value,
+	}
+	if a.Score != nil {
+		data, err := json.Marshal(a.Score)
+		if err != nil {
+			return nil, err
+		}
+		slist = append(slist, serializer.Bytes(data))
+	}
+	return serializer.SerializeSlice(slist)
+}
+
+func (a *Attention) score(query, key autofunc.Result) autofunc.Result {
+	switch a.Mode {
+	case DotProductAttention:
+		scale := 1 / math.Sqrt(float64(len(key.Output())))
+		return autofunc.Scale(autofunc.SumAll(autofunc.Mul(query, key)), scale)
+	case AdditiveAttention:
+		hidden := (&neuralnet.HyperbolicTangent{}).Apply(autofunc.Add(query, key))
+		return autofunc.SumAll(autofunc.Mul(a.Score, hidden))
+	default:
+		panic("unknown attention mode")
+	}
+}
+
+func (a *Attention) scoreR(rv autofunc.RVector, query, key autofunc.RResult) autofunc.RResult {
+	switch a.Mode {
+	case DotProductAttention:
+		scale := 1 / math.Sqrt(float64(len(key.Output())))
+		return autofunc.ScaleR(autofunc.SumAllR(autofunc.MulR(query, key)), scale)
+	case AdditiveAttention:
+		hidden := (&neuralnet.HyperbolicTangent{}).ApplyR(rv, autofunc.AddR(query, key))
+		scoreVec := autofunc.NewRVariable(a.Score, rv)
+		return autofunc.SumAllR(autofunc.MulR(scoreVec, hidden))
+	default:
+		panic("unknown attention mode")
+	}
+}
+
+type attentionResult struct {
+	Input   seqfunc.Result
+	InPool  [][]*autofunc.Variable
+	Results []autofunc.Result
+	Output  [][]linalg.Vector
+}
+
+func (a *attentionResult) OutputSeqs() [][]linalg.Vector {
+	return a.Output
+}
+
+func (a *attentionResult) PropagateGradient(u [][]linalg.Vector, g autofunc.Gradient) {
+	for _, poolSeq := range a.InPool {
+		for _, poolVar := range poolSeq {
+			g[poolVar] = make(linalg.Vector, len(poolVar.Vector))
+		}
+	}
+	for lane, res := range a.Results {
+		if res != nil {
+			res.PropagateGradient(joinVecs(u[lane]), g)
+		}
+	}
+	downstream := make([][]linalg.Vector, len(a.InPool))
+	for i, poolSeq := range a.InPool {
+		downstream[i] = make([]linalg.Vector, len(poolSeq))
+		for j, poolVar := range poolSeq {
+			downstream[i][j] = g[poolVar]
+			delete(g, poolVar)
+		}
+	}
+	a.Input.PropagateGradient(downstream, g)
+}
+
+type attentionRResult struct {
+	Input   seqfunc.RResult
+	InPool  [][]*autofunc.Variable
+	Results []autofunc.RResult
+	Output  [][]linalg.Vector
+	ROutput [][]linalg.Vector
+}
+
+func (a *attentionRResult) OutputSeqs() [][]linalg.Vector {
+	return a.Output
+}
+
+func (a *attentionRResult) ROutputSeqs() [][]linalg.Vector {
+	return a.ROutput
+}
+
+func (a *attentionRResult) PropagateRGradient(u, uR [][]linalg.Vector, rg autofunc.RGradient,
+	g autofunc.Gradient) {
+	if g == nil {
+		g = autofunc.Gradient{}
+	}
+	for _, poolSeq := range a.InPool {
+		for _, poolVar := range poolSeq {
+			g[poolVar] = make(linalg.Vector, len(poolVar.Vector))
+			rg[poolVar] = make(linalg.Vector, len(poolVar.Vector))
+		}
+	}
+	for lane, res := range a.Results {
+		if res != nil {
+			res.PropagateRGradient(joinVecs(u[lane]), joinVecs(uR[lane]), rg, g)
+		}
+	}
+	downstream := make([][]linalg.Vector, len(a.InPool))
+	downstreamR := make([][]linalg.Vector, len(a.InPool))
+	for i, poolSeq := range a.InPool {
+		downstream[i] = make([]linalg.Vector, len(poolSeq))
+		downstreamR[i] = make([]linalg.Vector, len(poolSeq))
+		for j, poolVar := range poolSeq {
+			downstream[i][j] = g[poolVar]
+			downstreamR[i][j] = rg[poolVar]
+			delete(g, poolVar)
+			delete(rg, poolVar)
+		}
+	}
+	a.Input.PropagateRGradient(downstream, downstreamR, rg, g)
+}
+
+func joinVecs(vecs []linalg.Vector) linalg.Vector {
+	var res linalg.Vector
+	for _, v := range vecs {
+		res = append(res, v...)
+	}
+	return res
+}
@@ -28,6 +28,9 @@ func init() {
 // time steps.
 // Each time step fed into Output is packed with the
 // forward outputs followed by the backward outputs.
+//
+// To evaluate a Bidirectional on a live stream of frames,
+// use a BidirectionalStream.
 type Bidirectional struct {
 	Forward  seqfunc.RFunc
 	Backward seqfunc.RFunc
@@ -0,0 +1,171 @@
+package rnn
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/seqfunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// A BidirectionalStream evaluates a Bidirectional on a
+// stream of frames, emitting outputs with bounded
+// latency.
+//
+// Rather than running the backward RNN over the entire
+// sequence, the stream runs it over a sliding window of
+// future frames.
+// The output for a frame is emitted once Lookahead more
+// frames have been pushed, or when the stream is flushed.
+// If Lookahead is at least as long as the sequence, the
+// outputs are exactly those of the Bidirectional.
+//
+// The forward and output seqfunc.RFuncs are evaluated
+// one frame at a time.
+// This is efficient for BlockSeqFuncs and NetworkSeqFuncs.
+// Other seqfunc.RFuncs are re-evaluated on the entire
+// history for every frame.
+type BidirectionalStream struct {
+	bidir     *Bidirectional
+	lookahead int
+
+	forward seqStepper
+	output  seqStepper
+
+	// frames and forwardOuts store the inputs and
+	// forward outputs for every frame which has not been
+	// emitted yet, followed by the lookahead frames.
+	frames      []linalg.Vector
+	forwardOuts []linalg.Vector
+}
+
+// NewBidirectionalStream creates a BidirectionalStream
+// which lets the backward RNN see lookahead frames past
+// the frame it is computing an output for.
+func NewBidirectionalStream(b *Bidirectional, lookahead int) *BidirectionalStream {
+	return &BidirectionalStream{
+		bidir:     b,
+		lookahead: lookahead,
+		forward:   newSeqStepper(b.Forward),
+		output:    newSeqStepper(b.Output),
+	}
+}
+
+// Lookahead returns the number of future frames which
+// the backward RNN sees for each output.
+func (b *BidirectionalStream) Lookahead() int {
+	return b.lookahead
+}
+
+// Push adds a frame to the stream and returns the output
+// for the frame which is Lookahead frames in the past,
+// if there is such a frame.
+// The result is either empty or has one element.
+func (b *BidirectionalStream) Push(frame linalg.Vector) []linalg.Vector {
+	b.frames = append(b.frames, frame)
+	b.forwardOuts = append(b.forwardOuts, b.forward.Step(frame))
+	if len(b.frames) <= b.lookahead {
+		return nil
+	}
+	return []linalg.Vector{b.emit()}
+}
+
+// Flush returns the outputs for all of the frames which
+// have not been emitted yet, using whatever future frames
+// are available.
+// After Flush, the stream is reset so that it can be
+// used for a new sequence.
+func (b *BidirectionalStream) Flush() []linalg.Vector {
+	var res []linalg.Vector
+	for len(b.frames) > 0 {
+		res = append(res, b.emit())
+	}
+	b.Reset()
+	return res
+}
+
+// Reset discards all pending frames and goes back to
+// time 0.
+func (b *BidirectionalStream) Reset() {
+	b.frames = nil
+	b.forwardOuts = nil
+	b.forward.Reset()
+	b.output.Reset()
+}
+
+// emit computes the output for the first pending frame
+// and removes that frame.
+func (b *BidirectionalStream) emit() linalg.Vector {
+	window := len(b.frames)
+	if window > b.lookahead+1 {
+		window = b.lookahead + 1
+	}
+	reversed := make([]linalg.Vector, window)
+	for i := range reversed {
+		reversed[i] = b.frames[window-(i+1)]
+	}
+	backOuts := b.bidir.Backward.ApplySeqs(seqfunc.ConstResult([][]linalg.Vector{reversed}))
+	backSeq := backOuts.OutputSeqs()[0]
+	backOut := backSeq[len(backSeq)-1]
+
+	packed := make(linalg.Vector, 0, len(b.forwardOuts[0])+len(backOut))
+	packed = append(packed, b.forwardOuts[0]...)
+	packed = append(packed, backOut...)
+
+	b.frames = b.frames[1:]
+	b.forwardOuts = b.forwardOuts[1:]
+	return b.output.Step(packed)
+}
+
+// A seqStepper evaluates a seqfunc.RFunc one time step
+// at a time.
+type seqStepper interface {
+	Step(in linalg.Vector) linalg.Vector
+	Reset()
+}
+
+func newSeqStepper(f seqfunc.RFunc) seqStepper {
+	switch f := f.(type) {
+	case *BlockSeqFunc:
+		return &runnerStepper{Runner: Runner{Block: f.B}}
+	case *NetworkSeqFunc:
+		return networkStepper{Func: f}
+	default:
+		return &historyStepper{Func: f}
+	}
+}
+
+type runnerStepper struct {
+	Runner
+}
+
+func (r *runnerStepper) Step(in linalg.Vector) linalg.Vector {
+	return r.StepTime(in)
+}
+
+type networkStepper struct {
+	Func *NetworkSeqFunc
+}
+
+func (n networkStepper) Step(in linalg.Vector) linalg.Vector {
+	return n.Func.Network.Apply(&autofunc.Variable{Vector: in}).Output()
+}
+
+func (n networkStepper) Reset() {
+}
+
+// historyStepper evaluates an arbitrary seqfunc.RFunc by
+// re-running it on the entire history at every step.
+type historyStepper struct {
+	Func    seqfunc.RFunc
+	History []linalg.Vector
+}
+
+func (h *historyStepper) Step(in linalg.Vector) linalg.Vector {
+	h.History = append(h.History, in)
+	res := h.Func.ApplySeqs(seqfunc.ConstResult([][]linalg.Vector{h.History}))
+	outSeq := res.OutputSeqs()[0]
+	return outSeq[len(outSeq)-1]
+}
+
+func (h *historyStepper) Reset() {
+	h.History = nil
+}
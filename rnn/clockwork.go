@@ -0,0 +1,360 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func init() {
+	var c ClockworkRNN
+	serializer.RegisterTypedDeserializer(c.SerializerType(), DeserializeClockworkRNN)
+}
+
+// ClockworkRNN is a Block that implements a Clockwork
+// RNN, as defined in https://arxiv.org/abs/1402.3511.
+//
+// The hidden units are split up into modules, each with
+// its own clock period.
+// At time step t, a module is only updated if t is
+// divisible by its period; otherwise, it keeps its value
+// from the previous time step.
+// Each module receives recurrent connections from itself
+// and from the modules with longer periods.
+//
+// The output at each time step is the hidden state.
+type ClockworkRNN struct {
+	periods   []int
+	modules   []*neuralnet.DenseLayer
+	initState *autofunc.Variable
+}
+
+// NewClockworkRNN creates a ClockworkRNN with randomly
+// initialized weights.
+// There is one module of moduleSize hidden units for
+// each period, and the periods must be positive and in
+// ascending order (e.g. 1, 2, 4, 8).
+func NewClockworkRNN(inputSize, moduleSize int, periods []int) *ClockworkRNN {
+	for i, p := range periods {
+		if p <= 0 || (i > 0 && p < periods[i-1]) {
+			panic("periods must be positive and ascending")
+		}
+	}
+	res := &ClockworkRNN{
+		periods: append([]int{}, periods...),
+		initState: &autofunc.Variable{
+			Vector: make(linalg.Vector, moduleSize*len(periods)),
+		},
+	}
+	for i := range periods {
+		recurrentSize := moduleSize * (len(periods) - i)
+		dense := &neuralnet.DenseLayer{
+			InputCount:  inputSize + recurrentSize,
+			OutputCount: moduleSize,
+		}
+		dense.Randomize()
+		dense.Biases.Var.Vector.Scale(0)
+		res.modules = append(res.modules, dense)
+	}
+	return res
+}
+
+// DeserializeClockworkRNN deserializes a ClockworkRNN.
+func DeserializeClockworkRNN(d []byte) (*ClockworkRNN, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) < 2 {
+		return nil, errors.New("invalid slice length in ClockworkRNN")
+	}
+	periodData, ok1 := slice[0].(serializer.Bytes)
+	initStateData, ok2 := slice[len(slice)-1].(serializer.Bytes)
+	if !ok1 || !ok2 {
+		return nil, errors.New("invalid types in ClockworkRNN slice")
+	}
+	res := &ClockworkRNN{}
+	if err := json.Unmarshal(periodData, &res.periods); err != nil {
+		return nil, errors.New("invalid periods in ClockworkRNN slice")
+	}
+	if err := json.Unmarshal(initStateData, &res.initState); err != nil {
+		return nil, errors.New("invalid init state in ClockworkRNN slice")
+	}
+	for _, x := range slice[1 : len(slice)-1] {
+		dense, ok := x.(*neuralnet.DenseLayer)
+		if !ok {
+			return nil, errors.New("invalid types in ClockworkRNN slice")
+		}
+		res.modules = append(res.modules, dense)
+	}
+	if len(res.modules) != len(res.periods) {
+		return nil, errors.New("invalid module count in ClockworkRNN slice")
+	}
+	return res, nil
+}
+
+// StartState returns the trainable start state.
+func (c *ClockworkRNN) StartState() State {
+	return clockworkState{Vector: c.initState.Vector}
+}
+
+// StartRState is like StartState but with r-operators.
+func (c *ClockworkRNN) StartRState(rv autofunc.RVector) RState {
+	resVar := autofunc.NewRVariable(c.initState, rv)
+	return clockworkRState{
+		VecRState: VecRState{State: resVar.Output(), RState: resVar.ROutput()},
+	}
+}
+
+// PropagateStart propagates through the start state.
+func (c *ClockworkRNN) PropagateStart(_ []State, s []StateGrad, g autofunc.Gradient) {
+	PropagateVarState(c.initState, s, g)
+}
+
+// PropagateStartR propagates through the start state.
+func (c *ClockworkRNN) PropagateStartR(_ []RState, s []RStateGrad, rg autofunc.RGradient,
+	g autofunc.Gradient) {
+	PropagateVarStateR(c.initState, s, rg, g)
+}
+
+// ApplyBlock applies the block to an input.
+func (c *ClockworkRNN) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
+	n := len(in)
+	stateVars := make([]*autofunc.Variable, n)
+	stateRes := make([]autofunc.Result, n)
+	times := make([]int, n)
+	for i, x := range s {
+		state := x.(clockworkState)
+		stateVars[i] = &autofunc.Variable{Vector: state.Vector}
+		stateRes[i] = stateVars[i]
+		times[i] = state.Time
+	}
+	res := autofunc.PoolAll(in, func(in []autofunc.Result) autofunc.Result {
+		active := c.activeLanes(times)
+		var moduleOuts []autofunc.Result
+		for i, module := range c.modules {
+			if len(active[i]) == 0 {
+				continue
+			}
+			start := c.moduleStart(i)
+			var moduleIns []autofunc.Result
+			for _, lane := range active[i] {
+				moduleIns = append(moduleIns, in[lane],
+					autofunc.Slice(stateRes[lane], start, len(c.initState.Vector)))
+			}
+			preAct := module.Batch(autofunc.Concat(moduleIns...), len(active[i]))
+			moduleOuts = append(moduleOuts, neuralnet.HyperbolicTangent{}.Apply(preAct))
+		}
+		return autofunc.PoolAll(moduleOuts, func(moduleOuts []autofunc.Result) autofunc.Result {
+			var laneOuts []autofunc.Result
+			for lane := range in {
+				var outIdx int
+				for i := range c.modules {
+					start, end := c.moduleStart(i), c.moduleStart(i+1)
+					if len(active[i]) == 0 {
+						laneOuts = append(laneOuts, autofunc.Slice(stateRes[lane], start, end))
+						continue
+					}
+					if idx := indexOfInt(active[i], lane); idx >= 0 {
+						size := end - start
+						laneOuts = append(laneOuts,
+							autofunc.Slice(moduleOuts[outIdx], idx*size, (idx+1)*size))
+					} else {
+						laneOuts = append(laneOuts, autofunc.Slice(stateRes[lane], start, end))
+					}
+					outIdx++
+				}
+			}
+			return autofunc.Concat(laneOuts...)
+		})
+	})
+	return &clockworkResult{
+		gruResult: &gruResult{
+			InStates: stateVars,
+			Masks:    make([]*recurrentMasks, n),
+			Output:   res,
+		},
+		Times: times,
+	}
+}
+
+// ApplyBlockR applies the block to an input.
+func (c *ClockworkRNN) ApplyBlockR(rv autofunc.RVector, s []RState,
+	in []autofunc.RResult) BlockRResult {
+	n := len(in)
+	stateVars := make([]*autofunc.Variable, n)
+	stateRes := make([]autofunc.RResult, n)
+	times := make([]int, n)
+	for i, x := range s {
+		state := x.(clockworkRState)
+		stateVars[i] = &autofunc.Variable{Vector: state.State}
+		stateRes[i] = &autofunc.RVariable{
+			Variable:   stateVars[i],
+			ROutputVec: state.RState,
+		}
+		times[i] = state.Time
+	}
+	res := autofunc.PoolAllR(in, func(in []autofunc.RResult) autofunc.RResult {
+		active := c.activeLanes(times)
+		var moduleOuts []autofunc.RResult
+		for i, module := range c.modules {
+			if len(active[i]) == 0 {
+				continue
+			}
+			start := c.moduleStart(i)
+			var moduleIns []autofunc.RResult
+			for _, lane := range active[i] {
+				moduleIns = append(moduleIns, in[lane],
+					autofunc.SliceR(stateRes[lane], start, len(c.initState.Vector)))
+			}
+			preAct := module.BatchR(rv, autofunc.ConcatR(moduleIns...), len(active[i]))
+			moduleOuts = append(moduleOuts, neuralnet.HyperbolicTangent{}.ApplyR(rv, preAct))
+		}
+		return autofunc.PoolAllR(moduleOuts,
+			func(moduleOuts []autofunc.RResult) autofunc.RResult {
+				var laneOuts []autofunc.RResult
+				for lane := range in {
+					var outIdx int
+					for i := range c.modules {
+						start, end := c.moduleStart(i), c.moduleStart(i+1)
+						if len(active[i]) == 0 {
+							laneOuts = append(laneOuts, autofunc.SliceR(stateRes[lane], start, end))
+							continue
+						}
+						if idx := indexOfInt(active[i], lane); idx >= 0 {
+							size := end - start
+							laneOuts = append(laneOuts,
+								autofunc.SliceR(moduleOuts[outIdx], idx*size, (idx+1)*size))
+						} else {
+							laneOuts = append(laneOuts, autofunc.SliceR(stateRes[lane], start, end))
+						}
+						outIdx++
+					}
+				}
+				return autofunc.ConcatR(laneOuts...)
+			})
+	})
+	return &clockworkRResult{
+		gruRResult: &gruRResult{
+			InStates: stateVars,
+			Masks:    make([]*recurrentMasks, n),
+			Output:   res,
+		},
+		Times: times,
+	}
+}
+
+// Parameters returns the weights and biases of each
+// module (ordered from the shortest period to the
+// longest), followed by the initial state biases.
+func (c *ClockworkRNN) Parameters() []*autofunc.Variable {
+	var res []*autofunc.Variable
+	for _, module := range c.modules {
+		res = append(res, module.Parameters()...)
+	}
+	return append(res, c.initState)
+}
+
+// Serialize serializes the block.
+func (c *ClockworkRNN) Serialize() ([]byte, error) {
+	periodData, err := json.Marshal(c.periods)
+	if err != nil {
+		return nil, err
+	}
+	initData, err := json.Marshal(c.initState)
+	if err != nil {
+		return nil, err
+	}
+	slist := []serializer.Serializer{serializer.Bytes(periodData)}
+	for _, module := range c.modules {
+		slist = append(slist, module)
+	}
+	slist = append(slist, serializer.Bytes(initData))
+	return serializer.SerializeSlice(slist)
+}
+
+// SerializerType returns the unique ID used to serialize
+// a ClockworkRNN with the serializer package.
+func (c *ClockworkRNN) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.ClockworkRNN"
+}
+
+// activeLanes finds the lanes in which each module
+// should be updated.
+func (c *ClockworkRNN) activeLanes(times []int) [][]int {
+	res := make([][]int, len(c.periods))
+	for i, period := range c.periods {
+		for lane, t := range times {
+			if t%period == 0 {
+				res[i] = append(res[i], lane)
+			}
+		}
+	}
+	return res
+}
+
+// moduleStart returns the index of the first hidden unit
+// in the given module.
+func (c *ClockworkRNN) moduleStart(module int) int {
+	var res int
+	for _, m := range c.modules[:module] {
+		res += m.OutputCount
+	}
+	return res
+}
+
+// clockworkState is the State of a ClockworkRNN.
+// It keeps track of the time step so that the modules
+// can be updated on schedule.
+type clockworkState struct {
+	Vector linalg.Vector
+	Time   int
+}
+
+type clockworkRState struct {
+	VecRState
+	Time int
+}
+
+type clockworkResult struct {
+	*gruResult
+	Times []int
+}
+
+func (c *clockworkResult) States() []State {
+	var res []State
+	for i, stateVec := range c.Outputs() {
+		res = append(res, clockworkState{Vector: stateVec, Time: c.Times[i] + 1})
+	}
+	return res
+}
+
+type clockworkRResult struct {
+	*gruRResult
+	Times []int
+}
+
+func (c *clockworkRResult) RStates() []RState {
+	var res []RState
+	outsR := c.ROutputs()
+	for i, stateVec := range c.Outputs() {
+		res = append(res, clockworkRState{
+			VecRState: VecRState{State: stateVec, RState: outsR[i]},
+			Time:      c.Times[i] + 1,
+		})
+	}
+	return res
+}
+
+func indexOfInt(list []int, x int) int {
+	for i, y := range list {
+		if y == x {
+			return i
+		}
+	}
+	return -1
+}
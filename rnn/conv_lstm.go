@@ -0,0 +1,346 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func init() {
+	var c ConvLSTM
+	serializer.RegisterTypedDeserializer(c.SerializerType(), DeserializeConvLSTM)
+}
+
+// ConvLSTM is a Block that implements a convolutional
+// LSTM, as described in https://arxiv.org/abs/1506.04214.
+//
+// Inputs, hidden states, and cell states are all 3D
+// tensors with the same width and height, stored in the
+// format used by neuralnet.ConvLayer.
+// Each gate is computed by convolving the input and the
+// previous hidden state, rather than by applying dense
+// projections to them.
+type ConvLSTM struct {
+	inputValue   *convLSTMGate
+	inputGate    *convLSTMGate
+	rememberGate *convLSTMGate
+	outputGate   *convLSTMGate
+	initState    *autofunc.Variable
+}
+
+// NewConvLSTM creates a ConvLSTM with randomly
+// initialized filters.
+//
+// The input tensors are width by height by inDepth, and
+// the hidden and cell states are width by height by
+// hiddenDepth.
+// The filters are filterSize by filterSize, and they are
+// padded so that the spatial dimensions are preserved.
+// Thus, filterSize must be odd.
+func NewConvLSTM(width, height, inDepth, hiddenDepth, filterSize int) *ConvLSTM {
+	if filterSize%2 == 0 {
+		panic("filter size must be odd")
+	}
+	htan := &neuralnet.HyperbolicTangent{}
+	sigmoid := &neuralnet.Sigmoid{}
+	newGate := func(activation neuralnet.Layer) *convLSTMGate {
+		return newConvLSTMGate(width, height, inDepth, hiddenDepth, filterSize,
+			activation)
+	}
+	res := &ConvLSTM{
+		inputValue:   newGate(htan),
+		inputGate:    newGate(sigmoid),
+		rememberGate: newGate(sigmoid),
+		outputGate:   newGate(sigmoid),
+		initState: &autofunc.Variable{
+			Vector: make(linalg.Vector, 2*width*height*hiddenDepth),
+		},
+	}
+	for i := range res.rememberGate.Input.Biases.Vector {
+		res.rememberGate.Input.Biases.Vector[i] = initialRememberBias
+	}
+	return res
+}
+
+// DeserializeConvLSTM deserializes a ConvLSTM.
+func DeserializeConvLSTM(d []byte) (*ConvLSTM, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 9 {
+		return nil, errors.New("invalid slice length in ConvLSTM")
+	}
+	var convs []*neuralnet.ConvLayer
+	for _, x := range slice[:8] {
+		conv, ok := x.(*neuralnet.ConvLayer)
+		if !ok {
+			return nil, errors.New("invalid types in ConvLSTM slice")
+		}
+		convs = append(convs, conv)
+	}
+	initStateData, ok := slice[8].(serializer.Bytes)
+	if !ok {
+		return nil, errors.New("invalid types in ConvLSTM slice")
+	}
+	var initState autofunc.Variable
+	if err := json.Unmarshal(initStateData, &initState); err != nil {
+		return nil, err
+	}
+	htan := &neuralnet.HyperbolicTangent{}
+	sigmoid := &neuralnet.Sigmoid{}
+	return &ConvLSTM{
+		inputValue:   &convLSTMGate{Input: convs[0], Hidden: convs[1], Activation: htan},
+		inputGate:    &convLSTMGate{Input: convs[2], Hidden: convs[3], Activation: sigmoid},
+		rememberGate: &convLSTMGate{Input: convs[4], Hidden: convs[5], Activation: sigmoid},
+		outputGate:   &convLSTMGate{Input: convs[6], Hidden: convs[7], Activation: sigmoid},
+		initState:    &initState,
+	}, nil
+}
+
+// StartState returns the trainable start state.
+func (c *ConvLSTM) StartState() State {
+	return lstmState{
+		Internal: c.initState.Vector[:len(c.initState.Vector)/2],
+		Output:   c.initState.Vector[len(c.initState.Vector)/2:],
+	}
+}
+
+// StartRState is like StartState but with an RState.
+func (c *ConvLSTM) StartRState(rv autofunc.RVector) RState {
+	rVar := autofunc.NewRVariable(c.initState, rv)
+	return lstmRState{
+		Internal:  c.initState.Vector[:len(c.initState.Vector)/2],
+		InternalR: rVar.ROutputVec[:len(c.initState.Vector)/2],
+		Output:    c.initState.Vector[len(c.initState.Vector)/2:],
+		OutputR:   rVar.ROutputVec[len(c.initState.Vector)/2:],
+	}
+}
+
+// PropagateStart performs back-propagation through the
+// start state.
+func (c *ConvLSTM) PropagateStart(_ []State, s []StateGrad, g autofunc.Gradient) {
+	if vec, ok := g[c.initState]; ok {
+		for _, x := range s {
+			vec[:len(vec)/2].Add(x.(lstmState).Internal)
+			vec[len(vec)/2:].Add(x.(lstmState).Output)
+		}
+	}
+}
+
+// PropagateStartR is like PropagateStart but with
+// RStateGrads.
+func (c *ConvLSTM) PropagateStartR(_ []RState, s []RStateGrad, rg autofunc.RGradient,
+	g autofunc.Gradient) {
+	if g != nil {
+		if vec, ok := g[c.initState]; ok {
+			for _, x := range s {
+				vec[:len(vec)/2].Add(x.(lstmRState).Internal)
+				vec[len(vec)/2:].Add(x.(lstmRState).Output)
+			}
+		}
+	}
+	if vec, ok := rg[c.initState]; ok {
+		for _, x := range s {
+			vec[:len(vec)/2].Add(x.(lstmRState).InternalR)
+			vec[len(vec)/2:].Add(x.(lstmRState).OutputR)
+		}
+	}
+}
+
+// ApplyBlock applies the ConvLSTM to a batch of inputs.
+func (c *ConvLSTM) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
+	c.checkInputs(len(in), func(i int) int { return len(in[i].Output()) })
+	n := len(in)
+	var internalPool, lastOutPool []*autofunc.Variable
+	var internalResults, lastOutResults []autofunc.Result
+	for _, sObj := range s {
+		state := sObj.(lstmState)
+		internalVar := &autofunc.Variable{Vector: state.Internal}
+		lastOutVar := &autofunc.Variable{Vector: state.Output}
+		internalPool = append(internalPool, internalVar)
+		lastOutPool = append(lastOutPool, lastOutVar)
+		internalResults = append(internalResults, internalVar)
+		lastOutResults = append(lastOutResults, lastOutVar)
+	}
+	res := autofunc.PoolAll(in, func(in []autofunc.Result) autofunc.Result {
+		joinedIn := autofunc.Concat(in...)
+		lastOut := autofunc.Concat(lastOutResults...)
+
+		inValue := c.inputValue.Batch(joinedIn, lastOut, n)
+		inGate := c.inputGate.Batch(joinedIn, lastOut, n)
+		rememberGate := c.rememberGate.Batch(joinedIn, lastOut, n)
+		outGate := c.outputGate.Batch(joinedIn, lastOut, n)
+
+		lastState := autofunc.Concat(internalResults...)
+		newState := autofunc.Add(autofunc.Mul(rememberGate, lastState),
+			autofunc.Mul(inValue, inGate))
+
+		return autofunc.Pool(newState, func(newState autofunc.Result) autofunc.Result {
+			outValues := neuralnet.HyperbolicTangent{}.Apply(newState)
+			return autofunc.Concat(newState, autofunc.Mul(outGate, outValues))
+		})
+	})
+
+	states, outs := splitLSTMOutput(n, res.Output())
+	return &lstmResult{
+		CellStates:   states,
+		OutputVecs:   outs,
+		Masks:        make([]*recurrentMasks, n),
+		InternalPool: internalPool,
+		LastOutPool:  lastOutPool,
+		JoinedOut:    res,
+	}
+}
+
+// ApplyBlockR is like ApplyBlock, but with support for
+// the R operator.
+func (c *ConvLSTM) ApplyBlockR(rv autofunc.RVector, s []RState,
+	in []autofunc.RResult) BlockRResult {
+	c.checkInputs(len(in), func(i int) int { return len(in[i].Output()) })
+	n := len(in)
+	var internalPool, lastOutPool []*autofunc.Variable
+	var internalResults, lastOutResults []autofunc.RResult
+	for _, sObj := range s {
+		state := sObj.(lstmRState)
+		internalVar := &autofunc.Variable{Vector: state.Internal}
+		lastOutVar := &autofunc.Variable{Vector: state.Output}
+		internalPool = append(internalPool, internalVar)
+		lastOutPool = append(lastOutPool, lastOutVar)
+		internalResults = append(internalResults, &autofunc.RVariable{
+			Variable:   internalVar,
+			ROutputVec: state.InternalR,
+		})
+		lastOutResults = append(lastOutResults, &autofunc.RVariable{
+			Variable:   lastOutVar,
+			ROutputVec: state.OutputR,
+		})
+	}
+	res := autofunc.PoolAllR(in, func(in []autofunc.RResult) autofunc.RResult {
+		joinedIn := autofunc.ConcatR(in...)
+		lastOut := autofunc.ConcatR(lastOutResults...)
+
+		inValue := c.inputValue.BatchR(rv, joinedIn, lastOut, n)
+		inGate := c.inputGate.BatchR(rv, joinedIn, lastOut, n)
+		rememberGate := c.rememberGate.BatchR(rv, joinedIn, lastOut, n)
+		outGate := c.outputGate.BatchR(rv, joinedIn, lastOut, n)
+
+		lastState := autofunc.ConcatR(internalResults...)
+		newState := autofunc.AddR(autofunc.MulR(rememberGate, lastState),
+			autofunc.MulR(inValue, inGate))
+
+		return autofunc.PoolR(newState, func(newState autofunc.RResult) autofunc.RResult {
+			outValues := neuralnet.HyperbolicTangent{}.ApplyR(rv, newState)
+			return autofunc.ConcatR(newState, autofunc.MulR(outGate, outValues))
+		})
+	})
+
+	states, outs := splitLSTMOutput(n, res.Output())
+	statesR, outsR := splitLSTMOutput(n, res.ROutput())
+	return &lstmRResult{
+		CellStates:   states,
+		RCellStates:  statesR,
+		OutputVecs:   outs,
+		ROutputVecs:  outsR,
+		Masks:        make([]*recurrentMasks, n),
+		InternalPool: internalPool,
+		LastOutPool:  lastOutPool,
+		JoinedOut:    res,
+	}
+}
+
+// Parameters returns the ConvLSTM's parameters in the
+// following order: the input value, input gate, remember
+// gate, and output gate parameters, followed by the init
+// state biases.
+// For each gate, the parameters of the input convolution
+// come before those of the recurrent convolution.
+func (c *ConvLSTM) Parameters() []*autofunc.Variable {
+	var res []*autofunc.Variable
+	for _, gate := range c.gates() {
+		res = append(res, gate.Input.Parameters()...)
+		res = append(res, gate.Hidden.Parameters()...)
+	}
+	return append(res, c.initState)
+}
+
+// SerializerType returns the unique ID used to serialize
+// a ConvLSTM with the serializer package.
+func (c *ConvLSTM) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.ConvLSTM"
+}
+
+// Serialize serializes the ConvLSTM.
+func (c *ConvLSTM) Serialize() ([]byte, error) {
+	initData, err := json.Marshal(c.initState)
+	if err != nil {
+		return nil, err
+	}
+	var slist []serializer.Serializer
+	for _, gate := range c.gates() {
+		slist = append(slist, gate.Input, gate.Hidden)
+	}
+	slist = append(slist, serializer.Bytes(initData))
+	return serializer.SerializeSlice(slist)
+}
+
+func (c *ConvLSTM) gates() []*convLSTMGate {
+	return []*convLSTMGate{c.inputValue, c.inputGate, c.rememberGate, c.outputGate}
+}
+
+func (c *ConvLSTM) checkInputs(n int, size func(i int) int) {
+	conv := c.inputGate.Input
+	expected := conv.InputWidth * conv.InputHeight * conv.InputDepth
+	for i := 0; i < n; i++ {
+		if size(i) != expected {
+			panic(fmt.Sprintf("bad input length %d (expected %d)", size(i), expected))
+		}
+	}
+}
+
+type convLSTMGate struct {
+	Input      *neuralnet.ConvLayer
+	Hidden     *neuralnet.ConvLayer
+	Activation neuralnet.Layer
+}
+
+func newConvLSTMGate(width, height, inDepth, hiddenDepth, filterSize int,
+	activation neuralnet.Layer) *convLSTMGate {
+	newConv := func(depth int) *neuralnet.ConvLayer {
+		res := &neuralnet.ConvLayer{
+			FilterCount:  hiddenDepth,
+			FilterWidth:  filterSize,
+			FilterHeight: filterSize,
+			Stride:       1,
+			PaddingX:     filterSize / 2,
+			PaddingY:     filterSize / 2,
+			InputWidth:   width,
+			InputHeight:  height,
+			InputDepth:   depth,
+		}
+		res.Randomize()
+		res.Biases.Vector.Scale(0)
+		return res
+	}
+	return &convLSTMGate{
+		Input:      newConv(inDepth),
+		Hidden:     newConv(hiddenDepth),
+		Activation: activation,
+	}
+}
+
+func (c *convLSTMGate) Batch(in, hidden autofunc.Result, n int) autofunc.Result {
+	sum := autofunc.Add(c.Input.Batch(in, n), c.Hidden.Batch(hidden, n))
+	return c.Activation.Apply(sum)
+}
+
+func (c *convLSTMGate) BatchR(rv autofunc.RVector, in, hidden autofunc.RResult,
+	n int) autofunc.RResult {
+	sum := autofunc.AddR(c.Input.BatchR(rv, in, n), c.Hidden.BatchR(rv, hidden, n))
+	return c.Activation.ApplyR(rv, sum)
+}
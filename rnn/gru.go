@@ -23,6 +23,30 @@ type GRU struct {
 	resetGate  *lstmGate
 	updateGate *lstmGate
 	initState  *autofunc.Variable
+
+	// RecurrentDropout is the probability of dropping
+	// each component of the previous state when it is
+	// fed into the gates.
+	// The dropout mask is chosen once per sequence, when
+	// StartState or StartRState is called, and is then
+	// held fixed across time steps.
+	//
+	// When RecurrentDropout or Zoneout is non-zero, the
+	// GRU's states are no longer VecStates.
+	RecurrentDropout float64
+
+	// Zoneout is the probability that each component of
+	// the state keeps its previous value rather than
+	// being updated.
+	// Like the dropout mask, the zoneout mask is chosen
+	// once per sequence.
+	Zoneout float64
+
+	// Training is true if the dropout and zoneout masks
+	// should be random.
+	// Otherwise, the masks are replaced by their expected
+	// values.
+	Training bool
 }
 
 // NewGRU creates a GRU with randomly initialized
@@ -47,7 +71,7 @@ func DeserializeGRU(d []byte) (*GRU, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(slice) != 5 {
+	if len(slice) != 5 && len(slice) != 6 {
 		return nil, errors.New("invalid slice length in GRU")
 	}
 	hiddenSize, ok := slice[0].(serializer.Int)
@@ -62,24 +86,44 @@ func DeserializeGRU(d []byte) (*GRU, error) {
 	if err := json.Unmarshal(initStateData, &initState); err != nil {
 		return nil, errors.New("invalid init state in GRU slice")
 	}
+	var regInfo recurrentRegInfo
+	if len(slice) == 6 {
+		regData, ok := slice[5].(serializer.Bytes)
+		if !ok {
+			return nil, errors.New("invalid types in GRU slice")
+		}
+		if err := json.Unmarshal(regData, &regInfo); err != nil {
+			return nil, errors.New("invalid regularization info in GRU slice")
+		}
+	}
 	return &GRU{
-		hiddenSize: int(hiddenSize),
-		inputValue: inputValue,
-		resetGate:  resetGate,
-		updateGate: updateGate,
-		initState:  &initState,
+		hiddenSize:       int(hiddenSize),
+		inputValue:       inputValue,
+		resetGate:        resetGate,
+		updateGate:       updateGate,
+		initState:        &initState,
+		RecurrentDropout: regInfo.RecurrentDropout,
+		Zoneout:          regInfo.Zoneout,
+		Training:         regInfo.Training,
 	}, nil
 }
 
 // StartState returns the trainable start state.
 func (g *GRU) StartState() State {
+	if masks := g.newMasks(); masks != nil {
+		return gruState{Vector: g.initState.Vector, Masks: masks}
+	}
 	return VecState(g.initState.Vector)
 }
 
 // StartRState is like StartState but with r-operators.
 func (g *GRU) StartRState(rv autofunc.RVector) RState {
 	resVar := autofunc.NewRVariable(g.initState, rv)
-	return VecRState{State: resVar.Output(), RState: resVar.ROutput()}
+	vecState := VecRState{State: resVar.Output(), RState: resVar.ROutput()}
+	if masks := g.newMasks(); masks != nil {
+		return gruRState{VecRState: vecState, Masks: masks}
+	}
+	return vecState
 }
 
 // PropagateStart propagates through the start state.
@@ -95,10 +139,12 @@ func (g *GRU) PropagateStartR(_ []RState, s []RStateGrad, rg autofunc.RGradient,
 
 // ApplyBlock applies the block to an input.
 func (g *GRU) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
-	stateVars, stateRes := PoolVecStates(s)
-	var gateInputs []autofunc.Result
+	stateVars, stateRes, masks := poolGRUStates(s)
+	var gateInputs, droppedStates []autofunc.Result
 	for i, x := range stateRes {
-		gateInputs = append(gateInputs, in[i], x)
+		dropped := applyDropout(x, masks[i].dropoutVar())
+		gateInputs = append(gateInputs, in[i], dropped)
+		droppedStates = append(droppedStates, dropped)
 	}
 	n := len(in)
 
@@ -108,7 +154,7 @@ func (g *GRU) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
 	resetMask := g.resetGate.Batch(gateInput, n)
 	updateMask := g.updateGate.Batch(gateInput, n)
 
-	maskedByReset := autofunc.Mul(resetMask, stateIn)
+	maskedByReset := autofunc.Mul(resetMask, autofunc.Concat(droppedStates...))
 	inputValue := autofunc.PoolSplit(n, maskedByReset,
 		func(newStates []autofunc.Result) autofunc.Result {
 			var newGateInputs []autofunc.Result
@@ -124,19 +170,23 @@ func (g *GRU) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
 		return autofunc.Add(autofunc.Mul(umask, stateIn),
 			autofunc.Mul(updateComplement, inputValue))
 	})
+	newState = applyZoneout(joinZoneout(masks, g.hiddenSize), stateIn, newState)
 
 	return &gruResult{
 		InStates: stateVars,
+		Masks:    masks,
 		Output:   newState,
 	}
 }
 
 // ApplyBlockR applies the block to an input.
 func (g *GRU) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResult) BlockRResult {
-	stateVars, stateRes := PoolVecRStates(s)
-	var gateInputs []autofunc.RResult
+	stateVars, stateRes, masks := poolGRURStates(s)
+	var gateInputs, droppedStates []autofunc.RResult
 	for i, x := range stateRes {
-		gateInputs = append(gateInputs, in[i], x)
+		dropped := applyDropoutR(rv, x, masks[i].dropoutVar())
+		gateInputs = append(gateInputs, in[i], dropped)
+		droppedStates = append(droppedStates, dropped)
 	}
 	n := len(in)
 
@@ -146,7 +196,7 @@ func (g *GRU) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResult
 	resetMask := g.resetGate.BatchR(rv, gateInput, n)
 	updateMask := g.updateGate.BatchR(rv, gateInput, n)
 
-	maskedByReset := autofunc.MulR(resetMask, stateIn)
+	maskedByReset := autofunc.MulR(resetMask, autofunc.ConcatR(droppedStates...))
 	inputValue := autofunc.PoolSplitR(n, maskedByReset,
 		func(newStates []autofunc.RResult) autofunc.RResult {
 			var newGateInputs []autofunc.RResult
@@ -162,9 +212,11 @@ func (g *GRU) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResult
 		return autofunc.AddR(autofunc.MulR(umask, stateIn),
 			autofunc.MulR(updateComplement, inputValue))
 	})
+	newState = applyZoneoutR(rv, joinZoneout(masks, g.hiddenSize), stateIn, newState)
 
 	return &gruRResult{
 		InStates: stateVars,
+		Masks:    masks,
 		Output:   newState,
 	}
 }
@@ -199,6 +251,14 @@ func (g *GRU) Serialize() ([]byte, error) {
 		g.updateGate,
 		serializer.Bytes(initData),
 	}
+	slist, err = serializeRegInfo(slist, recurrentRegInfo{
+		RecurrentDropout: g.RecurrentDropout,
+		Zoneout:          g.Zoneout,
+		Training:         g.Training,
+	})
+	if err != nil {
+		return nil, err
+	}
 	return serializer.SerializeSlice(slist)
 }
 
@@ -208,8 +268,67 @@ func (g *GRU) SerializerType() string {
 	return "github.com/unixpickle/weakai/rnn.GRU"
 }
 
+func (g *GRU) newMasks() *recurrentMasks {
+	return newRecurrentMasks(g.RecurrentDropout, g.Zoneout, g.Training,
+		g.hiddenSize, g.hiddenSize)
+}
+
+// gruState is the State of a GRU which uses dropout or
+// zoneout.
+type gruState struct {
+	Vector linalg.Vector
+	Masks  *recurrentMasks
+}
+
+// gruRState is the RState of a GRU which uses dropout or
+// zoneout.
+type gruRState struct {
+	VecRState
+	Masks *recurrentMasks
+}
+
+// poolGRUStates is like PoolVecStates, but it also
+// accepts gruStates and extracts their masks.
+func poolGRUStates(s []State) ([]*autofunc.Variable, []autofunc.Result,
+	[]*recurrentMasks) {
+	vars := make([]*autofunc.Variable, len(s))
+	reses := make([]autofunc.Result, len(s))
+	masks := make([]*recurrentMasks, len(s))
+	for i, x := range s {
+		var vec linalg.Vector
+		switch x := x.(type) {
+		case gruState:
+			vec = x.Vector
+			masks[i] = x.Masks
+		default:
+			vec = linalg.Vector(x.(VecState))
+		}
+		vars[i] = &autofunc.Variable{Vector: vec}
+		reses[i] = vars[i]
+	}
+	return vars, reses, masks
+}
+
+// poolGRURStates is like poolGRUStates for RStates.
+func poolGRURStates(s []RState) ([]*autofunc.Variable, []autofunc.RResult,
+	[]*recurrentMasks) {
+	vecStates := make([]RState, len(s))
+	masks := make([]*recurrentMasks, len(s))
+	for i, x := range s {
+		if gs, ok := x.(gruRState); ok {
+			vecStates[i] = gs.VecRState
+			masks[i] = gs.Masks
+		} else {
+			vecStates[i] = x
+		}
+	}
+	vars, reses := PoolVecRStates(vecStates)
+	return vars, reses, masks
+}
+
 type gruResult struct {
 	InStates []*autofunc.Variable
+	Masks    []*recurrentMasks
 	Output   autofunc.Result
 }
 
@@ -219,8 +338,12 @@ func (g *gruResult) Outputs() []linalg.Vector {
 
 func (g *gruResult) States() []State {
 	var res []State
-	for _, stateVec := range g.Outputs() {
-		res = append(res, VecState(stateVec))
+	for i, stateVec := range g.Outputs() {
+		if g.Masks[i] != nil {
+			res = append(res, gruState{Vector: stateVec, Masks: g.Masks[i]})
+		} else {
+			res = append(res, VecState(stateVec))
+		}
 	}
 	return res
 }
@@ -248,6 +371,7 @@ func (g *gruResult) PropagateGradient(u []linalg.Vector, s []StateGrad,
 
 type gruRResult struct {
 	InStates []*autofunc.Variable
+	Masks    []*recurrentMasks
 	Output   autofunc.RResult
 }
 
@@ -263,7 +387,12 @@ func (g *gruRResult) RStates() []RState {
 	var res []RState
 	outsR := g.ROutputs()
 	for i, stateVec := range g.Outputs() {
-		res = append(res, VecRState{State: stateVec, RState: outsR[i]})
+		vecState := VecRState{State: stateVec, RState: outsR[i]}
+		if g.Masks[i] != nil {
+			res = append(res, gruRState{VecRState: vecState, Masks: g.Masks[i]})
+		} else {
+			res = append(res, vecState)
+		}
 	}
 	return res
 }
@@ -31,6 +31,27 @@ type LSTM struct {
 	rememberGate *lstmGate
 	outputGate   *lstmGate
 	initState    *autofunc.Variable
+
+	// RecurrentDropout is the probability of dropping
+	// each component of the previous output when it is
+	// fed back into the gates.
+	// The dropout mask is chosen once per sequence, when
+	// StartState or StartRState is called, and is then
+	// held fixed across time steps.
+	RecurrentDropout float64
+
+	// Zoneout is the probability that each component of
+	// the cell state and output keeps its previous value
+	// rather than being updated.
+	// Like the dropout mask, the zoneout mask is chosen
+	// once per sequence.
+	Zoneout float64
+
+	// Training is true if the dropout and zoneout masks
+	// should be random.
+	// Otherwise, the masks are replaced by their expected
+	// values.
+	Training bool
 }
 
 // NewLSTM creates an LSTM with randomly initialized
@@ -52,13 +73,27 @@ func NewLSTM(inputSize, hiddenSize int) *LSTM {
 	return res
 }
 
+// NewLayerNormLSTM creates an LSTM which applies layer
+// normalization (see neuralnet.LayerNormLayer) to the
+// pre-activation of every gate.
+// Aside from this, it is exactly like an LSTM created
+// with NewLSTM.
+func NewLayerNormLSTM(inputSize, hiddenSize int) *LSTM {
+	res := NewLSTM(inputSize, hiddenSize)
+	for _, gate := range res.gates() {
+		gate.Norm = neuralnet.NewLayerNormLayer(hiddenSize)
+	}
+	res.prioritizeRemembering()
+	return res
+}
+
 // DeserializeLSTM deserializes an LSTM.
 func DeserializeLSTM(d []byte) (*LSTM, error) {
 	slice, err := serializer.DeserializeSlice(d)
 	if err != nil {
 		return nil, err
 	}
-	if len(slice) != 6 {
+	if len(slice) != 6 && len(slice) != 7 {
 		return nil, errors.New("invalid slice length in LSTM")
 	}
 	hiddenSize, ok := slice[0].(serializer.Int)
@@ -74,13 +109,26 @@ func DeserializeLSTM(d []byte) (*LSTM, error) {
 	if err := json.Unmarshal(initStateData, &initState); err != nil {
 		return nil, err
 	}
+	var regInfo recurrentRegInfo
+	if len(slice) == 7 {
+		regData, ok := slice[6].(serializer.Bytes)
+		if !ok {
+			return nil, errors.New("invalid types in LSTM slice")
+		}
+		if err := json.Unmarshal(regData, &regInfo); err != nil {
+			return nil, err
+		}
+	}
 	return &LSTM{
-		hiddenSize:   int(hiddenSize),
-		inputValue:   inputValue,
-		inputGate:    inputGate,
-		rememberGate: rememberGate,
-		outputGate:   outputGate,
-		initState:    &initState,
+		hiddenSize:       int(hiddenSize),
+		inputValue:       inputValue,
+		inputGate:        inputGate,
+		rememberGate:     rememberGate,
+		outputGate:       outputGate,
+		initState:        &initState,
+		RecurrentDropout: regInfo.RecurrentDropout,
+		Zoneout:          regInfo.Zoneout,
+		Training:         regInfo.Training,
 	}, nil
 }
 
@@ -89,6 +137,7 @@ func (l *LSTM) StartState() State {
 	return lstmState{
 		Internal: l.initState.Vector[:len(l.initState.Vector)/2],
 		Output:   l.initState.Vector[len(l.initState.Vector)/2:],
+		Masks:    l.newMasks(),
 	}
 }
 
@@ -100,6 +149,7 @@ func (l *LSTM) StartRState(rv autofunc.RVector) RState {
 		InternalR: rVar.ROutputVec[:len(l.initState.Vector)/2],
 		Output:    l.initState.Vector[len(l.initState.Vector)/2:],
 		OutputR:   rVar.ROutputVec[len(l.initState.Vector)/2:],
+		Masks:     l.newMasks(),
 	}
 }
 
@@ -143,19 +193,24 @@ func (l *LSTM) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
 		}
 	}
 	var internalPool, lastOutPool []*autofunc.Variable
+	masks := make([]*recurrentMasks, len(s))
 	res := autofunc.PoolAll(in, func(in []autofunc.Result) autofunc.Result {
 		var weavedInputs []autofunc.Result
-		var internalResults []autofunc.Result
+		var internalResults, lastOutResults, droppedOuts []autofunc.Result
 		for i, sObj := range s {
 			state := sObj.(lstmState)
 			internalVar := &autofunc.Variable{Vector: state.Internal}
 			lastOutVar := &autofunc.Variable{Vector: state.Output}
+			masks[i] = state.Masks
 
 			internalPool = append(internalPool, internalVar)
 			lastOutPool = append(lastOutPool, lastOutVar)
 
-			weavedInputs = append(weavedInputs, in[i], lastOutVar, internalVar)
+			droppedOut := applyDropout(lastOutVar, state.Masks.dropoutVar())
+			droppedOuts = append(droppedOuts, droppedOut)
+			weavedInputs = append(weavedInputs, in[i], droppedOut, internalVar)
 			internalResults = append(internalResults, internalVar)
+			lastOutResults = append(lastOutResults, lastOutVar)
 		}
 
 		gateIn := autofunc.Concat(weavedInputs...)
@@ -167,22 +222,29 @@ func (l *LSTM) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
 		newState := autofunc.Add(autofunc.Mul(rememberGate, lastState),
 			autofunc.Mul(inValue, inGate))
 
-		return autofunc.Pool(newState, func(newState autofunc.Result) autofunc.Result {
+		joined := autofunc.Pool(newState, func(newState autofunc.Result) autofunc.Result {
 			var newWeaved []autofunc.Result
 			for i, state := range autofunc.Split(len(in), newState) {
-				newWeaved = append(newWeaved, in[i], lastOutPool[i], state)
+				newWeaved = append(newWeaved, in[i], droppedOuts[i], state)
 			}
 			newGateIn := autofunc.Concat(newWeaved...)
 			outGate := l.outputGate.Batch(newGateIn, len(in))
 			outValues := neuralnet.HyperbolicTangent{}.Apply(newState)
 			return autofunc.Concat(newState, autofunc.Mul(outGate, outValues))
 		})
+		zoneMask := l.joinZoneout(masks)
+		if zoneMask == nil {
+			return joined
+		}
+		lastJoined := autofunc.Concat(append(internalResults, lastOutResults...)...)
+		return applyZoneout(zoneMask, lastJoined, joined)
 	})
 
 	states, outs := splitLSTMOutput(len(in), res.Output())
 	return &lstmResult{
 		CellStates:   states,
 		OutputVecs:   outs,
+		Masks:        masks,
 		InternalPool: internalPool,
 		LastOutPool:  lastOutPool,
 		JoinedOut:    res,
@@ -199,14 +261,15 @@ func (l *LSTM) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResul
 		}
 	}
 	var internalPool, lastOutPool []*autofunc.Variable
+	masks := make([]*recurrentMasks, len(s))
 	res := autofunc.PoolAllR(in, func(in []autofunc.RResult) autofunc.RResult {
-		var lastOutPoolR []*autofunc.RVariable
 		var weavedInputs []autofunc.RResult
-		var internalResults []autofunc.RResult
+		var internalResults, lastOutResults, droppedOuts []autofunc.RResult
 		for i, sObj := range s {
 			state := sObj.(lstmRState)
 			internalVar := &autofunc.Variable{Vector: state.Internal}
 			lastOutVar := &autofunc.Variable{Vector: state.Output}
+			masks[i] = state.Masks
 
 			internalPool = append(internalPool, internalVar)
 			lastOutPool = append(lastOutPool, lastOutVar)
@@ -220,9 +283,11 @@ func (l *LSTM) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResul
 				ROutputVec: state.OutputR,
 			}
 
-			lastOutPoolR = append(lastOutPoolR, lastOutR)
-			weavedInputs = append(weavedInputs, in[i], lastOutR, internalR)
+			droppedOut := applyDropoutR(rv, lastOutR, state.Masks.dropoutVar())
+			droppedOuts = append(droppedOuts, droppedOut)
+			weavedInputs = append(weavedInputs, in[i], droppedOut, internalR)
 			internalResults = append(internalResults, internalR)
+			lastOutResults = append(lastOutResults, lastOutR)
 		}
 
 		gateIn := autofunc.ConcatR(weavedInputs...)
@@ -234,16 +299,22 @@ func (l *LSTM) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResul
 		newState := autofunc.AddR(autofunc.MulR(rememberGate, lastState),
 			autofunc.MulR(inValue, inGate))
 
-		return autofunc.PoolR(newState, func(newState autofunc.RResult) autofunc.RResult {
+		joined := autofunc.PoolR(newState, func(newState autofunc.RResult) autofunc.RResult {
 			var newWeaved []autofunc.RResult
 			for i, state := range autofunc.SplitR(len(in), newState) {
-				newWeaved = append(newWeaved, in[i], lastOutPoolR[i], state)
+				newWeaved = append(newWeaved, in[i], droppedOuts[i], state)
 			}
 			newGateIn := autofunc.ConcatR(newWeaved...)
 			outGate := l.outputGate.BatchR(rv, newGateIn, len(in))
 			outValues := neuralnet.HyperbolicTangent{}.ApplyR(rv, newState)
 			return autofunc.ConcatR(newState, autofunc.MulR(outGate, outValues))
 		})
+		zoneMask := l.joinZoneout(masks)
+		if zoneMask == nil {
+			return joined
+		}
+		lastJoined := autofunc.ConcatR(append(internalResults, lastOutResults...)...)
+		return applyZoneoutR(rv, zoneMask, lastJoined, joined)
 	})
 
 	states, outs := splitLSTMOutput(len(in), res.Output())
@@ -253,6 +324,7 @@ func (l *LSTM) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResul
 		RCellStates:  statesR,
 		OutputVecs:   outs,
 		ROutputVecs:  outsR,
+		Masks:        masks,
 		InternalPool: internalPool,
 		LastOutPool:  lastOutPool,
 		JoinedOut:    res,
@@ -266,8 +338,12 @@ func (l *LSTM) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResul
 // weights, output gate biases, init state biases,
 // input peephole, input gate peephole, remember gate
 // peephole, output gate peephole.
+//
+// For a layer-normalized LSTM, these are followed by
+// the gains and biases of the input, input gate,
+// remember gate, and output gate normalizations.
 func (l *LSTM) Parameters() []*autofunc.Variable {
-	return []*autofunc.Variable{
+	res := []*autofunc.Variable{
 		l.inputValue.Dense.Weights.Data,
 		l.inputValue.Dense.Biases.Var,
 		l.inputGate.Dense.Weights.Data,
@@ -282,6 +358,12 @@ func (l *LSTM) Parameters() []*autofunc.Variable {
 		l.rememberGate.Peephole,
 		l.outputGate.Peephole,
 	}
+	for _, gate := range l.gates() {
+		if gate.Norm != nil {
+			res = append(res, gate.Norm.Parameters()...)
+		}
+	}
+	return res
 }
 
 // SerializerType returns the unique ID used to serialize
@@ -304,16 +386,57 @@ func (l *LSTM) Serialize() ([]byte, error) {
 		l.outputGate,
 		serializer.Bytes(initData),
 	}
+	slist, err = serializeRegInfo(slist, recurrentRegInfo{
+		RecurrentDropout: l.RecurrentDropout,
+		Zoneout:          l.Zoneout,
+		Training:         l.Training,
+	})
+	if err != nil {
+		return nil, err
+	}
 	return serializer.SerializeSlice(slist)
 }
 
 func (l *LSTM) prioritizeRemembering() {
 	rememberBiases := l.rememberGate.Dense.Biases.Var.Vector
+	if l.rememberGate.Norm != nil {
+		// The normalization would cancel out the
+		// dense layer's biases.
+		rememberBiases = l.rememberGate.Norm.Biases.Vector
+	}
 	for i := range rememberBiases {
 		rememberBiases[i] = initialRememberBias
 	}
 }
 
+func (l *LSTM) newMasks() *recurrentMasks {
+	return newRecurrentMasks(l.RecurrentDropout, l.Zoneout, l.Training,
+		l.hiddenSize, l.hiddenSize*2)
+}
+
+// joinZoneout arranges the zoneout masks for a batch of
+// lanes to match the layout of a joined LSTM output, in
+// which all of the cell states come before all of the
+// outputs.
+func (l *LSTM) joinZoneout(masks []*recurrentMasks) linalg.Vector {
+	joined := joinZoneout(masks, l.hiddenSize*2)
+	if joined == nil {
+		return nil
+	}
+	n := len(masks)
+	h := l.hiddenSize
+	res := make(linalg.Vector, len(joined))
+	for i := 0; i < n; i++ {
+		copy(res[i*h:(i+1)*h], joined[2*i*h:(2*i+1)*h])
+		copy(res[(i+n)*h:(i+n+1)*h], joined[(2*i+1)*h:(2*i+2)*h])
+	}
+	return res
+}
+
+func (l *LSTM) gates() []*lstmGate {
+	return []*lstmGate{l.inputValue, l.inputGate, l.rememberGate, l.outputGate}
+}
+
 func (l *LSTM) inputSize() int {
 	return l.inputGate.Dense.InputCount - l.inputGate.Dense.OutputCount
 }
@@ -321,6 +444,10 @@ func (l *LSTM) inputSize() int {
 type lstmState struct {
 	Output   linalg.Vector
 	Internal linalg.Vector
+
+	// Masks is nil for gradients and for LSTMs without
+	// dropout or zoneout.
+	Masks *recurrentMasks
 }
 
 type lstmRState struct {
@@ -328,12 +455,18 @@ type lstmRState struct {
 	OutputR   linalg.Vector
 	Internal  linalg.Vector
 	InternalR linalg.Vector
+
+	Masks *recurrentMasks
 }
 
 type lstmGate struct {
 	Dense      *neuralnet.DenseLayer
 	Peephole   *autofunc.Variable
 	Activation neuralnet.Layer
+
+	// Norm is used to normalize the pre-activation in
+	// layer-normalized LSTMs, and is nil otherwise.
+	Norm *neuralnet.LayerNormLayer
 }
 
 func newLSTMGate(inputSize, hidden int, peephole bool, activation neuralnet.Layer) *lstmGate {
@@ -360,7 +493,7 @@ func deserializeLSTMGate(d []byte) (*lstmGate, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(list) != 2 && len(list) != 3 {
+	if len(list) < 2 || len(list) > 4 {
 		return nil, errors.New("invalid slice length for LSTM gate")
 	}
 	dense, ok := list[0].(*neuralnet.DenseLayer)
@@ -369,21 +502,30 @@ func deserializeLSTMGate(d []byte) (*lstmGate, error) {
 		return nil, errors.New("invalid types for LSTM gate slice")
 	}
 	res := &lstmGate{Dense: dense, Activation: activ}
-	if len(list) == 3 {
-		peephole, ok := list[2].(serializer.Bytes)
-		if !ok {
+	for _, extra := range list[2:] {
+		switch extra := extra.(type) {
+		case serializer.Bytes:
+			if res.Peephole != nil {
+				return nil, errors.New("invalid types for LSTM gate slice")
+			}
+			if err := json.Unmarshal(extra, &res.Peephole); err != nil {
+				return nil, fmt.Errorf("bad peephole data: %s", err)
+			}
+		case *neuralnet.LayerNormLayer:
+			if res.Norm != nil {
+				return nil, errors.New("invalid types for LSTM gate slice")
+			}
+			res.Norm = extra
+		default:
 			return nil, errors.New("invalid types for LSTM gate slice")
 		}
-		if err := json.Unmarshal(peephole, &res.Peephole); err != nil {
-			return nil, fmt.Errorf("bad peephole data: %s", err)
-		}
 	}
 	return res, nil
 }
 
 func (l *lstmGate) Batch(in autofunc.Result, n int) autofunc.Result {
 	if l.Peephole == nil {
-		return l.Activation.Apply(l.Dense.Batch(in, n))
+		return l.activate(l.Dense.Batch(in, n), n)
 	}
 	return autofunc.Pool(in, func(in autofunc.Result) autofunc.Result {
 		vecSize := len(in.Output()) / n
@@ -397,13 +539,13 @@ func (l *lstmGate) Batch(in autofunc.Result, n int) autofunc.Result {
 			peepholed = append(peepholed, autofunc.Mul(l.Peephole, peepholeMe))
 		}
 		weighted := l.Dense.Batch(autofunc.Concat(weightedInputs...), n)
-		return l.Activation.Apply(autofunc.Add(autofunc.Concat(peepholed...), weighted))
+		return l.activate(autofunc.Add(autofunc.Concat(peepholed...), weighted), n)
 	})
 }
 
 func (l *lstmGate) BatchR(rv autofunc.RVector, in autofunc.RResult, n int) autofunc.RResult {
 	if l.Peephole == nil {
-		return l.Activation.ApplyR(rv, l.Dense.BatchR(rv, in, n))
+		return l.activateR(rv, l.Dense.BatchR(rv, in, n), n)
 	}
 	return autofunc.PoolR(in, func(in autofunc.RResult) autofunc.RResult {
 		vecSize := len(in.Output()) / n
@@ -419,10 +561,28 @@ func (l *lstmGate) BatchR(rv autofunc.RVector, in autofunc.RResult, n int) autof
 		}
 		weighted := l.Dense.BatchR(rv, autofunc.ConcatR(weightedInputs...), n)
 		joinedPeep := autofunc.ConcatR(peepholed...)
-		return l.Activation.ApplyR(rv, autofunc.AddR(joinedPeep, weighted))
+		return l.activateR(rv, autofunc.AddR(joinedPeep, weighted), n)
 	})
 }
 
+// activate applies the normalization (if there is one)
+// and the activation function to a batch of
+// pre-activations.
+func (l *lstmGate) activate(in autofunc.Result, n int) autofunc.Result {
+	if l.Norm != nil {
+		in = l.Norm.Batch(in, n)
+	}
+	return l.Activation.Apply(in)
+}
+
+func (l *lstmGate) activateR(rv autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	if l.Norm != nil {
+		in = l.Norm.BatchR(rv, in, n)
+	}
+	return l.Activation.ApplyR(rv, in)
+}
+
 func (l *lstmGate) Serialize() ([]byte, error) {
 	slist := []serializer.Serializer{l.Dense, l.Activation}
 	if l.Peephole != nil {
@@ -432,6 +592,9 @@ func (l *lstmGate) Serialize() ([]byte, error) {
 		}
 		slist = append(slist, serializer.Bytes(data))
 	}
+	if l.Norm != nil {
+		slist = append(slist, l.Norm)
+	}
 	return serializer.SerializeSlice(slist)
 }
 
@@ -442,6 +605,7 @@ func (l *lstmGate) SerializerType() string {
 type lstmResult struct {
 	CellStates []linalg.Vector
 	OutputVecs []linalg.Vector
+	Masks      []*recurrentMasks
 
 	InternalPool []*autofunc.Variable
 	LastOutPool  []*autofunc.Variable
@@ -456,7 +620,7 @@ func (l *lstmResult) Outputs() []linalg.Vector {
 func (l *lstmResult) States() []State {
 	res := make([]State, len(l.OutputVecs))
 	for i, x := range l.CellStates {
-		res[i] = lstmState{Internal: x, Output: l.OutputVecs[i]}
+		res[i] = lstmState{Internal: x, Output: l.OutputVecs[i], Masks: l.Masks[i]}
 	}
 	return res
 }
@@ -508,6 +672,7 @@ type lstmRResult struct {
 	RCellStates []linalg.Vector
 	OutputVecs  []linalg.Vector
 	ROutputVecs []linalg.Vector
+	Masks       []*recurrentMasks
 
 	InternalPool []*autofunc.Variable
 	LastOutPool  []*autofunc.Variable
@@ -531,6 +696,7 @@ func (l *lstmRResult) RStates() []RState {
 			Output:    l.OutputVecs[i],
 			InternalR: l.RCellStates[i],
 			OutputR:   l.ROutputVecs[i],
+			Masks:     l.Masks[i],
 		}
 	}
 	return res
@@ -0,0 +1,196 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func init() {
+	var m MGU
+	serializer.RegisterTypedDeserializer(m.SerializerType(), DeserializeMGU)
+}
+
+// MGU is a Block that implements a minimal gated unit,
+// as defined in https://arxiv.org/abs/1603.09420.
+//
+// An MGU is like a GRU, except that a single forget gate
+// plays the role of both the reset and update gates.
+type MGU struct {
+	hiddenSize int
+	inputValue *lstmGate
+	forgetGate *lstmGate
+	initState  *autofunc.Variable
+}
+
+// NewMGU creates an MGU with randomly initialized
+// weights and biases.
+func NewMGU(inputSize, hiddenSize int) *MGU {
+	return &MGU{
+		hiddenSize: hiddenSize,
+		inputValue: newLSTMGate(inputSize, hiddenSize, false, &neuralnet.HyperbolicTangent{}),
+		forgetGate: newLSTMGate(inputSize, hiddenSize, false, &neuralnet.Sigmoid{}),
+		initState:  &autofunc.Variable{Vector: make(linalg.Vector, hiddenSize)},
+	}
+}
+
+// DeserializeMGU deserializes an MGU.
+func DeserializeMGU(d []byte) (*MGU, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 4 {
+		return nil, errors.New("invalid slice length in MGU")
+	}
+	hiddenSize, ok := slice[0].(serializer.Int)
+	inputValue, ok1 := slice[1].(*lstmGate)
+	forgetGate, ok2 := slice[2].(*lstmGate)
+	initStateData, ok3 := slice[3].(serializer.Bytes)
+	if !ok || !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("invalid types in MGU slice")
+	}
+	var initState autofunc.Variable
+	if err := json.Unmarshal(initStateData, &initState); err != nil {
+		return nil, errors.New("invalid init state in MGU slice")
+	}
+	return &MGU{
+		hiddenSize: int(hiddenSize),
+		inputValue: inputValue,
+		forgetGate: forgetGate,
+		initState:  &initState,
+	}, nil
+}
+
+// StartState returns the trainable start state.
+func (m *MGU) StartState() State {
+	return VecState(m.initState.Vector)
+}
+
+// StartRState is like StartState but with r-operators.
+func (m *MGU) StartRState(rv autofunc.RVector) RState {
+	resVar := autofunc.NewRVariable(m.initState, rv)
+	return VecRState{State: resVar.Output(), RState: resVar.ROutput()}
+}
+
+// PropagateStart propagates through the start state.
+func (m *MGU) PropagateStart(_ []State, s []StateGrad, g autofunc.Gradient) {
+	PropagateVarState(m.initState, s, g)
+}
+
+// PropagateStartR propagates through the start state.
+func (m *MGU) PropagateStartR(_ []RState, s []RStateGrad, rg autofunc.RGradient,
+	g autofunc.Gradient) {
+	PropagateVarStateR(m.initState, s, rg, g)
+}
+
+// ApplyBlock applies the block to an input.
+func (m *MGU) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
+	stateVars, stateRes := PoolVecStates(s)
+	var gateInputs []autofunc.Result
+	for i, x := range stateRes {
+		gateInputs = append(gateInputs, in[i], x)
+	}
+	n := len(in)
+
+	gateInput := autofunc.Concat(gateInputs...)
+	stateIn := autofunc.Concat(stateRes...)
+
+	forgetMask := m.forgetGate.Batch(gateInput, n)
+	newState := autofunc.Pool(forgetMask, func(fmask autofunc.Result) autofunc.Result {
+		maskedByForget := autofunc.Mul(fmask, stateIn)
+		inputValue := autofunc.PoolSplit(n, maskedByForget,
+			func(newStates []autofunc.Result) autofunc.Result {
+				var newGateInputs []autofunc.Result
+				for i, input := range in {
+					newGateInputs = append(newGateInputs, input, newStates[i])
+				}
+				newIn := autofunc.Concat(newGateInputs...)
+				return m.inputValue.Batch(newIn, n)
+			})
+		keepMask := autofunc.AddScaler(autofunc.Scale(fmask, -1), 1)
+		return autofunc.Add(autofunc.Mul(keepMask, stateIn),
+			autofunc.Mul(fmask, inputValue))
+	})
+
+	return &gruResult{
+		InStates: stateVars,
+		Masks:    make([]*recurrentMasks, n),
+		Output:   newState,
+	}
+}
+
+// ApplyBlockR applies the block to an input.
+func (m *MGU) ApplyBlockR(rv autofunc.RVector, s []RState, in []autofunc.RResult) BlockRResult {
+	stateVars, stateRes := PoolVecRStates(s)
+	var gateInputs []autofunc.RResult
+	for i, x := range stateRes {
+		gateInputs = append(gateInputs, in[i], x)
+	}
+	n := len(in)
+
+	gateInput := autofunc.ConcatR(gateInputs...)
+	stateIn := autofunc.ConcatR(stateRes...)
+
+	forgetMask := m.forgetGate.BatchR(rv, gateInput, n)
+	newState := autofunc.PoolR(forgetMask, func(fmask autofunc.RResult) autofunc.RResult {
+		maskedByForget := autofunc.MulR(fmask, stateIn)
+		inputValue := autofunc.PoolSplitR(n, maskedByForget,
+			func(newStates []autofunc.RResult) autofunc.RResult {
+				var newGateInputs []autofunc.RResult
+				for i, input := range in {
+					newGateInputs = append(newGateInputs, input, newStates[i])
+				}
+				newIn := autofunc.ConcatR(newGateInputs...)
+				return m.inputValue.BatchR(rv, newIn, n)
+			})
+		keepMask := autofunc.AddScalerR(autofunc.ScaleR(fmask, -1), 1)
+		return autofunc.AddR(autofunc.MulR(keepMask, stateIn),
+			autofunc.MulR(fmask, inputValue))
+	})
+
+	return &gruRResult{
+		InStates: stateVars,
+		Masks:    make([]*recurrentMasks, n),
+		Output:   newState,
+	}
+}
+
+// Parameters returns the MGU's parameters in the
+// following order: input weights, input biases, forget
+// gate weights, forget gate biases, initial state
+// biases.
+func (m *MGU) Parameters() []*autofunc.Variable {
+	return []*autofunc.Variable{
+		m.inputValue.Dense.Weights.Data,
+		m.inputValue.Dense.Biases.Var,
+		m.forgetGate.Dense.Weights.Data,
+		m.forgetGate.Dense.Biases.Var,
+		m.initState,
+	}
+}
+
+// Serialize serializes the block.
+func (m *MGU) Serialize() ([]byte, error) {
+	initData, err := json.Marshal(m.initState)
+	if err != nil {
+		return nil, err
+	}
+	slist := []serializer.Serializer{
+		serializer.Int(m.hiddenSize),
+		m.inputValue,
+		m.forgetGate,
+		serializer.Bytes(initData),
+	}
+	return serializer.SerializeSlice(slist)
+}
+
+// SerializerType returns the unique ID used to serialize
+// an MGU with the serializer package.
+func (m *MGU) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.MGU"
+}
@@ -0,0 +1,164 @@
+package rnn
+
+import (
+	"encoding/json"
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+// recurrentMasks stores the variational dropout and
+// zoneout masks for a single sequence.
+//
+// The masks are chosen once, when a start state is
+// created, and are then carried along in every state of
+// the sequence so that they are held fixed across time
+// steps.
+type recurrentMasks struct {
+	// Dropout is multiplied by the recurrent inputs to
+	// every gate.
+	// It is nil if dropout is disabled.
+	Dropout linalg.Vector
+
+	// Zoneout specifies, for each state component, how
+	// much of the previous state to keep.
+	// It is nil if zoneout is disabled.
+	Zoneout linalg.Vector
+}
+
+// newRecurrentMasks creates masks for a sequence.
+//
+// In training mode, the masks are random binary masks.
+// Otherwise, they are the expected values of the random
+// masks, so that dropout and zoneout are averaged out.
+//
+// The result is nil if dropout and zoneout are both
+// disabled.
+func newRecurrentMasks(dropout, zoneout float64, training bool,
+	dropSize, zoneSize int) *recurrentMasks {
+	if dropout == 0 && zoneout == 0 {
+		return nil
+	}
+	res := &recurrentMasks{}
+	if dropout != 0 {
+		res.Dropout = make(linalg.Vector, dropSize)
+		for i := range res.Dropout {
+			if !training {
+				res.Dropout[i] = 1 - dropout
+			} else if rand.Float64() >= dropout {
+				res.Dropout[i] = 1
+			}
+		}
+	}
+	if zoneout != 0 {
+		res.Zoneout = make(linalg.Vector, zoneSize)
+		for i := range res.Zoneout {
+			if !training {
+				res.Zoneout[i] = zoneout
+			} else if rand.Float64() < zoneout {
+				res.Zoneout[i] = 1
+			}
+		}
+	}
+	return res
+}
+
+// dropoutVar returns a constant variable containing the
+// dropout mask, or nil if dropout is disabled.
+func (r *recurrentMasks) dropoutVar() *autofunc.Variable {
+	if r == nil || r.Dropout == nil {
+		return nil
+	}
+	return &autofunc.Variable{Vector: r.Dropout}
+}
+
+// joinZoneout concatenates the zoneout masks for a batch
+// of lanes.
+// Lanes without a zoneout mask use a mask of zeroes.
+// If no lane uses zoneout, nil is returned.
+func joinZoneout(masks []*recurrentMasks, size int) linalg.Vector {
+	var used bool
+	res := make(linalg.Vector, 0, size*len(masks))
+	for _, m := range masks {
+		if m == nil || m.Zoneout == nil {
+			res = append(res, make(linalg.Vector, size)...)
+		} else {
+			used = true
+			res = append(res, m.Zoneout...)
+		}
+	}
+	if !used {
+		return nil
+	}
+	return res
+}
+
+// applyDropout multiplies a recurrent input by a dropout
+// mask if the mask is non-nil.
+func applyDropout(in autofunc.Result, mask *autofunc.Variable) autofunc.Result {
+	if mask == nil {
+		return in
+	}
+	return autofunc.Mul(in, mask)
+}
+
+func applyDropoutR(rv autofunc.RVector, in autofunc.RResult,
+	mask *autofunc.Variable) autofunc.RResult {
+	if mask == nil {
+		return in
+	}
+	return autofunc.MulR(in, autofunc.NewRVariable(mask, rv))
+}
+
+// applyZoneout keeps the entries of old which are
+// selected by the mask, taking the remaining entries
+// from newVal.
+func applyZoneout(mask linalg.Vector, old, newVal autofunc.Result) autofunc.Result {
+	if mask == nil {
+		return newVal
+	}
+	keep := &autofunc.Variable{Vector: mask}
+	update := &autofunc.Variable{Vector: mask.Copy().Scale(-1)}
+	for i := range update.Vector {
+		update.Vector[i]++
+	}
+	return autofunc.Add(autofunc.Mul(keep, old), autofunc.Mul(update, newVal))
+}
+
+func applyZoneoutR(rv autofunc.RVector, mask linalg.Vector, old,
+	newVal autofunc.RResult) autofunc.RResult {
+	if mask == nil {
+		return newVal
+	}
+	keep := &autofunc.Variable{Vector: mask}
+	update := &autofunc.Variable{Vector: mask.Copy().Scale(-1)}
+	for i := range update.Vector {
+		update.Vector[i]++
+	}
+	return autofunc.AddR(autofunc.MulR(autofunc.NewRVariable(keep, rv), old),
+		autofunc.MulR(autofunc.NewRVariable(update, rv), newVal))
+}
+
+// recurrentRegInfo is the serialized form of the
+// regularization settings of an LSTM or GRU.
+type recurrentRegInfo struct {
+	RecurrentDropout float64
+	Zoneout          float64
+	Training         bool
+}
+
+// serializeRegInfo appends the regularization settings
+// to a serialized slice if any settings are non-default.
+func serializeRegInfo(slist []serializer.Serializer,
+	info recurrentRegInfo) ([]serializer.Serializer, error) {
+	if info == (recurrentRegInfo{}) {
+		return slist, nil
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return append(slist, serializer.Bytes(data)), nil
+}
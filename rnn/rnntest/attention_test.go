@@ -0,0 +1,90 @@
+package rnntest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/autofunc/seqfunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestAttentionOutput(t *testing.T) {
+	for _, mode := range []rnn.AttentionMode{rnn.DotProductAttention, rnn.AdditiveAttention} {
+		attention := rnn.NewAttention(mode, 3, 4, 2)
+		seq := []linalg.Vector{{1, -1, 0.5}, {0.3, 0.2, -0.7}, {-1, 0.1, 0.9}}
+		out := attention.ApplySeqs(seqfunc.ConstResult([][]linalg.Vector{seq}))
+
+		// Every output is a convex combination of the values,
+		// so its components must lie in the values' range.
+		var values []linalg.Vector
+		for _, x := range seq {
+			v := attention.Value.Apply(&autofunc.Variable{Vector: x}).Output()
+			values = append(values, v)
+		}
+		for t1, outVec := range out.OutputSeqs()[0] {
+			for i, x := range outVec {
+				min, max := math.Inf(1), math.Inf(-1)
+				for _, v := range values {
+					min = math.Min(min, v[i])
+					max = math.Max(max, v[i])
+				}
+				if x < min-1e-8 || x > max+1e-8 {
+					t.Errorf("mode %d: output %d component %d (%f) not in [%f, %f]",
+						mode, t1, i, x, min, max)
+				}
+			}
+		}
+	}
+}
+
+func TestAttentionChecks(t *testing.T) {
+	for _, mode := range []rnn.AttentionMode{rnn.DotProductAttention, rnn.AdditiveAttention} {
+		attention := rnn.NewAttention(mode, 3, 4, 2)
+		seqs, rv := randBaselineTestSeqs(attention, 3)
+		vars := make([]*autofunc.Variable, 0, len(rv))
+		for v := range rv {
+			vars = append(vars, v)
+		}
+		checker := &functest.SeqRFuncChecker{
+			F:     attention,
+			Vars:  vars,
+			Input: seqs,
+			RV:    rv,
+		}
+		checker.FullCheck(t)
+	}
+}
+
+func TestAttentionBidirectional(t *testing.T) {
+	attention := rnn.NewAttention(rnn.AdditiveAttention, 6, 3, 2)
+	bidir := &rnn.Bidirectional{
+		Forward:  &rnn.BlockSeqFunc{B: rnn.NewGRU(3, 3)},
+		Backward: &rnn.BlockSeqFunc{B: rnn.NewGRU(3, 3)},
+		Output:   attention,
+	}
+	seqs, rv := randBaselineTestSeqs(bidir, 3)
+	vars := make([]*autofunc.Variable, 0, len(rv))
+	for v := range rv {
+		vars = append(vars, v)
+	}
+	checker := &functest.SeqRFuncChecker{
+		F:     bidir,
+		Vars:  vars,
+		Input: seqs,
+		RV:    rv,
+	}
+	checker.FullCheck(t)
+}
+
+func TestAttentionSerialize(t *testing.T) {
+	for _, mode := range []rnn.AttentionMode{rnn.DotProductAttention, rnn.AdditiveAttention} {
+		attention := rnn.NewAttention(mode, 3, 4, 2)
+		newAttention := testBlockSerialize(t, attention).(*rnn.Attention)
+		if newAttention.Mode != mode {
+			t.Errorf("expected mode %d but got %d", mode, newAttention.Mode)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package rnntest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc/seqfunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestBidirectionalStreamFull(t *testing.T) {
+	b := &rnn.Bidirectional{
+		// Hide the BlockSeqFunc's type to test the generic
+		// code path.
+		Forward:  opaqueSeqFunc{&rnn.BlockSeqFunc{B: rnn.NewLSTM(3, 2)}},
+		Backward: &rnn.BlockSeqFunc{B: rnn.NewGRU(3, 2)},
+		Output:   &rnn.BlockSeqFunc{B: rnn.NewLSTM(4, 2)},
+	}
+	inputs := bidirStreamTestInputs(7)
+	expected := b.ApplySeqs(seqfunc.ConstResult([][]linalg.Vector{inputs})).OutputSeqs()[0]
+
+	stream := rnn.NewBidirectionalStream(b, len(inputs))
+	for _, in := range inputs {
+		if out := stream.Push(in); len(out) != 0 {
+			t.Fatal("unexpected early output")
+		}
+	}
+	bidirStreamTestCompare(t, expected, stream.Flush())
+
+	// The stream should be reusable after a Flush.
+	var actual []linalg.Vector
+	for _, in := range inputs {
+		actual = append(actual, stream.Push(in)...)
+	}
+	actual = append(actual, stream.Flush()...)
+	bidirStreamTestCompare(t, expected, actual)
+}
+
+func TestBidirectionalStreamLookahead(t *testing.T) {
+	const lookahead = 2
+	b := &rnn.Bidirectional{
+		Forward:  &rnn.BlockSeqFunc{B: rnn.NewLSTM(3, 2)},
+		Backward: &rnn.BlockSeqFunc{B: rnn.NewLSTM(3, 2)},
+		Output: &rnn.NetworkSeqFunc{Network: neuralnet.Network{
+			neuralnet.NewDenseLayer(4, 2),
+		}},
+	}
+	inputs := bidirStreamTestInputs(7)
+	stream := rnn.NewBidirectionalStream(b, lookahead)
+
+	var actual []linalg.Vector
+	for i, in := range inputs {
+		out := stream.Push(in)
+		if i < lookahead && len(out) != 0 {
+			t.Fatalf("frame %d: unexpected output", i)
+		} else if i >= lookahead && len(out) != 1 {
+			t.Fatalf("frame %d: expected one output but got %d", i, len(out))
+		}
+		actual = append(actual, out...)
+	}
+	actual = append(actual, stream.Flush()...)
+
+	// The output for frame i should only depend on the
+	// frames up to i+lookahead.
+	var expected []linalg.Vector
+	for i := range inputs {
+		end := i + lookahead + 1
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		in := seqfunc.ConstResult([][]linalg.Vector{inputs[:end]})
+		expected = append(expected, b.ApplySeqs(in).OutputSeqs()[0][i])
+	}
+	bidirStreamTestCompare(t, expected, actual)
+}
+
+type opaqueSeqFunc struct {
+	seqfunc.RFunc
+}
+
+func bidirStreamTestInputs(n int) []linalg.Vector {
+	res := make([]linalg.Vector, n)
+	for i := range res {
+		res[i] = linalg.RandVector(3)
+	}
+	return res
+}
+
+func bidirStreamTestCompare(t *testing.T, expected, actual []linalg.Vector) {
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d outputs but got %d", len(expected), len(actual))
+	}
+	for i, x := range expected {
+		for j, y := range x {
+			if math.Abs(actual[i][j]-y) > 1e-8 {
+				t.Fatalf("output %d: expected %v but got %v", i, x, actual[i])
+			}
+		}
+	}
+}
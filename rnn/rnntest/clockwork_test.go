@@ -0,0 +1,42 @@
+package rnntest
+
+import (
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestClockworkRNN(t *testing.T) {
+	b := rnn.NewClockworkRNN(4, 2, []int{1, 2, 4})
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestClockworkRNNPeriods(t *testing.T) {
+	b := rnn.NewClockworkRNN(3, 2, []int{1, 2, 4})
+	runner := &rnn.Runner{Block: b}
+	var outputs []linalg.Vector
+	for i := 0; i < 5; i++ {
+		outputs = append(outputs, runner.StepTime(linalg.RandVector(3)))
+	}
+	for i := 1; i < len(outputs); i++ {
+		for module, period := range []int{1, 2, 4} {
+			if i%period == 0 {
+				continue
+			}
+			last := outputs[i-1][module*2 : (module+1)*2]
+			current := outputs[i][module*2 : (module+1)*2]
+			for j, x := range last {
+				if current[j] != x {
+					t.Errorf("step %d: module %d changed from %v to %v", i, module,
+						last, current)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestClockworkRNNSerialize(t *testing.T) {
+	testBlockSerialize(t, rnn.NewClockworkRNN(4, 2, []int{1, 2, 4}))
+}
@@ -0,0 +1,16 @@
+package rnntest
+
+import (
+	"testing"
+
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestConvLSTM(t *testing.T) {
+	b := rnn.NewConvLSTM(2, 2, 1, 2, 3)
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestConvLSTMSerialize(t *testing.T) {
+	testBlockSerialize(t, rnn.NewConvLSTM(2, 2, 1, 2, 3))
+}
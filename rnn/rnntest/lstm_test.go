@@ -10,3 +10,20 @@ func TestLSTM(t *testing.T) {
 	b := rnn.NewLSTM(4, 2)
 	NewChecker4In(b, b).FullCheck(t)
 }
+
+func TestLayerNormLSTM(t *testing.T) {
+	b := rnn.NewLayerNormLSTM(4, 3)
+	checker := NewChecker4In(b, b)
+	// Layer normalization divides by the standard deviation
+	// of small pre-activation vectors, giving it enough
+	// curvature that the finite differences used to check
+	// the r-gradients are too inaccurate with larger deltas.
+	checker.Delta = 1e-7
+	checker.FullCheck(t)
+}
+
+func TestLayerNormLSTMSerialize(t *testing.T) {
+	b := rnn.NewLayerNormLSTM(4, 3)
+	decoded := testBlockSerialize(t, b).(*rnn.LSTM)
+	testBlockOutputs(t, b, decoded, 4)
+}
@@ -0,0 +1,16 @@
+package rnntest
+
+import (
+	"testing"
+
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestMGU(t *testing.T) {
+	b := rnn.NewMGU(4, 3)
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestMGUSerialize(t *testing.T) {
+	testBlockSerialize(t, rnn.NewMGU(4, 3))
+}
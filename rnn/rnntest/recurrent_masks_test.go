@@ -0,0 +1,113 @@
+//go:debug randseednop=0
+
+package rnntest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestLSTMRegularization(t *testing.T) {
+	b := rnn.NewLSTM(4, 3)
+	b.RecurrentDropout = 0.3
+	b.Zoneout = 0.2
+	t.Run("Expected", func(t *testing.T) {
+		NewChecker4In(b, b).FullCheck(t)
+	})
+	b.Training = true
+	t.Run("Training", func(t *testing.T) {
+		NewChecker4In(&seededStartBlock{Block: b}, b).FullCheck(t)
+	})
+	testFixedMasks(t, b, 4)
+	testRegSerialize(t, b)
+}
+
+func TestGRURegularization(t *testing.T) {
+	b := rnn.NewGRU(4, 3)
+	b.RecurrentDropout = 0.3
+	b.Zoneout = 0.2
+	t.Run("Expected", func(t *testing.T) {
+		NewChecker4In(b, b).FullCheck(t)
+	})
+	b.Training = true
+	t.Run("Training", func(t *testing.T) {
+		NewChecker4In(&seededStartBlock{Block: b}, b).FullCheck(t)
+	})
+	testFixedMasks(t, b, 4)
+	testRegSerialize(t, b)
+}
+
+// testFixedMasks ensures that running a sequence twice
+// from the same start state gives the same outputs, even
+// though a new start state would have different masks.
+func testFixedMasks(t *testing.T, b rnn.Block, inSize int) {
+	inputs := make([]linalg.Vector, 5)
+	for i := range inputs {
+		inputs[i] = linalg.RandVector(inSize)
+	}
+	start := b.StartState()
+	r1 := &rnn.Runner{Block: b}
+	r2 := &rnn.Runner{Block: b}
+	r1.SetState(start)
+	r2.SetState(start)
+	for i, in := range inputs {
+		out1 := r1.StepTime(in)
+		out2 := r2.StepTime(in)
+		for j, x := range out1 {
+			if x != out2[j] {
+				t.Fatalf("time step %d: outputs differ", i)
+			}
+		}
+	}
+}
+
+func testRegSerialize(t *testing.T, b serializer.Serializer) {
+	data, err := serializer.SerializeWithType(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.DeserializeWithType(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dropout, zoneout float64
+	var training bool
+	switch decoded := decoded.(type) {
+	case *rnn.LSTM:
+		dropout, zoneout, training = decoded.RecurrentDropout, decoded.Zoneout,
+			decoded.Training
+	case *rnn.GRU:
+		dropout, zoneout, training = decoded.RecurrentDropout, decoded.Zoneout,
+			decoded.Training
+	default:
+		t.Fatalf("unexpected type %T", decoded)
+	}
+	if dropout != 0.3 || zoneout != 0.2 || !training {
+		t.Errorf("bad settings: dropout=%f zoneout=%f training=%v", dropout,
+			zoneout, training)
+	}
+}
+
+// seededStartBlock re-seeds the random number generator
+// before creating each start state, so that every start
+// state gets the same random masks.
+// This relies on the randseednop=0 setting at the top of
+// this file.
+type seededStartBlock struct {
+	rnn.Block
+}
+
+func (s *seededStartBlock) StartState() rnn.State {
+	rand.Seed(1337)
+	return s.Block.StartState()
+}
+
+func (s *seededStartBlock) StartRState(rv autofunc.RVector) rnn.RState {
+	rand.Seed(1337)
+	return s.Block.StartRState(rv)
+}
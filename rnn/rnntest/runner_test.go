@@ -0,0 +1,248 @@
+package rnntest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestRunnerGenerate(t *testing.T) {
+	runner := &rnn.Runner{Block: cyclicTestBlock(4)}
+	first := rnn.OneHot(4, 0)
+
+	res := runner.Generate(first, rnn.GreedySampler{}, nil, -1, 6)
+	if !intsEqual(res, []int{1, 2, 3, 0, 1, 2}) {
+		t.Errorf("unexpected greedy sequence: %v", res)
+	}
+
+	runner.Reset()
+	res = runner.Generate(first, rnn.TopKSampler{K: 1}, nil, 3, 6)
+	if !intsEqual(res, []int{1, 2, 3}) {
+		t.Errorf("unexpected top-k sequence: %v", res)
+	}
+
+	runner.Reset()
+	res = runner.Generate(first, rnn.NucleusSampler{P: 0.5}, nil, 3, 6)
+	if !intsEqual(res, []int{1, 2, 3}) {
+		t.Errorf("unexpected nucleus sequence: %v", res)
+	}
+}
+
+func TestRunnerSamplerDistribution(t *testing.T) {
+	out := linalg.Vector{math.Log(0.5), math.Log(0.3), math.Log(0.2)}
+	tests := []struct {
+		Sampler  rnn.Sampler
+		Expected []float64
+	}{
+		{rnn.TemperatureSampler{}, []float64{0.5, 0.3, 0.2}},
+		{rnn.TemperatureSampler{Temperature: 0.5}, []float64{25.0 / 38, 9.0 / 38, 4.0 / 38}},
+		{rnn.TopKSampler{K: 2}, []float64{0.625, 0.375, 0}},
+		{rnn.NucleusSampler{P: 0.7}, []float64{0.625, 0.375, 0}},
+	}
+	const sampleCount = 20000
+	for i, test := range tests {
+		counts := make([]float64, len(out))
+		for j := 0; j < sampleCount; j++ {
+			counts[test.Sampler.Sample(out)]++
+		}
+		for j, x := range test.Expected {
+			actual := counts[j] / sampleCount
+			if math.Abs(actual-x) > 0.02 {
+				t.Errorf("test %d: token %d should have frequency %f but got %f",
+					i, j, x, actual)
+			}
+		}
+	}
+}
+
+func TestRunnerBeamSearch(t *testing.T) {
+	block := rnn.NewLSTM(3, 3)
+	first := rnn.OneHot(3, 0)
+
+	// With a large enough width, beam search is exhaustive.
+	runner := &rnn.Runner{Block: block}
+	beams := runner.BeamSearch(first, 27, nil, -1, 3)
+	if len(beams) != 27 {
+		t.Fatalf("expected 27 beams but got %d", len(beams))
+	}
+	for i, beam := range beams {
+		expected := runnerTestLogProb(block, first, beam.Tokens)
+		if math.Abs(expected-beam.LogProb) > 1e-5 {
+			t.Errorf("beam %d: expected log prob %f but got %f", i, expected, beam.LogProb)
+		}
+		if i > 0 && beam.LogProb > beams[i-1].LogProb {
+			t.Errorf("beam %d is more likely than beam %d", i, i-1)
+		}
+	}
+	bestRunner := &rnn.Runner{Block: block}
+	bestRunner.SetState(beams[0].State)
+	out1 := runner.StepTime(first)
+	out2 := bestRunner.StepTime(first)
+	for i, x := range out1 {
+		if math.Abs(x-out2[i]) > 1e-8 {
+			t.Fatal("runner state should be set to the best beam's state")
+		}
+	}
+
+	runner.Reset()
+	narrow := runner.BeamSearch(first, 2, nil, -1, 3)
+	if len(narrow) != 2 {
+		t.Fatalf("expected 2 beams but got %d", len(narrow))
+	}
+	if narrow[0].LogProb > beams[0].LogProb+1e-5 {
+		t.Error("narrow beam should not beat exhaustive search")
+	}
+}
+
+func TestRunnerBeamSearchWidth(t *testing.T) {
+	runner := &rnn.Runner{Block: cyclicTestBlock(4)}
+	if beams := runner.BeamSearch(rnn.OneHot(4, 0), 1, nil, -1, 3); len(beams) != 1 {
+		t.Errorf("expected 1 beam but got %d", len(beams))
+	}
+	for _, width := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for width %d", width)
+				}
+			}()
+			runner.BeamSearch(rnn.OneHot(4, 0), width, nil, -1, 3)
+		}()
+	}
+}
+
+func TestRunnerBeamSearchStop(t *testing.T) {
+	runner := &rnn.Runner{Block: cyclicTestBlock(4)}
+	beams := runner.BeamSearch(rnn.OneHot(4, 0), 3, nil, 2, 10)
+	if len(beams) != 3 {
+		t.Fatalf("expected 3 beams but got %d", len(beams))
+	}
+	if !intsEqual(beams[0].Tokens, []int{1, 2}) {
+		t.Errorf("unexpected best beam: %v", beams[0].Tokens)
+	}
+	for _, beam := range beams {
+		for i, token := range beam.Tokens {
+			if token == 2 && i != len(beam.Tokens)-1 {
+				t.Errorf("beam continued after stop token: %v", beam.Tokens)
+			}
+		}
+	}
+}
+
+func TestRunnerFork(t *testing.T) {
+	runner := &rnn.Runner{Block: rnn.NewLSTM(3, 3)}
+	runner.StepTime(linalg.Vector{1, 2, 3})
+	fork := runner.Fork()
+	out1 := runner.StepTime(linalg.Vector{-1, 0, 1})
+	runner.StepTime(linalg.Vector{3, 2, 1})
+	out2 := fork.StepTime(linalg.Vector{-1, 0, 1})
+	for i, x := range out1 {
+		if math.Abs(x-out2[i]) > 1e-8 {
+			t.Fatalf("expected %v but got %v", out1, out2)
+		}
+	}
+}
+
+// cyclicTestBlock creates a stateless Block which maps
+// a one-hot token i to log probabilities that strongly
+// favor token (i+1)%size.
+func cyclicTestBlock(size int) rnn.Block {
+	dense := neuralnet.NewDenseLayer(size, size)
+	for i := range dense.Biases.Var.Vector {
+		dense.Biases.Var.Vector[i] = 0
+	}
+	for i := range dense.Weights.Data.Vector {
+		dense.Weights.Data.Vector[i] = 0
+	}
+	for i := 0; i < size; i++ {
+		dense.Weights.Data.Vector[((i+1)%size)*size+i] = 5
+	}
+	return &rnn.BatcherBlock{
+		B: neuralnet.Network{dense, &neuralnet.LogSoftmaxLayer{}}.BatchLearner(),
+	}
+}
+
+func runnerTestLogProb(b rnn.Block, first linalg.Vector, tokens []int) float64 {
+	state := b.StartState()
+	input := first
+	var res float64
+	for _, token := range tokens {
+		out := b.ApplyBlock([]rnn.State{state}, []autofunc.Result{
+			&autofunc.Variable{Vector: input},
+		})
+		state = out.States()[0]
+		logProbs := (&neuralnet.LogSoftmaxLayer{}).Apply(&autofunc.Variable{
+			Vector: out.Outputs()[0],
+		}).Output()
+		res += logProbs[token]
+		input = rnn.OneHot(len(logProbs), token)
+	}
+	return res
+}
+
+func intsEqual(i1, i2 []int) bool {
+	if len(i1) != len(i2) {
+		return false
+	}
+	for i, x := range i1 {
+		if i2[i] != x {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRunnerSnapshot(t *testing.T) {
+	gru := rnn.NewGRU(3, 2)
+	gru.RecurrentDropout = 0.2
+	block := rnn.StackedBlock{
+		rnn.ParallelBlock{rnn.NewLSTM(3, 2), gru},
+		rnn.NewIRNN(4, 3, 1),
+		rnn.NewClockworkRNN(3, 2, []int{1, 2, 4}),
+	}
+	inputs := make([]linalg.Vector, 6)
+	for i := range inputs {
+		inputs[i] = linalg.RandVector(3)
+	}
+
+	runner := &rnn.Runner{Block: block}
+	for _, in := range inputs[:3] {
+		runner.StepTime(in)
+	}
+	snapshot, err := runner.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []linalg.Vector
+	for _, in := range inputs[3:] {
+		expected = append(expected, runner.StepTime(in))
+	}
+
+	restored := &rnn.Runner{Block: block}
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	for i, in := range inputs[3:] {
+		actual := restored.StepTime(in)
+		for j, x := range expected[i] {
+			if math.Abs(actual[j]-x) > 1e-8 {
+				t.Fatalf("step %d: expected %v but got %v", i, expected[i], actual)
+			}
+		}
+	}
+
+	restored.Reset()
+	snapshot, err = restored.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	} else if runner.State() != nil {
+		t.Error("restoring a time 0 snapshot should reset the Runner")
+	}
+}
@@ -0,0 +1,69 @@
+package rnntest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+// testBlockSerialize makes sure that a block survives a
+// serialize-deserialize round trip with the same type and
+// parameters.
+// It returns the decoded block for further checks.
+func testBlockSerialize(t *testing.T, b interface {
+	serializer.Serializer
+	sgd.Learner
+}) sgd.Learner {
+	data, err := serializer.SerializeWithType(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := serializer.DeserializeWithType(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.TypeOf(decoded) != reflect.TypeOf(b) {
+		t.Fatalf("expected %T but got %T", b, decoded)
+	}
+	newBlock := decoded.(sgd.Learner)
+	params := b.Parameters()
+	newParams := newBlock.Parameters()
+	if len(newParams) != len(params) {
+		t.Fatalf("%T: expected %d parameters but got %d", b, len(params), len(newParams))
+	}
+	for i, param := range params {
+		for j, x := range param.Vector {
+			if newParams[i].Vector[j] != x {
+				t.Fatalf("%T: parameter %d differs at index %d", b, i, j)
+			}
+		}
+	}
+	return newBlock
+}
+
+// testBlockOutputs makes sure that two blocks produce the
+// same outputs for the same input sequence.
+func testBlockOutputs(t *testing.T, expected, actual rnn.Block, inSize int) {
+	expectedRunner := &rnn.Runner{Block: expected}
+	actualRunner := &rnn.Runner{Block: actual}
+	for step := 0; step < 3; step++ {
+		in := linalg.RandVector(inSize)
+		expectedOut := expectedRunner.StepTime(in)
+		actualOut := actualRunner.StepTime(in)
+		if len(actualOut) != len(expectedOut) {
+			t.Fatalf("%T: expected %d outputs but got %d", expected, len(expectedOut),
+				len(actualOut))
+		}
+		for i, x := range expectedOut {
+			if math.Abs(actualOut[i]-x) > 1e-8 {
+				t.Fatalf("%T: step %d: output %d should be %f but got %f", expected, step,
+					i, x, actualOut[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package rnntest
+
+import (
+	"testing"
+
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestResidualBlock(t *testing.T) {
+	b := &rnn.ResidualBlock{Block: rnn.NewLSTM(4, 4)}
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestHighwayBlock(t *testing.T) {
+	b := rnn.NewHighwayBlock(rnn.NewGRU(4, 4), 4)
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestSkipBlockStacked(t *testing.T) {
+	b := rnn.StackedBlock{
+		&rnn.ResidualBlock{Block: rnn.NewLSTM(4, 4)},
+		rnn.NewHighwayBlock(rnn.NewLSTM(4, 4), 4),
+		rnn.NewLSTM(4, 2),
+	}
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestSkipBlockSerialize(t *testing.T) {
+	testBlockSerialize(t, &rnn.ResidualBlock{Block: rnn.NewLSTM(4, 4)})
+
+	highway := rnn.NewHighwayBlock(rnn.NewGRU(4, 4), 4)
+	decoded := testBlockSerialize(t, highway).(*rnn.HighwayBlock)
+	testBlockOutputs(t, highway, decoded, 4)
+}
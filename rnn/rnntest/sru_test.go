@@ -0,0 +1,22 @@
+package rnntest
+
+import (
+	"testing"
+
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestSRU(t *testing.T) {
+	b := rnn.NewSRU(4, 3)
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestSRUSameSize(t *testing.T) {
+	b := rnn.NewSRU(4, 4)
+	NewChecker4In(b, b).FullCheck(t)
+}
+
+func TestSRUSerialize(t *testing.T) {
+	testBlockSerialize(t, rnn.NewSRU(4, 3))
+	testBlockSerialize(t, rnn.NewSRU(4, 4))
+}
@@ -1,6 +1,8 @@
 package rnn
 
 import (
+	"sort"
+
 	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/num-analysis/linalg"
 )
@@ -32,6 +34,179 @@ func (r *Runner) StepTime(input linalg.Vector) linalg.Vector {
 	return out.Outputs()[0]
 }
 
+// State returns the current state of the Runner.
+// This is nil if the Runner is at time 0.
+//
+// States are never modified by Blocks, so the result may
+// be stored and restored later with SetState.
+// To save a state across restarts, use SerializeState or
+// Snapshot.
+func (r *Runner) State() State {
+	return r.currentState
+}
+
+// SetState sets the current state of the Runner.
+// Setting a nil state is equivalent to calling Reset.
+func (r *Runner) SetState(s State) {
+	r.currentState = s
+}
+
+// Snapshot serializes the current state of the Runner,
+// so that it can be restored later with Restore.
+// This makes it possible to save the context of a stream
+// and resume it after a restart.
+//
+// The Block must use states which can be serialized with
+// SerializeState.
+func (r *Runner) Snapshot() ([]byte, error) {
+	if r.currentState == nil {
+		return []byte{}, nil
+	}
+	return SerializeState(r.currentState)
+}
+
+// Restore sets the current state of the Runner from data
+// which was produced by Snapshot.
+func (r *Runner) Restore(data []byte) error {
+	if len(data) == 0 {
+		r.Reset()
+		return nil
+	}
+	state, err := DeserializeState(data)
+	if err != nil {
+		return err
+	}
+	r.currentState = state
+	return nil
+}
+
+// Fork creates a new Runner with the same Block and the
+// same current state.
+// The two Runners may then be stepped independently.
+func (r *Runner) Fork() *Runner {
+	return &Runner{Block: r.Block, currentState: r.currentState}
+}
+
+// Generate generates a sequence of tokens by feeding the
+// Block's outputs back into it as inputs.
+//
+// The first input is fed into the Block first.
+// After that, a token is sampled from each output, and
+// encode is used to turn it into the next input.
+// If encode is nil, tokens are fed back as one-hot
+// vectors (see OneHot).
+//
+// Generation continues from the Runner's current state,
+// making it possible to "prime" the Runner with StepTime.
+// It stops after maxLen tokens, or after the stop token
+// is produced if stop is non-negative.
+// The stop token is included in the result.
+//
+// Afterwards, the Runner's state is the state after the
+// last token was produced (but not fed back in).
+func (r *Runner) Generate(first linalg.Vector, s Sampler, encode func(token int) linalg.Vector,
+	stop, maxLen int) []int {
+	var res []int
+	input := first
+	for len(res) < maxLen {
+		out := r.StepTime(input)
+		token := s.Sample(out)
+		res = append(res, token)
+		if token == stop {
+			break
+		}
+		input = encodeToken(encode, len(out), token)
+	}
+	return res
+}
+
+// A Beam is a sequence produced by BeamSearch.
+type Beam struct {
+	Tokens []int
+
+	// LogProb is the log probability of the sequence.
+	LogProb float64
+
+	// State is the Block's state after the last token was
+	// produced.
+	State State
+}
+
+// BeamSearch uses beam search to find likely token
+// sequences, keeping width candidates at every step.
+// The arguments are treated like they are by Generate,
+// and the outputs of the Block are treated as log
+// probabilities like they are by a Sampler.
+//
+// All of the beams are evaluated in a single batch.
+// The resulting beams are sorted from most to least
+// likely, and the Runner's state is set to the state of
+// the most likely beam.
+//
+// The width must be at least 1.
+func (r *Runner) BeamSearch(first linalg.Vector, width int, encode func(token int) linalg.Vector,
+	stop, maxLen int) []*Beam {
+	if width < 1 {
+		panic("beam width must be at least 1")
+	}
+	if r.currentState == nil {
+		r.currentState = r.Block.StartState()
+	}
+	live := []*Beam{{State: r.currentState}}
+	inputs := []linalg.Vector{first}
+	var finished []*Beam
+	for step := 0; step < maxLen && len(live) > 0; step++ {
+		states := make([]State, len(live))
+		inRes := make([]autofunc.Result, len(live))
+		for i, beam := range live {
+			states[i] = beam.State
+			inRes[i] = &autofunc.Variable{Vector: inputs[i]}
+		}
+		out := r.Block.ApplyBlock(states, inRes)
+
+		var candidates beamSorter
+		for i, beam := range live {
+			for token, logProb := range logProbs(out.Outputs()[i], 1) {
+				candidates = append(candidates, beamCandidate{
+					Parent:  i,
+					Token:   token,
+					LogProb: beam.LogProb + logProb,
+				})
+			}
+		}
+		sort.Sort(candidates)
+		if len(candidates) > width-len(finished) {
+			candidates = candidates[:width-len(finished)]
+		}
+
+		var newLive []*Beam
+		inputs = nil
+		for _, c := range candidates {
+			parent := live[c.Parent]
+			beam := &Beam{
+				Tokens:  append(append([]int{}, parent.Tokens...), c.Token),
+				LogProb: c.LogProb,
+				State:   out.States()[c.Parent],
+			}
+			if c.Token == stop {
+				finished = append(finished, beam)
+			} else {
+				newLive = append(newLive, beam)
+				outSize := len(out.Outputs()[c.Parent])
+				inputs = append(inputs, encodeToken(encode, outSize, c.Token))
+			}
+		}
+		live = newLive
+	}
+
+	res := append(finished, live...)
+	sort.Sort(beamResultSorter(res))
+	if len(res) > 0 {
+		r.currentState = res[0].State
+	}
+	return res
+}
+
 // RunAll evaluates a batch of sequences on the block and
 // returns the new output sequences.
 // All of the sequences are evaluated in a single batch.
@@ -88,3 +263,44 @@ func (r *Runner) recursiveRunAll(seqs [][]linalg.Vector, states []State) [][]lin
 
 	return resVecs
 }
+
+func encodeToken(encode func(int) linalg.Vector, size, token int) linalg.Vector {
+	if encode == nil {
+		return OneHot(size, token)
+	}
+	return encode(token)
+}
+
+type beamCandidate struct {
+	Parent  int
+	Token   int
+	LogProb float64
+}
+
+type beamSorter []beamCandidate
+
+func (b beamSorter) Len() int {
+	return len(b)
+}
+
+func (b beamSorter) Less(i, j int) bool {
+	return b[i].LogProb > b[j].LogProb
+}
+
+func (b beamSorter) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+type beamResultSorter []*Beam
+
+func (b beamResultSorter) Len() int {
+	return len(b)
+}
+
+func (b beamResultSorter) Less(i, j int) bool {
+	return b[i].LogProb > b[j].LogProb
+}
+
+func (b beamResultSorter) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
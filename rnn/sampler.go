@@ -0,0 +1,181 @@
+package rnn
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// A Sampler selects a token from the output of a Block.
+//
+// Outputs are treated as unnormalized log probabilities,
+// such as those produced by a LogSoftmaxLayer, so the
+// probability of token i is proportional to exp(out[i]).
+type Sampler interface {
+	Sample(out linalg.Vector) int
+}
+
+// GreedySampler is a Sampler which always selects the
+// most likely token.
+type GreedySampler struct{}
+
+// Sample returns the index of the largest output.
+func (_ GreedySampler) Sample(out linalg.Vector) int {
+	var maxIdx int
+	for i, x := range out {
+		if x > out[maxIdx] {
+			maxIdx = i
+		}
+	}
+	return maxIdx
+}
+
+// TemperatureSampler is a Sampler which samples from the
+// output distribution after dividing the log
+// probabilities by a temperature.
+//
+// Temperatures below 1 make the distribution sharper,
+// while temperatures above 1 flatten it out.
+// If Temperature is 0, a temperature of 1 is used.
+type TemperatureSampler struct {
+	Temperature float64
+}
+
+// Sample samples a token from the distribution.
+func (t TemperatureSampler) Sample(out linalg.Vector) int {
+	return TopKSampler{Temperature: t.Temperature}.Sample(out)
+}
+
+// TopKSampler is a Sampler which samples from the K
+// most likely tokens, re-normalizing their probabilities
+// first.
+//
+// If K is 0, all tokens are considered.
+// The Temperature is applied as in TemperatureSampler.
+type TopKSampler struct {
+	K           int
+	Temperature float64
+}
+
+// Sample samples a token from the top K tokens.
+func (t TopKSampler) Sample(out linalg.Vector) int {
+	tokens, probs := sortedProbs(out, t.Temperature)
+	if t.K > 0 && t.K < len(tokens) {
+		tokens, probs = tokens[:t.K], probs[:t.K]
+	}
+	return sampleSorted(tokens, probs)
+}
+
+// NucleusSampler is a Sampler which implements nucleus
+// sampling, as described in
+// https://arxiv.org/abs/1904.09751.
+// It samples from the smallest set of most likely tokens
+// whose total probability is at least P.
+//
+// If P is 0 or at least 1, all tokens are considered.
+// The Temperature is applied as in TemperatureSampler.
+type NucleusSampler struct {
+	P           float64
+	Temperature float64
+}
+
+// Sample samples a token from the nucleus.
+func (n NucleusSampler) Sample(out linalg.Vector) int {
+	tokens, probs := sortedProbs(out, n.Temperature)
+	if n.P > 0 && n.P < 1 {
+		var total float64
+		for i, p := range probs {
+			total += p
+			if total >= n.P {
+				tokens, probs = tokens[:i+1], probs[:i+1]
+				break
+			}
+		}
+	}
+	return sampleSorted(tokens, probs)
+}
+
+// OneHot returns a one-hot vector of the given size with
+// a 1 at the given index.
+// It can be used to feed sampled tokens back into a
+// Block.
+func OneHot(size, idx int) linalg.Vector {
+	res := make(linalg.Vector, size)
+	res[idx] = 1
+	return res
+}
+
+// sortedProbs computes the probabilities for a vector of
+// log probabilities and sorts them in descending order.
+func sortedProbs(out linalg.Vector, temp float64) ([]int, []float64) {
+	if temp == 0 {
+		temp = 1
+	}
+	probs := logProbs(out, temp)
+	sorter := &probSorter{
+		tokens: make([]int, len(out)),
+		probs:  make([]float64, len(out)),
+	}
+	for i, x := range probs {
+		sorter.tokens[i] = i
+		sorter.probs[i] = math.Exp(x)
+	}
+	sort.Sort(sorter)
+	return sorter.tokens, sorter.probs
+}
+
+// sampleSorted samples a token after re-normalizing the
+// given probabilities.
+func sampleSorted(tokens []int, probs []float64) int {
+	var total float64
+	for _, p := range probs {
+		total += p
+	}
+	x := rand.Float64() * total
+	for i, p := range probs {
+		x -= p
+		if x < 0 {
+			return tokens[i]
+		}
+	}
+	return tokens[len(tokens)-1]
+}
+
+// logProbs normalizes a vector of unnormalized log
+// probabilities after dividing it by a temperature.
+func logProbs(out linalg.Vector, temp float64) linalg.Vector {
+	res := out.Copy().Scale(1 / temp)
+	max := math.Inf(-1)
+	for _, x := range res {
+		max = math.Max(max, x)
+	}
+	var sum float64
+	for _, x := range res {
+		sum += math.Exp(x - max)
+	}
+	logSum := max + math.Log(sum)
+	for i := range res {
+		res[i] -= logSum
+	}
+	return res
+}
+
+type probSorter struct {
+	tokens []int
+	probs  []float64
+}
+
+func (p *probSorter) Len() int {
+	return len(p.tokens)
+}
+
+func (p *probSorter) Less(i, j int) bool {
+	return p.probs[i] > p.probs[j]
+}
+
+func (p *probSorter) Swap(i, j int) {
+	p.tokens[i], p.tokens[j] = p.tokens[j], p.tokens[i]
+	p.probs[i], p.probs[j] = p.probs[j], p.probs[i]
+}
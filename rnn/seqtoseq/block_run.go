@@ -0,0 +1,186 @@
+package seqtoseq
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+// A blockRun stores the results of running a Block on a
+// batch of sequences from arbitrary start states.
+type blockRun struct {
+	Outputs  [][]linalg.Vector
+	Final    []rnn.State
+	StepOuts []rnn.BlockResult
+}
+
+func runBlock(b rnn.Block, start []rnn.State, ins [][]linalg.Vector) *blockRun {
+	res := &blockRun{
+		Outputs: make([][]linalg.Vector, len(ins)),
+		Final:   make([]rnn.State, len(ins)),
+	}
+	copy(res.Final, start)
+	for t := 0; t < maxSeqLen(ins); t++ {
+		var stateIn []rnn.State
+		var resIn []autofunc.Result
+		for lane, seq := range ins {
+			if len(seq) > t {
+				stateIn = append(stateIn, res.Final[lane])
+				resIn = append(resIn, &autofunc.Variable{Vector: seq[t]})
+			}
+		}
+		out := b.ApplyBlock(stateIn, resIn)
+		res.StepOuts = append(res.StepOuts, out)
+		var idx int
+		for lane, seq := range ins {
+			if len(seq) > t {
+				res.Outputs[lane] = append(res.Outputs[lane], out.Outputs()[idx])
+				res.Final[lane] = out.States()[idx]
+				idx++
+			}
+		}
+	}
+	return res
+}
+
+// PropagateGradient back-propagates through the run and
+// returns the gradients of the start states.
+//
+// The upstream argument may be nil, as may finalGrad or
+// any of its entries.
+func (b *blockRun) PropagateGradient(upstream [][]linalg.Vector, finalGrad []rnn.StateGrad,
+	g autofunc.Gradient) []rnn.StateGrad {
+	stateGrads := make([]rnn.StateGrad, len(b.Outputs))
+	copy(stateGrads, finalGrad)
+	for t := len(b.StepOuts) - 1; t >= 0; t-- {
+		var stepUpstream []linalg.Vector
+		var stepStates []rnn.StateGrad
+		for lane, seq := range b.Outputs {
+			if len(seq) > t {
+				if upstream != nil {
+					stepUpstream = append(stepUpstream, upstream[lane][t])
+				}
+				stepStates = append(stepStates, stateGrads[lane])
+			}
+		}
+		down := b.StepOuts[t].PropagateGradient(stepUpstream, stepStates, g)
+		var idx int
+		for lane, seq := range b.Outputs {
+			if len(seq) > t {
+				stateGrads[lane] = down[idx]
+				idx++
+			}
+		}
+	}
+	return stateGrads
+}
+
+// A blockRRun is like a blockRun, but for RStates.
+type blockRRun struct {
+	Outputs  [][]linalg.Vector
+	ROutputs [][]linalg.Vector
+	Final    []rnn.RState
+	StepOuts []rnn.BlockRResult
+}
+
+func runBlockR(rv autofunc.RVector, b rnn.Block, start []rnn.RState,
+	ins [][]linalg.Vector) *blockRRun {
+	res := &blockRRun{
+		Outputs:  make([][]linalg.Vector, len(ins)),
+		ROutputs: make([][]linalg.Vector, len(ins)),
+		Final:    make([]rnn.RState, len(ins)),
+	}
+	copy(res.Final, start)
+	for t := 0; t < maxSeqLen(ins); t++ {
+		var stateIn []rnn.RState
+		var resIn []autofunc.RResult
+		for lane, seq := range ins {
+			if len(seq) > t {
+				stateIn = append(stateIn, res.Final[lane])
+				inVar := &autofunc.Variable{Vector: seq[t]}
+				resIn = append(resIn, autofunc.NewRVariable(inVar, rv))
+			}
+		}
+		out := b.ApplyBlockR(rv, stateIn, resIn)
+		res.StepOuts = append(res.StepOuts, out)
+		var idx int
+		for lane, seq := range ins {
+			if len(seq) > t {
+				res.Outputs[lane] = append(res.Outputs[lane], out.Outputs()[idx])
+				res.ROutputs[lane] = append(res.ROutputs[lane], out.ROutputs()[idx])
+				res.Final[lane] = out.RStates()[idx]
+				idx++
+			}
+		}
+	}
+	return res
+}
+
+// PropagateRGradient is like PropagateGradient, but for
+// RStates.
+func (b *blockRRun) PropagateRGradient(upstream, upstreamR [][]linalg.Vector,
+	finalGrad []rnn.RStateGrad, rg autofunc.RGradient, g autofunc.Gradient) []rnn.RStateGrad {
+	stateGrads := make([]rnn.RStateGrad, len(b.Outputs))
+	copy(stateGrads, finalGrad)
+	for t := len(b.StepOuts) - 1; t >= 0; t-- {
+		var stepUpstream, stepUpstreamR []linalg.Vector
+		var stepStates []rnn.RStateGrad
+		for lane, seq := range b.Outputs {
+			if len(seq) > t {
+				if upstream != nil {
+					stepUpstream = append(stepUpstream, upstream[lane][t])
+					stepUpstreamR = append(stepUpstreamR, upstreamR[lane][t])
+				}
+				stepStates = append(stepStates, stateGrads[lane])
+			}
+		}
+		down := b.StepOuts[t].PropagateRGradient(stepUpstream, stepUpstreamR,
+			stepStates, rg, g)
+		var idx int
+		for lane, seq := range b.Outputs {
+			if len(seq) > t {
+				stateGrads[lane] = down[idx]
+				idx++
+			}
+		}
+	}
+	return stateGrads
+}
+
+func maxSeqLen(seqs [][]linalg.Vector) int {
+	var max int
+	for _, s := range seqs {
+		if len(s) > max {
+			max = len(s)
+		}
+	}
+	return max
+}
+
+// propagateStart back-propagates through the start states
+// of a Block, skipping lanes with no upstream gradient.
+func propagateStart(b rnn.Block, start []rnn.State, u []rnn.StateGrad, g autofunc.Gradient) {
+	var states []rnn.State
+	var stateGrads []rnn.StateGrad
+	for i, x := range u {
+		if x != nil {
+			states = append(states, start[i])
+			stateGrads = append(stateGrads, x)
+		}
+	}
+	b.PropagateStart(states, stateGrads, g)
+}
+
+// propagateStartR is like propagateStart, but for RStates.
+func propagateStartR(b rnn.Block, start []rnn.RState, u []rnn.RStateGrad,
+	rg autofunc.RGradient, g autofunc.Gradient) {
+	var states []rnn.RState
+	var stateGrads []rnn.RStateGrad
+	for i, x := range u {
+		if x != nil {
+			states = append(states, start[i])
+			stateGrads = append(stateGrads, x)
+		}
+	}
+	b.PropagateStartR(states, stateGrads, rg, g)
+}
@@ -40,19 +40,16 @@ func TotalCostSeqFunc(f seqfunc.RFunc, batchSize int, s sgd.SampleSet,
 	var totalCost float64
 	for i := 0; i < s.Len(); i += batchSize {
 		var inSeqs [][]linalg.Vector
-		var outSeqs [][]linalg.Vector
+		var samples []Sample
 		for j := i; j < i+batchSize && j < s.Len(); j++ {
 			seq := s.GetSample(j).(Sample)
 			inSeqs = append(inSeqs, seq.Inputs)
-			outSeqs = append(outSeqs, seq.Outputs)
+			samples = append(samples, seq)
 		}
 		output := f.ApplySeqs(seqfunc.ConstResult(inSeqs))
 		for j, actualSeq := range output.OutputSeqs() {
-			expectedSeq := outSeqs[j]
 			for k, actual := range actualSeq {
-				expected := expectedSeq[k]
-				actualVar := &autofunc.Variable{Vector: actual}
-				totalCost += c.Cost(expected, actualVar).Output()[0]
+				totalCost += weightedCost(c, samples[j], k, actual)
 			}
 		}
 	}
@@ -61,39 +58,36 @@ func TotalCostSeqFunc(f seqfunc.RFunc, batchSize int, s sgd.SampleSet,
 
 func blockBatchCost(b rnn.Block, s sgd.SampleSet, c neuralnet.CostFunc) float64 {
 	states := make([]rnn.State, s.Len())
+	samples := sampleSetSlice(s)
 	inputs := make([][]linalg.Vector, s.Len())
-	outputs := make([][]linalg.Vector, s.Len())
 	maxLen := 0
 	for i := range states {
 		states[i] = b.StartState()
-		s := s.GetSample(i).(Sample)
-		inputs[i] = s.Inputs
-		outputs[i] = s.Outputs
-		if len(s.Inputs) > maxLen {
-			maxLen = len(s.Inputs)
+		inputs[i] = samples[i].Inputs
+		if len(samples[i].Inputs) > maxLen {
+			maxLen = len(samples[i].Inputs)
 		}
 	}
 	var totalCost float64
 	for i := 0; i < maxLen; i++ {
 		inStates := make([]rnn.State, 0, s.Len())
 		ins := make([]autofunc.Result, 0, s.Len())
-		outs := make([]linalg.Vector, 0, s.Len())
+		laneSamples := make([]Sample, 0, s.Len())
 		for j, x := range inputs {
 			if len(x) > 0 {
 				ins = append(ins, &autofunc.Variable{Vector: x[0]})
-				outs = append(outs, outputs[j][0])
+				laneSamples = append(laneSamples, samples[j])
 				inStates = append(inStates, states[j])
 			}
 		}
 		result := b.ApplyBlock(inStates, ins)
 		for j, out := range result.Outputs() {
-			totalCost += c.Cost(outs[j], &autofunc.Variable{Vector: out}).Output()[0]
+			totalCost += weightedCost(c, laneSamples[j], i, out)
 		}
 		var stateIdx int
 		for j, x := range inputs {
 			if len(x) > 0 {
 				inputs[j] = x[1:]
-				outputs[j] = outputs[j][1:]
 				states[j] = result.States()[stateIdx]
 				stateIdx++
 			}
@@ -101,3 +95,14 @@ func blockBatchCost(b rnn.Block, s sgd.SampleSet, c neuralnet.CostFunc) float64
 	}
 	return totalCost
 }
+
+// weightedCost computes the weighted cost for a time step
+// of a sample.
+func weightedCost(c neuralnet.CostFunc, s Sample, t int, actual linalg.Vector) float64 {
+	weight := s.weight(t)
+	if weight == 0 {
+		return 0
+	}
+	actualVar := &autofunc.Variable{Vector: actual}
+	return weight * c.Cost(s.Outputs[t], actualVar).Output()[0]
+}
@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/num-analysis/linalg"
 	"github.com/unixpickle/sgd"
 	"github.com/unixpickle/weakai/neuralnet"
@@ -31,3 +32,69 @@ func TestTotalCostBlock(t *testing.T) {
 		t.Errorf("expected %v but got %v", expected, actual)
 	}
 }
+
+func TestTotalCostWeights(t *testing.T) {
+	block, samples := weightsTestData(3, 4)
+	actual := TotalCostBlock(block, 7, samples, neuralnet.MeanSquaredCost{})
+	expected := TotalCostSeqFunc(&rnn.BlockSeqFunc{B: block},
+		7, samples, neuralnet.MeanSquaredCost{})
+	if math.Abs(actual-expected) > 1e-5 {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+
+	var manual float64
+	for i := 0; i < samples.Len(); i++ {
+		sample := samples.GetSample(i).(Sample)
+		runner := &rnn.Runner{Block: block}
+		for j, in := range sample.Inputs {
+			out := runner.StepTime(in)
+			if sample.Weights[j] == 0 {
+				continue
+			}
+			cost := neuralnet.MeanSquaredCost{}.Cost(sample.Outputs[j],
+				&autofunc.Variable{Vector: out}).Output()[0]
+			manual += cost * sample.Weights[j]
+		}
+	}
+	if math.Abs(manual-expected) > 1e-5 {
+		t.Errorf("expected %v but got %v", manual, expected)
+	}
+}
+
+func TestTotalCostWeightsMismatch(t *testing.T) {
+	sample := Sample{
+		Inputs:  []linalg.Vector{{1, 2, 3}, {3, 2, 1}},
+		Outputs: []linalg.Vector{{1, 0, 0, 0}, {0, 1, 0, 0}},
+		Weights: []float64{1},
+	}
+	defer func() {
+		if r := recover(); r != "sample weight count does not match output count" {
+			t.Errorf("unexpected panic: %v", r)
+		}
+	}()
+	TotalCostBlock(rnn.NewLSTM(3, 4), 7, sgd.SliceSampleSet{sample},
+		neuralnet.MeanSquaredCost{})
+}
+
+// weightsTestData generates samples with random weights.
+// Time steps with a weight of 0 have nil outputs, which
+// ensures that masked time steps are never evaluated.
+func weightsTestData(inSize, outSize int) (*rnn.LSTM, sgd.SampleSet) {
+	block := rnn.NewLSTM(inSize, outSize)
+	var samples sgd.SliceSampleSet
+	for i := 0; i < 20; i++ {
+		size := rand.Intn(7)
+		inSeq := make([]linalg.Vector, size)
+		outSeq := make([]linalg.Vector, size)
+		weights := make([]float64, size)
+		for j := range inSeq {
+			inSeq[j] = linalg.RandVector(inSize)
+			if rand.Intn(3) != 0 {
+				outSeq[j] = linalg.RandVector(outSize)
+				weights[j] = rand.Float64() * 2
+			}
+		}
+		samples = append(samples, Sample{Inputs: inSeq, Outputs: outSeq, Weights: weights})
+	}
+	return block, samples
+}
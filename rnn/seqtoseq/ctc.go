@@ -0,0 +1,284 @@
+package seqtoseq
+
+import (
+	"math"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// CTCLogLikelihood computes the log likelihood of a label
+// sequence under Connectionist Temporal Classification,
+// as described in
+// http://www.cs.toronto.edu/~graves/icml_2006.pdf.
+//
+// Each entry of seq is a vector of log probabilities for
+// one time step, such as the output of a LogSoftmaxLayer.
+// The last entry of each vector is the blank symbol, so
+// the labels range from 0 to len(seq[i])-2.
+//
+// The forward algorithm is computed in log space, so the
+// result can be differentiated without underflow.
+func CTCLogLikelihood(seq []autofunc.Result, label []int) autofunc.Result {
+	if len(seq) == 0 {
+		return ctcEmptyLikelihood(label)
+	}
+	blank := len(seq[0].Output()) - 1
+	extended, skipMask := ctcExtendedLabel(label, blank)
+
+	var alpha autofunc.Result = ctcStartAlpha(len(extended))
+	skipVar := &autofunc.Variable{Vector: skipMask}
+	for _, step := range seq {
+		var probs []autofunc.Result
+		for _, x := range extended {
+			probs = append(probs, autofunc.Slice(step, x, x+1))
+		}
+		stay := alpha
+		next := ctcShift(alpha, 1)
+		skip := autofunc.Add(ctcShift(alpha, 2), skipVar)
+		sum := logAddExp(logAddExp(stay, next), skip)
+		alpha = autofunc.Add(sum, autofunc.Concat(probs...))
+	}
+
+	n := len(extended)
+	if n == 1 {
+		return alpha
+	}
+	return logAddExp(autofunc.Slice(alpha, n-1, n), autofunc.Slice(alpha, n-2, n-1))
+}
+
+// CTCLogLikelihoodR is like CTCLogLikelihood, but with
+// support for the R operator.
+func CTCLogLikelihoodR(seq []autofunc.RResult, label []int) autofunc.RResult {
+	if len(seq) == 0 {
+		return autofunc.NewRVariable(ctcEmptyLikelihood(label), autofunc.RVector{})
+	}
+	blank := len(seq[0].Output()) - 1
+	extended, skipMask := ctcExtendedLabel(label, blank)
+
+	var alpha autofunc.RResult = autofunc.NewRVariable(ctcStartAlpha(len(extended)),
+		autofunc.RVector{})
+	skipVar := autofunc.NewRVariable(&autofunc.Variable{Vector: skipMask},
+		autofunc.RVector{})
+	for _, step := range seq {
+		var probs []autofunc.RResult
+		for _, x := range extended {
+			probs = append(probs, autofunc.SliceR(step, x, x+1))
+		}
+		stay := alpha
+		next := ctcShiftR(alpha, 1)
+		skip := autofunc.AddR(ctcShiftR(alpha, 2), skipVar)
+		sum := logAddExpR(logAddExpR(stay, next), skip)
+		alpha = autofunc.AddR(sum, autofunc.ConcatR(probs...))
+	}
+
+	n := len(extended)
+	if n == 1 {
+		return alpha
+	}
+	return logAddExpR(autofunc.SliceR(alpha, n-1, n), autofunc.SliceR(alpha, n-2, n-1))
+}
+
+// ctcExtendedLabel inserts blanks between the labels and
+// at both ends of the label sequence.
+// It also returns a vector which is 0 at positions that
+// may be reached by skipping a blank, and -inf elsewhere.
+func ctcExtendedLabel(label []int, blank int) (extended []int, skipMask linalg.Vector) {
+	extended = make([]int, len(label)*2+1)
+	skipMask = make(linalg.Vector, len(extended))
+	for i := range extended {
+		if i%2 == 0 {
+			extended[i] = blank
+		} else {
+			extended[i] = label[i/2]
+		}
+		if i < 2 || extended[i] == blank || extended[i] == extended[i-2] {
+			skipMask[i] = math.Inf(-1)
+		}
+	}
+	return
+}
+
+// ctcStartAlpha creates a vector of log probabilities
+// for the time step before the first input, from which
+// only the first two extended labels can be reached.
+func ctcStartAlpha(n int) *autofunc.Variable {
+	res := &autofunc.Variable{Vector: make(linalg.Vector, n)}
+	for i := 1; i < n; i++ {
+		res.Vector[i] = math.Inf(-1)
+	}
+	return res
+}
+
+func ctcEmptyLikelihood(label []int) *autofunc.Variable {
+	if len(label) == 0 {
+		return &autofunc.Variable{Vector: []float64{0}}
+	}
+	return &autofunc.Variable{Vector: []float64{math.Inf(-1)}}
+}
+
+// ctcShift shifts a vector of log probabilities forward
+// by n entries, filling in the beginning with -inf.
+func ctcShift(vec autofunc.Result, n int) autofunc.Result {
+	size := len(vec.Output())
+	if n >= size {
+		return ctcNegInf(size)
+	}
+	return autofunc.Concat(ctcNegInf(n), autofunc.Slice(vec, 0, size-n))
+}
+
+func ctcShiftR(vec autofunc.RResult, n int) autofunc.RResult {
+	size := len(vec.Output())
+	if n >= size {
+		return autofunc.NewRVariable(ctcNegInf(size), autofunc.RVector{})
+	}
+	return autofunc.ConcatR(autofunc.NewRVariable(ctcNegInf(n), autofunc.RVector{}),
+		autofunc.SliceR(vec, 0, size-n))
+}
+
+func ctcNegInf(n int) *autofunc.Variable {
+	res := &autofunc.Variable{Vector: make(linalg.Vector, n)}
+	for i := range res.Vector {
+		res.Vector[i] = math.Inf(-1)
+	}
+	return res
+}
+
+// logAddExp computes log(exp(a)+exp(b)) component-wise,
+// treating -inf as a probability of zero.
+func logAddExp(a, b autofunc.Result) autofunc.Result {
+	out, weightsA, weightsB := logAddExpForward(a.Output(), b.Output())
+	return &logAddExpResult{
+		OutputVec: out,
+		WeightsA:  weightsA,
+		WeightsB:  weightsB,
+		A:         a,
+		B:         b,
+	}
+}
+
+func logAddExpR(a, b autofunc.RResult) autofunc.RResult {
+	out, weightsA, weightsB := logAddExpForward(a.Output(), b.Output())
+	aR, bR := a.ROutput(), b.ROutput()
+	outR := make(linalg.Vector, len(out))
+	for i := range outR {
+		if weightsA[i] != 0 {
+			outR[i] += weightsA[i] * aR[i]
+		}
+		if weightsB[i] != 0 {
+			outR[i] += weightsB[i] * bR[i]
+		}
+	}
+	return &logAddExpRResult{
+		OutputVec:  out,
+		ROutputVec: outR,
+		WeightsA:   weightsA,
+		WeightsB:   weightsB,
+		A:          a,
+		B:          b,
+	}
+}
+
+// logAddExpForward computes the output of logAddExp and
+// the partial derivatives with respect to both inputs.
+func logAddExpForward(a, b linalg.Vector) (out, weightsA, weightsB linalg.Vector) {
+	out = make(linalg.Vector, len(a))
+	weightsA = make(linalg.Vector, len(a))
+	weightsB = make(linalg.Vector, len(a))
+	for i, x := range a {
+		y := b[i]
+		if math.IsInf(x, -1) && math.IsInf(y, -1) {
+			out[i] = math.Inf(-1)
+			continue
+		}
+		max := math.Max(x, y)
+		out[i] = max + math.Log(math.Exp(x-max)+math.Exp(y-max))
+		weightsA[i] = math.Exp(x - out[i])
+		weightsB[i] = math.Exp(y - out[i])
+	}
+	return
+}
+
+type logAddExpResult struct {
+	OutputVec linalg.Vector
+	WeightsA  linalg.Vector
+	WeightsB  linalg.Vector
+	A         autofunc.Result
+	B         autofunc.Result
+}
+
+func (l *logAddExpResult) Output() linalg.Vector {
+	return l.OutputVec
+}
+
+func (l *logAddExpResult) Constant(g autofunc.Gradient) bool {
+	return l.A.Constant(g) && l.B.Constant(g)
+}
+
+func (l *logAddExpResult) PropagateGradient(upstream linalg.Vector, g autofunc.Gradient) {
+	if !l.A.Constant(g) {
+		down := make(linalg.Vector, len(upstream))
+		for i, u := range upstream {
+			down[i] = u * l.WeightsA[i]
+		}
+		l.A.PropagateGradient(down, g)
+	}
+	if !l.B.Constant(g) {
+		for i, u := range upstream {
+			upstream[i] = u * l.WeightsB[i]
+		}
+		l.B.PropagateGradient(upstream, g)
+	}
+}
+
+type logAddExpRResult struct {
+	OutputVec  linalg.Vector
+	ROutputVec linalg.Vector
+	WeightsA   linalg.Vector
+	WeightsB   linalg.Vector
+	A          autofunc.RResult
+	B          autofunc.RResult
+}
+
+func (l *logAddExpRResult) Output() linalg.Vector {
+	return l.OutputVec
+}
+
+func (l *logAddExpRResult) ROutput() linalg.Vector {
+	return l.ROutputVec
+}
+
+func (l *logAddExpRResult) Constant(rg autofunc.RGradient, g autofunc.Gradient) bool {
+	return l.A.Constant(rg, g) && l.B.Constant(rg, g)
+}
+
+func (l *logAddExpRResult) PropagateRGradient(upstream, upstreamR linalg.Vector,
+	rg autofunc.RGradient, g autofunc.Gradient) {
+	if !l.A.Constant(rg, g) {
+		down, downR := l.downstream(upstream, upstreamR, l.WeightsA, l.A.ROutput())
+		l.A.PropagateRGradient(down, downR, rg, g)
+	}
+	if !l.B.Constant(rg, g) {
+		down, downR := l.downstream(upstream, upstreamR, l.WeightsB, l.B.ROutput())
+		l.B.PropagateRGradient(down, downR, rg, g)
+	}
+}
+
+// downstream computes the gradient with respect to one of
+// the inputs, given that input's weights and R output.
+//
+// The derivative of a weight exp(x-out) with respect to R
+// is weight*(xR-outR).
+func (l *logAddExpRResult) downstream(upstream, upstreamR, weights,
+	inR linalg.Vector) (down, downR linalg.Vector) {
+	down = make(linalg.Vector, len(upstream))
+	downR = make(linalg.Vector, len(upstream))
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		down[i] = upstream[i] * w
+		downR[i] = upstreamR[i]*w + upstream[i]*w*(inR[i]-l.ROutputVec[i])
+	}
+	return
+}
@@ -0,0 +1,163 @@
+package seqtoseq
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// CTCGreedyDecode decodes a sequence of log probabilities
+// by taking the most likely symbol at each time step,
+// merging repeated symbols, and removing blanks.
+//
+// As in CTCLogLikelihood, the blank is the last entry of
+// each vector.
+func CTCGreedyDecode(seq []linalg.Vector) []int {
+	var res []int
+	last := -1
+	for _, vec := range seq {
+		blank := len(vec) - 1
+		var maxIdx int
+		for i, x := range vec {
+			if x > vec[maxIdx] {
+				maxIdx = i
+			}
+		}
+		if maxIdx != blank && maxIdx != last {
+			res = append(res, maxIdx)
+		}
+		last = maxIdx
+	}
+	return res
+}
+
+// CTCPrefixBeamSearch decodes a sequence of log
+// probabilities using prefix beam search, which keeps
+// track of the width most likely label prefixes while
+// summing over all of the alignments of each prefix.
+//
+// As in CTCLogLikelihood, the blank is the last entry of
+// each vector.
+//
+// The width must be at least 1.
+func CTCPrefixBeamSearch(seq []linalg.Vector, width int) []int {
+	if width < 1 {
+		panic("beam width must be at least 1")
+	}
+	beams := map[string]*ctcPrefix{
+		"": {Blank: 0, NonBlank: math.Inf(-1)},
+	}
+	for _, vec := range seq {
+		blank := len(vec) - 1
+		next := map[string]*ctcPrefix{}
+		getNext := func(label []int) *ctcPrefix {
+			key := ctcPrefixKey(label)
+			if p, ok := next[key]; ok {
+				return p
+			}
+			p := &ctcPrefix{Label: label, Blank: math.Inf(-1), NonBlank: math.Inf(-1)}
+			next[key] = p
+			return p
+		}
+		for _, prefix := range beams {
+			total := prefix.Total()
+
+			// Emitting a blank keeps the prefix the same.
+			stay := getNext(prefix.Label)
+			stay.Blank = addLogProbs(stay.Blank, total+vec[blank])
+
+			for symbol, logProb := range vec {
+				if symbol == blank {
+					continue
+				}
+				extended := append(append([]int{}, prefix.Label...), symbol)
+				ext := getNext(extended)
+				n := len(prefix.Label)
+				if n > 0 && prefix.Label[n-1] == symbol {
+					// A repeated symbol only extends the prefix
+					// if a blank separates it from the last one.
+					ext.NonBlank = addLogProbs(ext.NonBlank, prefix.Blank+logProb)
+					stay.NonBlank = addLogProbs(stay.NonBlank, prefix.NonBlank+logProb)
+				} else {
+					ext.NonBlank = addLogProbs(ext.NonBlank, total+logProb)
+				}
+			}
+		}
+		beams = ctcPrune(next, width)
+	}
+
+	var best *ctcPrefix
+	for _, prefix := range beams {
+		if best == nil || prefix.Total() > best.Total() {
+			best = prefix
+		}
+	}
+	return best.Label
+}
+
+type ctcPrefix struct {
+	Label []int
+
+	// Blank and NonBlank are the log probabilities of the
+	// prefix with and without a trailing blank.
+	Blank    float64
+	NonBlank float64
+}
+
+func (c *ctcPrefix) Total() float64 {
+	return addLogProbs(c.Blank, c.NonBlank)
+}
+
+// ctcPrefixKey encodes a label as a map key.
+// Varints are used so that every label gets a unique key.
+func ctcPrefixKey(label []int) string {
+	var buf [binary.MaxVarintLen64]byte
+	key := make([]byte, 0, len(label))
+	for _, x := range label {
+		n := binary.PutVarint(buf[:], int64(x))
+		key = append(key, buf[:n]...)
+	}
+	return string(key)
+}
+
+func ctcPrune(prefixes map[string]*ctcPrefix, width int) map[string]*ctcPrefix {
+	if len(prefixes) <= width {
+		return prefixes
+	}
+	var list ctcPrefixSorter
+	for _, p := range prefixes {
+		list = append(list, p)
+	}
+	sort.Sort(list)
+	res := map[string]*ctcPrefix{}
+	for _, p := range list[:width] {
+		res[ctcPrefixKey(p.Label)] = p
+	}
+	return res
+}
+
+func addLogProbs(p1, p2 float64) float64 {
+	if math.IsInf(p1, -1) {
+		return p2
+	} else if math.IsInf(p2, -1) {
+		return p1
+	}
+	max := math.Max(p1, p2)
+	return max + math.Log(math.Exp(p1-max)+math.Exp(p2-max))
+}
+
+type ctcPrefixSorter []*ctcPrefix
+
+func (c ctcPrefixSorter) Len() int {
+	return len(c)
+}
+
+func (c ctcPrefixSorter) Less(i, j int) bool {
+	return c[i].Total() > c[j].Total()
+}
+
+func (c ctcPrefixSorter) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
@@ -0,0 +1,159 @@
+package seqtoseq
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/seqfunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// A CTCGradienter is an sgd.RGradienter which trains a
+// seqfunc.RFunc on sample sets of CTCSample objects by
+// minimizing the negative CTC log likelihood (see
+// CTCLogLikelihood).
+//
+// The outputs of SeqFunc should be log probabilities,
+// with the blank symbol as the last entry of each vector.
+//
+// After an instance is used once, it should never be
+// reused with different parameters.
+type CTCGradienter struct {
+	SeqFunc seqfunc.RFunc
+	Learner sgd.Learner
+
+	// MaxLanes specifies the maximum number of sequences
+	// to evaluate in a single batch.
+	// If this is 0, a reasonable default is used.
+	MaxLanes int
+
+	// MaxGoroutines specifies the maximum number of
+	// Goroutines on which to compute gradients at once.
+	MaxGoroutines int
+
+	// Processor is used to clip gradients and add noise
+	// to them.
+	Processor neuralnet.GradProcessor
+
+	helper *neuralnet.GradHelper
+}
+
+func (c *CTCGradienter) Gradient(set sgd.SampleSet) autofunc.Gradient {
+	return c.makeHelper().Gradient(set)
+}
+
+func (c *CTCGradienter) RGradient(v autofunc.RVector,
+	set sgd.SampleSet) (autofunc.Gradient, autofunc.RGradient) {
+	return c.makeHelper().RGradient(v, set)
+}
+
+func (c *CTCGradienter) makeHelper() *neuralnet.GradHelper {
+	if c.helper != nil {
+		c.helper.MaxConcurrency = c.MaxGoroutines
+		c.helper.MaxSubBatch = c.MaxLanes
+		c.helper.Processor = c.Processor
+		return c.helper
+	}
+	c.helper = &neuralnet.GradHelper{
+		MaxConcurrency: c.MaxGoroutines,
+		MaxSubBatch:    c.MaxLanes,
+		Learner:        c.Learner,
+		Processor:      c.Processor,
+		CompGrad:       c.runBatch,
+		CompRGrad:      c.runBatchR,
+	}
+	return c.helper
+}
+
+func (c *CTCGradienter) runBatch(grad autofunc.Gradient, set sgd.SampleSet) {
+	samples := ctcSampleSlice(set)
+	var seqIns [][]linalg.Vector
+	for _, s := range samples {
+		seqIns = append(seqIns, s.Input)
+	}
+	output := c.SeqFunc.ApplySeqs(seqfunc.ConstResult(seqIns))
+
+	upstream := make([][]linalg.Vector, len(samples))
+	for i, outSeq := range output.OutputSeqs() {
+		vars := make([]*autofunc.Variable, len(outSeq))
+		varResults := make([]autofunc.Result, len(outSeq))
+		for j, x := range outSeq {
+			vars[j] = &autofunc.Variable{Vector: x}
+			varResults[j] = vars[j]
+		}
+		seqGrad := autofunc.NewGradient(vars)
+		cost := CTCLogLikelihood(varResults, samples[i].Label)
+		cost.PropagateGradient([]float64{-1}, seqGrad)
+		upstream[i] = make([]linalg.Vector, len(outSeq))
+		for j, v := range vars {
+			upstream[i][j] = seqGrad[v]
+		}
+	}
+
+	output.PropagateGradient(upstream, grad)
+}
+
+func (c *CTCGradienter) runBatchR(rv autofunc.RVector, rg autofunc.RGradient,
+	grad autofunc.Gradient, set sgd.SampleSet) {
+	samples := ctcSampleSlice(set)
+	var seqIns [][]linalg.Vector
+	for _, s := range samples {
+		seqIns = append(seqIns, s.Input)
+	}
+	output := c.SeqFunc.ApplySeqsR(rv, seqfunc.ConstRResult(seqIns))
+
+	upstream := make([][]linalg.Vector, len(samples))
+	upstreamR := make([][]linalg.Vector, len(samples))
+	for i, outSeq := range output.OutputSeqs() {
+		rOutSeq := output.ROutputSeqs()[i]
+		vars := make([]*autofunc.Variable, len(outSeq))
+		varResults := make([]autofunc.RResult, len(outSeq))
+		for j, x := range outSeq {
+			vars[j] = &autofunc.Variable{Vector: x}
+			varResults[j] = &autofunc.RVariable{
+				Variable:   vars[j],
+				ROutputVec: rOutSeq[j],
+			}
+		}
+		seqGrad := autofunc.NewGradient(vars)
+		seqRGrad := autofunc.NewRGradient(vars)
+		cost := CTCLogLikelihoodR(varResults, samples[i].Label)
+		cost.PropagateRGradient([]float64{-1}, []float64{0}, seqRGrad, seqGrad)
+		upstream[i] = make([]linalg.Vector, len(outSeq))
+		upstreamR[i] = make([]linalg.Vector, len(outSeq))
+		for j, v := range vars {
+			upstream[i][j] = seqGrad[v]
+			upstreamR[i][j] = seqRGrad[v]
+		}
+	}
+
+	output.PropagateRGradient(upstream, upstreamR, rg, grad)
+}
+
+// TotalCostCTC runs a seqfunc.RFunc on a set of
+// CTCSamples and evaluates the total negative log
+// likelihood of the labels.
+//
+// The batchSize specifies how many samples to run in
+// batches while computing the cost.
+func TotalCostCTC(f seqfunc.RFunc, batchSize int, s sgd.SampleSet) float64 {
+	var totalCost float64
+	for i := 0; i < s.Len(); i += batchSize {
+		var inSeqs [][]linalg.Vector
+		var labels [][]int
+		for j := i; j < i+batchSize && j < s.Len(); j++ {
+			sample := s.GetSample(j).(CTCSample)
+			inSeqs = append(inSeqs, sample.Input)
+			labels = append(labels, sample.Label)
+		}
+		output := f.ApplySeqs(seqfunc.ConstResult(inSeqs))
+		for j, outSeq := range output.OutputSeqs() {
+			varResults := make([]autofunc.Result, len(outSeq))
+			for k, x := range outSeq {
+				varResults[k] = &autofunc.Variable{Vector: x}
+			}
+			totalCost -= CTCLogLikelihood(varResults, labels[j]).Output()[0]
+		}
+	}
+	return totalCost
+}
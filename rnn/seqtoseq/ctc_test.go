@@ -0,0 +1,276 @@
+package seqtoseq
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/autofunc/functest"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+func TestCTCLogLikelihood(t *testing.T) {
+	seq := ctcTestSeq(4, 3)
+	labels := [][]int{nil, {0}, {1}, {0, 1}, {1, 1}, {0, 0, 1}, {0, 1, 0, 1, 0}}
+	for _, label := range labels {
+		expected := math.Log(ctcTestLabelProbs(seq)[ctcPrefixKey(label)])
+		varSeq := make([]autofunc.Result, len(seq))
+		for i, x := range seq {
+			varSeq[i] = &autofunc.Variable{Vector: x}
+		}
+		actual := CTCLogLikelihood(varSeq, label).Output()[0]
+		if math.Abs(actual-expected) > 1e-8 &&
+			!(math.IsInf(actual, -1) && math.IsInf(expected, -1)) {
+			t.Errorf("label %v: expected %f but got %f", label, expected, actual)
+		}
+	}
+}
+
+func TestCTCLogLikelihoodRProp(t *testing.T) {
+	for _, label := range [][]int{nil, {1}, {0, 1, 1}} {
+		f := &ctcTestFunc{Label: label, StepCount: 5}
+		inVar := &autofunc.Variable{Vector: make(linalg.Vector, 5*3)}
+		rv := autofunc.RVector{inVar: make(linalg.Vector, len(inVar.Vector))}
+		for i := range inVar.Vector {
+			inVar.Vector[i] = rand.NormFloat64()
+			rv[inVar][i] = rand.NormFloat64()
+		}
+		checker := &functest.RFuncChecker{
+			F:     f,
+			Vars:  []*autofunc.Variable{inVar},
+			Input: inVar,
+			RV:    rv,
+		}
+		checker.FullCheck(t)
+	}
+}
+
+func TestCTCGreedyDecode(t *testing.T) {
+	seq := []linalg.Vector{
+		{0.7, 0.2, 0.1},
+		{0.6, 0.1, 0.3},
+		{0.1, 0.1, 0.8},
+		{0.8, 0.1, 0.1},
+		{0.1, 0.7, 0.2},
+		{0.1, 0.7, 0.2},
+		{0.1, 0.2, 0.7},
+	}
+	for _, x := range seq {
+		for i := range x {
+			x[i] = math.Log(x[i])
+		}
+	}
+	actual := CTCGreedyDecode(seq)
+	expected := []int{0, 0, 1}
+	if !ctcTestLabelsEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestCTCPrefixBeamSearch(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		seq := ctcTestSeq(4, 3)
+		var expected []int
+		var bestProb float64
+		for key, prob := range ctcTestLabelProbs(seq) {
+			if prob > bestProb {
+				bestProb = prob
+				expected = ctcTestKeyLabel(key)
+			}
+		}
+		actual := CTCPrefixBeamSearch(seq, 100)
+		if !ctcTestLabelsEqual(actual, expected) {
+			t.Errorf("expected %v but got %v", expected, actual)
+		}
+	}
+}
+
+func TestCTCPrefixBeamSearchWidth(t *testing.T) {
+	seq := ctcTestSeq(4, 3)
+	expected := CTCGreedyDecode(seq)
+	if actual := CTCPrefixBeamSearch(seq, 1); len(actual) > len(expected) {
+		t.Errorf("width 1 produced %v, which is longer than %v", actual, expected)
+	}
+	for _, width := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for width %d", width)
+				}
+			}()
+			CTCPrefixBeamSearch(seq, width)
+		}()
+	}
+}
+
+func TestCTCPrefixKey(t *testing.T) {
+	labels := [][]int{
+		{}, {0}, {0, 0}, {1}, {0xd800}, {0xd801}, {0x110000}, {-1}, {-2},
+		{1, 0x7f}, {0xff}, {0x7f, 1},
+	}
+	seen := map[string]int{}
+	for i, label := range labels {
+		key := ctcPrefixKey(label)
+		if j, ok := seen[key]; ok {
+			t.Errorf("labels %v and %v have the same key", labels[j], label)
+		}
+		seen[key] = i
+	}
+}
+
+func TestCTCGradienter(t *testing.T) {
+	net := neuralnet.Network{
+		neuralnet.NewDenseLayer(2, 3),
+		&neuralnet.LogSoftmaxLayer{},
+	}
+	f := &rnn.NetworkSeqFunc{Network: net}
+	var samples sgd.SliceSampleSet
+	for i := 0; i < 6; i++ {
+		input := make([]linalg.Vector, rand.Intn(5)+1)
+		for j := range input {
+			input[j] = linalg.RandVector(2)
+		}
+		label := make([]int, rand.Intn(len(input)/2+1))
+		for j := range label {
+			label[j] = rand.Intn(2)
+		}
+		samples = append(samples, CTCSample{Input: input, Label: label})
+	}
+	g := &CTCGradienter{SeqFunc: f, Learner: net, MaxLanes: 2}
+
+	const delta = 1e-5
+	actual := copyGrad(g.Gradient(samples))
+	for _, param := range net.Parameters() {
+		for i := range param.Vector {
+			old := param.Vector[i]
+			param.Vector[i] = old + delta
+			cost1 := TotalCostCTC(f, 4, samples)
+			param.Vector[i] = old - delta
+			cost2 := TotalCostCTC(f, 4, samples)
+			param.Vector[i] = old
+			expected := (cost1 - cost2) / (2 * delta)
+			if math.Abs(actual[param][i]-expected) > 1e-4 {
+				t.Errorf("bad gradient entry: expected %f but got %f", expected,
+					actual[param][i])
+			}
+		}
+	}
+
+	rv := truncatedTestRV(net)
+	actualGrad, actualRGrad := g.RGradient(rv, samples)
+	truncatedTestCompare(t, "gradient", actual, actualGrad)
+	actualRGrad = autofunc.RGradient(copyGrad(autofunc.Gradient(actualRGrad)))
+	for _, param := range net.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(delta))
+	}
+	grad1 := copyGrad(g.Gradient(samples))
+	for _, param := range net.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(-2 * delta))
+	}
+	grad2 := g.Gradient(samples)
+	for _, param := range net.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(delta))
+	}
+	for _, param := range net.Parameters() {
+		for i, x := range grad1[param] {
+			expected := (x - grad2[param][i]) / (2 * delta)
+			if math.Abs(actualRGrad[param][i]-expected) > 1e-4 {
+				t.Errorf("bad r-gradient entry: expected %f but got %f", expected,
+					actualRGrad[param][i])
+			}
+		}
+	}
+}
+
+type ctcTestFunc struct {
+	Label     []int
+	StepCount int
+}
+
+func (c *ctcTestFunc) Apply(in autofunc.Result) autofunc.Result {
+	return CTCLogLikelihood(autofunc.Split(c.StepCount, in), c.Label)
+}
+
+func (c *ctcTestFunc) ApplyR(rv autofunc.RVector, in autofunc.RResult) autofunc.RResult {
+	return CTCLogLikelihoodR(autofunc.SplitR(c.StepCount, in), c.Label)
+}
+
+// ctcTestSeq generates a random sequence of normalized
+// log probabilities.
+func ctcTestSeq(steps, size int) []linalg.Vector {
+	var res []linalg.Vector
+	for i := 0; i < steps; i++ {
+		vec := make(linalg.Vector, size)
+		var sum float64
+		for j := range vec {
+			vec[j] = rand.Float64() + 0.1
+			sum += vec[j]
+		}
+		for j := range vec {
+			vec[j] = math.Log(vec[j] / sum)
+		}
+		res = append(res, vec)
+	}
+	return res
+}
+
+// ctcTestLabelProbs enumerates every alignment to find
+// the probability of each possible label.
+func ctcTestLabelProbs(seq []linalg.Vector) map[string]float64 {
+	res := map[string]float64{}
+	size := len(seq[0])
+	blank := size - 1
+	alignment := make([]int, len(seq))
+	for {
+		prob := 1.0
+		var label []int
+		for t, x := range alignment {
+			prob *= math.Exp(seq[t][x])
+			if x != blank && (t == 0 || alignment[t-1] != x) {
+				label = append(label, x)
+			}
+		}
+		res[ctcPrefixKey(label)] += prob
+
+		var i int
+		for i = 0; i < len(alignment); i++ {
+			alignment[i]++
+			if alignment[i] < size {
+				break
+			}
+			alignment[i] = 0
+		}
+		if i == len(alignment) {
+			break
+		}
+	}
+	return res
+}
+
+func ctcTestKeyLabel(key string) []int {
+	var res []int
+	data := []byte(key)
+	for len(data) > 0 {
+		x, n := binary.Varint(data)
+		res = append(res, int(x))
+		data = data[n:]
+	}
+	return res
+}
+
+func ctcTestLabelsEqual(l1, l2 []int) bool {
+	if len(l1) != len(l2) {
+		return false
+	}
+	for i, x := range l1 {
+		if l2[i] != x {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package seqtoseq
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+// An EncDecGradienter is an sgd.RGradienter which trains
+// an encoder-decoder model on sample sets of EncDecSample
+// objects.
+//
+// The Encoder is run on the input sequence, and its
+// final state is used as the start state of the Decoder.
+// Thus, the two Blocks must use compatible states (e.g.
+// they could both be LSTMs with the same hidden size).
+// The Decoder's own start state is never used.
+//
+// The Decoder is trained with teacher forcing: at each
+// time step after the first, it is fed the expected
+// output from the previous time step.
+//
+// After an instance is used once, it should never be
+// reused with different parameters.
+type EncDecGradienter struct {
+	Encoder  rnn.Block
+	Decoder  rnn.Block
+	Learner  sgd.Learner
+	CostFunc neuralnet.CostFunc
+
+	// StartInput is the input fed to the Decoder at the
+	// first time step.
+	// If it is nil, a vector of zeroes is used.
+	StartInput linalg.Vector
+
+	// MaxLanes specifies the maximum number of lanes
+	// any BlockInput or BlockRInput may have at once
+	// while computing gradients.
+	// If this is 0, a reasonable default is used.
+	MaxLanes int
+
+	// MaxGoroutines specifies the maximum number of
+	// Goroutines on which to compute gradients at once.
+	MaxGoroutines int
+
+	// Processor is used to clip gradients and add noise
+	// to them.
+	Processor neuralnet.GradProcessor
+
+	helper *neuralnet.GradHelper
+}
+
+func (e *EncDecGradienter) Gradient(set sgd.SampleSet) autofunc.Gradient {
+	return e.makeHelper().Gradient(set)
+}
+
+func (e *EncDecGradienter) RGradient(v autofunc.RVector,
+	set sgd.SampleSet) (autofunc.Gradient, autofunc.RGradient) {
+	return e.makeHelper().RGradient(v, set)
+}
+
+func (e *EncDecGradienter) makeHelper() *neuralnet.GradHelper {
+	if e.helper != nil {
+		e.helper.MaxConcurrency = e.MaxGoroutines
+		e.helper.MaxSubBatch = e.MaxLanes
+		e.helper.Processor = e.Processor
+		return e.helper
+	}
+	e.helper = &neuralnet.GradHelper{
+		MaxConcurrency: e.MaxGoroutines,
+		MaxSubBatch:    e.MaxLanes,
+		Learner:        e.Learner,
+		Processor:      e.Processor,
+		CompGrad:       e.runBatch,
+		CompRGrad:      e.runBatchR,
+	}
+	return e.helper
+}
+
+func (e *EncDecGradienter) runBatch(grad autofunc.Gradient, set sgd.SampleSet) {
+	samples := encDecSampleSlice(set)
+	encStart := make([]rnn.State, len(samples))
+	for i := range encStart {
+		encStart[i] = e.Encoder.StartState()
+	}
+	encIns, decIns := encDecInputs(samples, e.StartInput)
+	encRun := runBlock(e.Encoder, encStart, encIns)
+	decRun := runBlock(e.Decoder, encRun.Final, decIns)
+
+	upstream := make([][]linalg.Vector, len(samples))
+	for i, outSeq := range decRun.Outputs {
+		upstream[i] = make([]linalg.Vector, len(outSeq))
+		for j, actual := range outSeq {
+			upstream[i][j] = costFuncDeriv(e.CostFunc, samples[i].Outputs[j], actual, 1)
+		}
+	}
+
+	decStartGrad := decRun.PropagateGradient(upstream, nil, grad)
+	encStartGrad := encRun.PropagateGradient(nil, decStartGrad, grad)
+	propagateStart(e.Encoder, encStart, encStartGrad, grad)
+}
+
+func (e *EncDecGradienter) runBatchR(rv autofunc.RVector, rg autofunc.RGradient,
+	grad autofunc.Gradient, set sgd.SampleSet) {
+	samples := encDecSampleSlice(set)
+	encStart := make([]rnn.RState, len(samples))
+	for i := range encStart {
+		encStart[i] = e.Encoder.StartRState(rv)
+	}
+	encIns, decIns := encDecInputs(samples, e.StartInput)
+	encRun := runBlockR(rv, e.Encoder, encStart, encIns)
+	decRun := runBlockR(rv, e.Decoder, encRun.Final, decIns)
+
+	upstream := make([][]linalg.Vector, len(samples))
+	upstreamR := make([][]linalg.Vector, len(samples))
+	for i, outSeq := range decRun.Outputs {
+		upstream[i] = make([]linalg.Vector, len(outSeq))
+		upstreamR[i] = make([]linalg.Vector, len(outSeq))
+		for j, actual := range outSeq {
+			upstream[i][j], upstreamR[i][j] = costFuncRDeriv(e.CostFunc,
+				samples[i].Outputs[j], actual, decRun.ROutputs[i][j], 1)
+		}
+	}
+
+	decStartGrad := decRun.PropagateRGradient(upstream, upstreamR, nil, rg, grad)
+	encStartGrad := encRun.PropagateRGradient(nil, nil, decStartGrad, rg, grad)
+	propagateStartR(e.Encoder, encStart, encStartGrad, rg, grad)
+}
+
+// TotalCostEncDec runs an encoder-decoder model on a set
+// of EncDecSamples and evaluates the total output cost.
+// The model is run exactly as it is by EncDecGradienter,
+// using teacher forcing and the given start input.
+//
+// The batchSize specifies how many samples to run in
+// batches while computing the cost.
+// If it is 0, the whole thing is run in one batch.
+func TotalCostEncDec(encoder, decoder rnn.Block, startInput linalg.Vector, batchSize int,
+	s sgd.SampleSet, c neuralnet.CostFunc) float64 {
+	if batchSize == 0 {
+		batchSize = s.Len()
+	}
+	var totalCost float64
+	for i := 0; i < s.Len(); i += batchSize {
+		bs := batchSize
+		if bs > s.Len()-i {
+			bs = s.Len() - i
+		}
+		samples := encDecSampleSlice(s.Subset(i, i+bs))
+		encStart := make([]rnn.State, len(samples))
+		for j := range encStart {
+			encStart[j] = encoder.StartState()
+		}
+		encIns, decIns := encDecInputs(samples, startInput)
+		encRun := runBlock(encoder, encStart, encIns)
+		decRun := runBlock(decoder, encRun.Final, decIns)
+		for j, outSeq := range decRun.Outputs {
+			for k, actual := range outSeq {
+				expected := samples[j].Outputs[k]
+				actualVar := &autofunc.Variable{Vector: actual}
+				totalCost += c.Cost(expected, actualVar).Output()[0]
+			}
+		}
+	}
+	return totalCost
+}
+
+// encDecInputs generates the encoder inputs and the
+// teacher-forced decoder inputs for a batch.
+func encDecInputs(samples []EncDecSample, start linalg.Vector) (enc, dec [][]linalg.Vector) {
+	enc = make([][]linalg.Vector, len(samples))
+	dec = make([][]linalg.Vector, len(samples))
+	for i, sample := range samples {
+		enc[i] = sample.Inputs
+		if len(sample.Outputs) == 0 {
+			continue
+		}
+		first := start
+		if first == nil {
+			first = make(linalg.Vector, len(sample.Outputs[0]))
+		}
+		dec[i] = append([]linalg.Vector{first}, sample.Outputs[:len(sample.Outputs)-1]...)
+	}
+	return
+}
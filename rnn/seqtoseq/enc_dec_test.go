@@ -0,0 +1,121 @@
+package seqtoseq
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+const (
+	encDecTestDelta = 1e-5
+	encDecTestPrec  = 1e-4
+)
+
+func TestEncDecGradient(t *testing.T) {
+	g, samples := encDecTestGradienter()
+	actual := g.Gradient(samples)
+	for _, param := range g.Learner.Parameters() {
+		for i := range param.Vector {
+			old := param.Vector[i]
+			param.Vector[i] = old + encDecTestDelta
+			cost1 := TotalCostEncDec(g.Encoder, g.Decoder, g.StartInput, 3, samples,
+				g.CostFunc)
+			param.Vector[i] = old - encDecTestDelta
+			cost2 := TotalCostEncDec(g.Encoder, g.Decoder, g.StartInput, 3, samples,
+				g.CostFunc)
+			param.Vector[i] = old
+			expected := (cost1 - cost2) / (2 * encDecTestDelta)
+			if math.Abs(actual[param][i]-expected) > encDecTestPrec {
+				t.Errorf("bad gradient entry: expected %f but got %f", expected,
+					actual[param][i])
+			}
+		}
+	}
+}
+
+func TestEncDecRGradient(t *testing.T) {
+	g, samples := encDecTestGradienter()
+	rv := autofunc.RVector{}
+	for _, param := range g.Learner.Parameters() {
+		rv[param] = make(linalg.Vector, len(param.Vector))
+		for i := range rv[param] {
+			rv[param][i] = rand.NormFloat64()
+		}
+	}
+
+	expectedGrad := copyGrad(g.Gradient(samples))
+	actualGrad, actualRGrad := g.RGradient(rv, samples)
+	actualGrad = copyGrad(actualGrad)
+	actualRGrad = autofunc.RGradient(copyGrad(autofunc.Gradient(actualRGrad)))
+
+	for _, param := range g.Learner.Parameters() {
+		for i, x := range expectedGrad[param] {
+			if math.Abs(actualGrad[param][i]-x) > encDecTestPrec {
+				t.Errorf("bad gradient entry: expected %f but got %f", x,
+					actualGrad[param][i])
+			}
+		}
+	}
+
+	for _, param := range g.Learner.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(encDecTestDelta))
+	}
+	grad1 := copyGrad(g.Gradient(samples))
+	for _, param := range g.Learner.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(-2 * encDecTestDelta))
+	}
+	grad2 := g.Gradient(samples)
+	for _, param := range g.Learner.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(encDecTestDelta))
+	}
+
+	for _, param := range g.Learner.Parameters() {
+		for i, x := range grad1[param] {
+			expected := (x - grad2[param][i]) / (2 * encDecTestDelta)
+			if math.Abs(actualRGrad[param][i]-expected) > encDecTestPrec {
+				t.Errorf("bad r-gradient entry: expected %f but got %f", expected,
+					actualRGrad[param][i])
+			}
+		}
+	}
+}
+
+func encDecTestGradienter() (*EncDecGradienter, sgd.SampleSet) {
+	encoder := rnn.NewLSTM(3, 4)
+	decoder := rnn.NewLSTM(4, 4)
+	var samples sgd.SliceSampleSet
+	for i := 0; i < 10; i++ {
+		inSeq := make([]linalg.Vector, rand.Intn(4))
+		outSeq := make([]linalg.Vector, rand.Intn(4))
+		for j := range inSeq {
+			inSeq[j] = linalg.RandVector(3)
+		}
+		for j := range outSeq {
+			outSeq[j] = linalg.RandVector(4)
+		}
+		samples = append(samples, EncDecSample{Inputs: inSeq, Outputs: outSeq})
+	}
+	g := &EncDecGradienter{
+		Encoder:    encoder,
+		Decoder:    decoder,
+		Learner:    rnn.StackedBlock{encoder, decoder},
+		CostFunc:   neuralnet.MeanSquaredCost{},
+		StartInput: linalg.Vector{1, 0, 0, 0},
+		MaxLanes:   3,
+	}
+	return g, samples
+}
+
+func copyGrad(g autofunc.Gradient) autofunc.Gradient {
+	res := autofunc.Gradient{}
+	for k, v := range g {
+		res[k] = v.Copy()
+	}
+	return res
+}
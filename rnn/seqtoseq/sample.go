@@ -1,6 +1,8 @@
 // Package seqtoseq implements gradient-based training
 // for models which take an input sequence and produce
-// an output sequence of the same length.
+// an output sequence of the same length, as well as for
+// encoder-decoder models whose output sequences may have
+// arbitrary lengths.
 package seqtoseq
 
 import (
@@ -10,11 +12,19 @@ import (
 
 // Sample is a training sample containing an input
 // sequence and its corresponding output sequence.
-// All gradienters in this package take sample sets
+// Gradienter and TruncatedGradienter take sample sets
 // with Sample elements.
 type Sample struct {
 	Inputs  []linalg.Vector
 	Outputs []linalg.Vector
+
+	// Weights optionally specifies how much the cost at
+	// each time step should count.
+	// A weight of 0 masks out a time step entirely, which
+	// is useful for padding or for prompts.
+	// If Weights is nil, every time step has a weight of 1.
+	// Otherwise, it must have the same length as Outputs.
+	Weights []float64
 }
 
 // Hash returns a randomly-distributed hash of the sample.
@@ -22,5 +32,58 @@ func (s Sample) Hash() []byte {
 	allVecs := make([]linalg.Vector, len(s.Inputs)+len(s.Outputs))
 	copy(allVecs, s.Inputs)
 	copy(allVecs[len(s.Inputs):], s.Outputs)
+	if s.Weights != nil {
+		allVecs = append(allVecs, s.Weights)
+	}
+	return sgd.HashVectors(allVecs...)
+}
+
+// weight returns the weight for the given time step.
+func (s Sample) weight(t int) float64 {
+	if s.Weights == nil {
+		return 1
+	}
+	if len(s.Weights) != len(s.Outputs) {
+		panic("sample weight count does not match output count")
+	}
+	return s.Weights[t]
+}
+
+// EncDecSample is a training sample for an
+// encoder-decoder model.
+// Unlike in a Sample, the input and output sequences
+// may have different lengths.
+type EncDecSample struct {
+	Inputs  []linalg.Vector
+	Outputs []linalg.Vector
+}
+
+// Hash returns a randomly-distributed hash of the sample.
+func (e EncDecSample) Hash() []byte {
+	allVecs := make([]linalg.Vector, len(e.Inputs)+len(e.Outputs)+1)
+	allVecs[0] = linalg.Vector{float64(len(e.Inputs)), float64(len(e.Outputs))}
+	copy(allVecs[1:], e.Inputs)
+	copy(allVecs[1+len(e.Inputs):], e.Outputs)
+	return sgd.HashVectors(allVecs...)
+}
+
+// CTCSample is a training sample for a model trained with
+// Connectionist Temporal Classification.
+// The Label is a sequence of symbol indices which is not
+// aligned with the Input, and is usually shorter.
+type CTCSample struct {
+	Input []linalg.Vector
+	Label []int
+}
+
+// Hash returns a randomly-distributed hash of the sample.
+func (c CTCSample) Hash() []byte {
+	labelVec := make(linalg.Vector, len(c.Label))
+	for i, x := range c.Label {
+		labelVec[i] = float64(x)
+	}
+	allVecs := make([]linalg.Vector, len(c.Input)+1)
+	copy(allVecs, c.Input)
+	allVecs[len(c.Input)] = labelVec
 	return sgd.HashVectors(allVecs...)
 }
@@ -29,6 +29,10 @@ type Gradienter struct {
 	// on Learner at once.
 	MaxGoroutines int
 
+	// Processor is used to clip gradients and add noise
+	// to them.
+	Processor neuralnet.GradProcessor
+
 	helper *neuralnet.GradHelper
 }
 
@@ -45,12 +49,14 @@ func (g *Gradienter) makeHelper() *neuralnet.GradHelper {
 	if g.helper != nil {
 		g.helper.MaxConcurrency = g.MaxGoroutines
 		g.helper.MaxSubBatch = g.MaxLanes
+		g.helper.Processor = g.Processor
 		return g.helper
 	}
 	g.helper = &neuralnet.GradHelper{
 		MaxConcurrency: g.MaxGoroutines,
 		MaxSubBatch:    g.MaxLanes,
 		Learner:        g.Learner,
+		Processor:      g.Processor,
 		CompGrad:       g.runBatch,
 		CompRGrad:      g.runBatchR,
 	}
@@ -71,7 +77,7 @@ func (g *Gradienter) runBatch(grad autofunc.Gradient, set sgd.SampleSet) {
 		expectedSeq := seqs[i].Outputs
 		for j, actual := range outSeq {
 			expected := expectedSeq[j]
-			us[j] = costFuncDeriv(g.CostFunc, expected, actual)
+			us[j] = costFuncDeriv(g.CostFunc, expected, actual, seqs[i].weight(j))
 		}
 		upstream[i] = us
 	}
@@ -82,7 +88,7 @@ func (g *Gradienter) runBatch(grad autofunc.Gradient, set sgd.SampleSet) {
 func (g *Gradienter) runBatchR(rv autofunc.RVector, rg autofunc.RGradient,
 	grad autofunc.Gradient, set sgd.SampleSet) {
 	seqs := sampleSetSlice(set)
-	seqIns := make([][]linalg.Vector, len(seqs))
+	var seqIns [][]linalg.Vector
 	for _, s := range seqs {
 		seqIns = append(seqIns, s.Inputs)
 	}
@@ -97,7 +103,8 @@ func (g *Gradienter) runBatchR(rv autofunc.RVector, rg autofunc.RGradient,
 		expectedSeq := seqs[i].Outputs
 		for j, actual := range outSeq {
 			expected := expectedSeq[j]
-			us[j], usR[j] = costFuncRDeriv(g.CostFunc, expected, actual, rOutSeq[j])
+			us[j], usR[j] = costFuncRDeriv(g.CostFunc, expected, actual, rOutSeq[j],
+				seqs[i].weight(j))
 		}
 		upstream[i] = us
 		upstreamR[i] = usR
@@ -0,0 +1,79 @@
+package seqtoseq
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+const (
+	seqFuncTestDelta = 1e-5
+	seqFuncTestPrec  = 1e-4
+)
+
+func TestGradienterRGradient(t *testing.T) {
+	block := rnn.NewLSTM(3, 2)
+	var samples sgd.SliceSampleSet
+	for i := 0; i < 5; i++ {
+		size := rand.Intn(4) + 1
+		inSeq := make([]linalg.Vector, size)
+		outSeq := make([]linalg.Vector, size)
+		for j := range inSeq {
+			inSeq[j] = linalg.RandVector(3)
+			outSeq[j] = linalg.RandVector(2)
+		}
+		samples = append(samples, Sample{Inputs: inSeq, Outputs: outSeq})
+	}
+	g := &Gradienter{
+		SeqFunc:  &rnn.BlockSeqFunc{B: block},
+		Learner:  block,
+		CostFunc: neuralnet.MeanSquaredCost{},
+		MaxLanes: 2,
+	}
+	rv := autofunc.RVector{}
+	for _, param := range block.Parameters() {
+		rv[param] = linalg.RandVector(len(param.Vector))
+	}
+
+	grad, rgrad := g.RGradient(rv, samples)
+	grad = copyGrad(grad)
+	rgrad = autofunc.RGradient(copyGrad(autofunc.Gradient(rgrad)))
+
+	expected := copyGrad(g.Gradient(samples))
+	for param, vec := range expected {
+		for i, x := range vec {
+			if math.Abs(grad[param][i]-x) > seqFuncTestPrec {
+				t.Errorf("bad gradient entry: expected %f but got %f", x, grad[param][i])
+			}
+		}
+	}
+
+	// The r-gradient is the directional derivative of the
+	// gradient in the direction rv.
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(seqFuncTestDelta))
+	}
+	gradPlus := copyGrad(g.Gradient(samples))
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(-2 * seqFuncTestDelta))
+	}
+	gradMinus := copyGrad(g.Gradient(samples))
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(seqFuncTestDelta))
+	}
+	for param, vec := range gradPlus {
+		for i, x := range vec {
+			approx := (x - gradMinus[param][i]) / (2 * seqFuncTestDelta)
+			if math.Abs(rgrad[param][i]-approx) > seqFuncTestPrec {
+				t.Errorf("bad r-gradient entry: expected %f but got %f", approx,
+					rgrad[param][i])
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package seqtoseq
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+// A TruncatedGradienter is an sgd.RGradienter which uses
+// truncated back-propagation through time to train an
+// rnn.Block on sample sets of Sample objects.
+//
+// Each sequence is split up into windows of WindowSize
+// time steps.
+// The final state from one window is used as the start
+// state for the next window, but gradients are not
+// propagated back through it.
+// Thus, only one window's worth of intermediate results
+// is kept in memory at once.
+//
+// After an instance is used once, it should never be
+// reused with different parameters.
+type TruncatedGradienter struct {
+	Block    rnn.Block
+	Learner  sgd.Learner
+	CostFunc neuralnet.CostFunc
+
+	// WindowSize is the number of time steps to
+	// back-propagate through at once.
+	// If it is 0, entire sequences are used.
+	WindowSize int
+
+	// MaxLanes specifies the maximum number of lanes
+	// any BlockInput or BlockRInput may have at once
+	// while computing gradients.
+	// If this is 0, a reasonable default is used.
+	MaxLanes int
+
+	// MaxGoroutines specifies the maximum number of
+	// Goroutines on which to compute gradients at once.
+	MaxGoroutines int
+
+	// Processor is used to clip gradients and add noise
+	// to them.
+	Processor neuralnet.GradProcessor
+
+	helper *neuralnet.GradHelper
+}
+
+func (t *TruncatedGradienter) Gradient(set sgd.SampleSet) autofunc.Gradient {
+	return t.makeHelper().Gradient(sortSeqs(set))
+}
+
+func (t *TruncatedGradienter) RGradient(v autofunc.RVector,
+	set sgd.SampleSet) (autofunc.Gradient, autofunc.RGradient) {
+	return t.makeHelper().RGradient(v, sortSeqs(set))
+}
+
+func (t *TruncatedGradienter) makeHelper() *neuralnet.GradHelper {
+	if t.helper != nil {
+		t.helper.MaxConcurrency = t.MaxGoroutines
+		t.helper.MaxSubBatch = t.MaxLanes
+		t.helper.Processor = t.Processor
+		return t.helper
+	}
+	t.helper = &neuralnet.GradHelper{
+		MaxConcurrency: t.MaxGoroutines,
+		MaxSubBatch:    t.MaxLanes,
+		Learner:        t.Learner,
+		Processor:      t.Processor,
+		CompGrad:       t.runBatch,
+		CompRGrad:      t.runBatchR,
+	}
+	return t.helper
+}
+
+func (t *TruncatedGradienter) runBatch(grad autofunc.Gradient, set sgd.SampleSet) {
+	samples := sampleSetSlice(set)
+	start := make([]rnn.State, len(samples))
+	for i := range start {
+		start[i] = t.Block.StartState()
+	}
+	states := start
+	for offset := 0; offset < maxSampleLen(samples); offset += t.windowSize(samples) {
+		ins, outs := sampleWindows(samples, offset, t.windowSize(samples))
+		run := runBlock(t.Block, states, ins)
+
+		upstream := make([][]linalg.Vector, len(samples))
+		for i, outSeq := range run.Outputs {
+			upstream[i] = make([]linalg.Vector, len(outSeq))
+			for j, actual := range outSeq {
+				upstream[i][j] = costFuncDeriv(t.CostFunc, outs[i][j], actual,
+					samples[i].weight(offset+j))
+			}
+		}
+
+		startGrad := run.PropagateGradient(upstream, nil, grad)
+		if offset == 0 {
+			propagateStart(t.Block, start, startGrad, grad)
+		}
+		states = run.Final
+	}
+}
+
+func (t *TruncatedGradienter) runBatchR(rv autofunc.RVector, rg autofunc.RGradient,
+	grad autofunc.Gradient, set sgd.SampleSet) {
+	samples := sampleSetSlice(set)
+	start := make([]rnn.RState, len(samples))
+	for i := range start {
+		start[i] = t.Block.StartRState(rv)
+	}
+	states := start
+	for offset := 0; offset < maxSampleLen(samples); offset += t.windowSize(samples) {
+		ins, outs := sampleWindows(samples, offset, t.windowSize(samples))
+		run := runBlockR(rv, t.Block, states, ins)
+
+		upstream := make([][]linalg.Vector, len(samples))
+		upstreamR := make([][]linalg.Vector, len(samples))
+		for i, outSeq := range run.Outputs {
+			upstream[i] = make([]linalg.Vector, len(outSeq))
+			upstreamR[i] = make([]linalg.Vector, len(outSeq))
+			for j, actual := range outSeq {
+				upstream[i][j], upstreamR[i][j] = costFuncRDeriv(t.CostFunc, outs[i][j],
+					actual, run.ROutputs[i][j], samples[i].weight(offset+j))
+			}
+		}
+
+		startGrad := run.PropagateRGradient(upstream, upstreamR, nil, rg, grad)
+		if offset == 0 {
+			propagateStartR(t.Block, start, startGrad, rg, grad)
+		}
+		states = run.Final
+	}
+}
+
+func (t *TruncatedGradienter) windowSize(samples []Sample) int {
+	if t.WindowSize == 0 {
+		return maxSampleLen(samples)
+	}
+	return t.WindowSize
+}
+
+// sampleWindows extracts a window of inputs and outputs
+// from each of the samples.
+func sampleWindows(samples []Sample, offset, size int) (ins, outs [][]linalg.Vector) {
+	ins = make([][]linalg.Vector, len(samples))
+	outs = make([][]linalg.Vector, len(samples))
+	for i, s := range samples {
+		if offset >= len(s.Inputs) {
+			continue
+		}
+		end := offset + size
+		if end > len(s.Inputs) {
+			end = len(s.Inputs)
+		}
+		ins[i] = s.Inputs[offset:end]
+		outs[i] = s.Outputs[offset:end]
+	}
+	return
+}
+
+func maxSampleLen(samples []Sample) int {
+	var max int
+	for _, s := range samples {
+		if len(s.Inputs) > max {
+			max = len(s.Inputs)
+		}
+	}
+	return max
+}
@@ -0,0 +1,207 @@
+package seqtoseq
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+	"github.com/unixpickle/weakai/rnn"
+)
+
+const truncatedTestPrec = 1e-5
+
+func TestTruncatedGradienterFull(t *testing.T) {
+	block, samples := truncatedTestData()
+	truncated := &TruncatedGradienter{
+		Block:    block,
+		Learner:  block,
+		CostFunc: neuralnet.MeanSquaredCost{},
+		MaxLanes: 3,
+	}
+	full := &Gradienter{
+		SeqFunc:  &rnn.BlockSeqFunc{B: block},
+		Learner:  block,
+		CostFunc: neuralnet.MeanSquaredCost{},
+	}
+	rv := truncatedTestRV(block)
+
+	expected := copyGrad(full.Gradient(samples))
+	actual := truncated.Gradient(samples)
+	truncatedTestCompare(t, "gradient", expected, actual)
+
+	expected, expectedR := full.RGradient(rv, samples)
+	expected = copyGrad(expected)
+	expectedR = autofunc.RGradient(copyGrad(autofunc.Gradient(expectedR)))
+	actual, actualR := truncated.RGradient(rv, samples)
+	truncatedTestCompare(t, "gradient", expected, actual)
+	truncatedTestCompare(t, "r-gradient", autofunc.Gradient(expectedR),
+		autofunc.Gradient(actualR))
+}
+
+func TestTruncatedGradienterWindows(t *testing.T) {
+	block, samples := truncatedTestData()
+	truncated := &TruncatedGradienter{
+		Block:      block,
+		Learner:    block,
+		CostFunc:   neuralnet.MeanSquaredCost{},
+		WindowSize: 2,
+		MaxLanes:   3,
+	}
+
+	// Compute the gradient for each window separately,
+	// treating the window's start state as a constant.
+	expected := autofunc.NewGradient(block.Parameters())
+	for i := 0; i < samples.Len(); i++ {
+		sample := samples.GetSample(i).(Sample)
+		runner := &rnn.Runner{Block: block}
+		for offset := 0; offset < len(sample.Inputs); offset += 2 {
+			end := offset + 2
+			if end > len(sample.Inputs) {
+				end = len(sample.Inputs)
+			}
+			var windowBlock rnn.Block = block
+			if offset > 0 {
+				windowBlock = &fixedStartBlock{Block: block, Start: runner.State()}
+			}
+			g := &Gradienter{
+				SeqFunc:  &rnn.BlockSeqFunc{B: windowBlock},
+				Learner:  block,
+				CostFunc: neuralnet.MeanSquaredCost{},
+			}
+			expected.Add(g.Gradient(sgd.SliceSampleSet{Sample{
+				Inputs:  sample.Inputs[offset:end],
+				Outputs: sample.Outputs[offset:end],
+			}}))
+			for _, in := range sample.Inputs[offset:end] {
+				runner.StepTime(in)
+			}
+		}
+	}
+	truncatedTestCompare(t, "gradient", expected, truncated.Gradient(samples))
+
+	// The r-gradient should be the directional derivative
+	// of the truncated gradient.
+	rv := truncatedTestRV(block)
+	_, actualR := truncated.RGradient(rv, samples)
+	actualR = autofunc.RGradient(copyGrad(autofunc.Gradient(actualR)))
+	const delta = 1e-5
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(delta))
+	}
+	grad1 := copyGrad(truncated.Gradient(samples))
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(-2 * delta))
+	}
+	grad2 := truncated.Gradient(samples)
+	for _, param := range block.Parameters() {
+		param.Vector.Add(rv[param].Copy().Scale(delta))
+	}
+	expectedR := autofunc.Gradient{}
+	for param, vec := range grad1 {
+		expectedR[param] = vec.Copy().Add(grad2[param].Copy().Scale(-1)).Scale(1 / (2 * delta))
+	}
+	truncatedTestCompare(t, "r-gradient", expectedR, autofunc.Gradient(actualR))
+}
+
+func truncatedTestData() (*rnn.LSTM, sgd.SampleSet) {
+	block := rnn.NewLSTM(3, 2)
+	var samples sgd.SliceSampleSet
+	for i := 0; i < 8; i++ {
+		size := rand.Intn(7)
+		inSeq := make([]linalg.Vector, size)
+		outSeq := make([]linalg.Vector, size)
+		for j := range inSeq {
+			inSeq[j] = linalg.RandVector(3)
+			outSeq[j] = linalg.RandVector(2)
+		}
+		samples = append(samples, Sample{Inputs: inSeq, Outputs: outSeq})
+	}
+	return block, samples
+}
+
+func truncatedTestRV(l sgd.Learner) autofunc.RVector {
+	rv := autofunc.RVector{}
+	for _, param := range l.Parameters() {
+		rv[param] = make(linalg.Vector, len(param.Vector))
+		for i := range rv[param] {
+			rv[param][i] = rand.NormFloat64()
+		}
+	}
+	return rv
+}
+
+func truncatedTestCompare(t *testing.T, name string, expected, actual autofunc.Gradient) {
+	for param, vec := range expected {
+		for i, x := range vec {
+			if math.Abs(actual[param][i]-x) > truncatedTestPrec {
+				t.Errorf("bad %s entry: expected %f but got %f", name, x, actual[param][i])
+			}
+		}
+	}
+}
+
+// fixedStartBlock is an rnn.Block with a constant start
+// state.
+type fixedStartBlock struct {
+	rnn.Block
+	Start rnn.State
+}
+
+func (f *fixedStartBlock) StartState() rnn.State {
+	return f.Start
+}
+
+func (f *fixedStartBlock) PropagateStart(s []rnn.State, u []rnn.StateGrad,
+	g autofunc.Gradient) {
+}
+
+func TestTruncatedGradienterWeights(t *testing.T) {
+	block, samples := weightsTestData(3, 2)
+	truncated := &TruncatedGradienter{
+		Block:      block,
+		Learner:    block,
+		CostFunc:   neuralnet.MeanSquaredCost{},
+		WindowSize: 2,
+		MaxLanes:   3,
+	}
+	seqFunc := &rnn.BlockSeqFunc{B: block}
+	full := &Gradienter{
+		SeqFunc:  seqFunc,
+		Learner:  block,
+		CostFunc: neuralnet.MeanSquaredCost{},
+	}
+
+	const delta = 1e-5
+	actual := copyGrad(full.Gradient(samples))
+	for _, param := range block.Parameters() {
+		for i := range param.Vector {
+			old := param.Vector[i]
+			param.Vector[i] = old + delta
+			cost1 := TotalCostSeqFunc(seqFunc, 4, samples, neuralnet.MeanSquaredCost{})
+			param.Vector[i] = old - delta
+			cost2 := TotalCostSeqFunc(seqFunc, 4, samples, neuralnet.MeanSquaredCost{})
+			param.Vector[i] = old
+			expected := (cost1 - cost2) / (2 * delta)
+			if math.Abs(actual[param][i]-expected) > 1e-4 {
+				t.Errorf("bad gradient entry: expected %f but got %f", expected,
+					actual[param][i])
+			}
+		}
+	}
+
+	// With a full window, truncation should have no effect.
+	truncated.WindowSize = 0
+	rv := truncatedTestRV(block)
+	truncatedTestCompare(t, "gradient", actual, truncated.Gradient(samples))
+	expected, expectedR := full.RGradient(rv, samples)
+	expected = copyGrad(expected)
+	expectedR = autofunc.RGradient(copyGrad(autofunc.Gradient(expectedR)))
+	actualGrad, actualR := truncated.RGradient(rv, samples)
+	truncatedTestCompare(t, "gradient", expected, actualGrad)
+	truncatedTestCompare(t, "r-gradient", autofunc.Gradient(expectedR),
+		autofunc.Gradient(actualR))
+}
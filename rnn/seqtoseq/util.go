@@ -9,24 +9,35 @@ import (
 	"github.com/unixpickle/weakai/neuralnet"
 )
 
-func costFuncDeriv(c neuralnet.CostFunc, expected, actual linalg.Vector) linalg.Vector {
-	variable := &autofunc.Variable{Vector: actual}
+// costFuncDeriv computes the derivative of the cost
+// function, scaled by a weight.
+// If the weight is 0, the cost function is not evaluated
+// at all, so expected may be invalid.
+func costFuncDeriv(c neuralnet.CostFunc, expected, actual linalg.Vector,
+	weight float64) linalg.Vector {
 	result := make(linalg.Vector, len(actual))
+	if weight == 0 {
+		return result
+	}
+	variable := &autofunc.Variable{Vector: actual}
 	res := c.Cost(expected, variable)
-	res.PropagateGradient([]float64{1}, autofunc.Gradient{variable: result})
+	res.PropagateGradient([]float64{weight}, autofunc.Gradient{variable: result})
 	return result
 }
 
-func costFuncRDeriv(c neuralnet.CostFunc, expected, actual,
-	actualR linalg.Vector) (deriv, rDeriv linalg.Vector) {
+func costFuncRDeriv(c neuralnet.CostFunc, expected, actual, actualR linalg.Vector,
+	weight float64) (deriv, rDeriv linalg.Vector) {
+	deriv = make(linalg.Vector, len(actual))
+	rDeriv = make(linalg.Vector, len(actual))
+	if weight == 0 {
+		return
+	}
 	variable := &autofunc.RVariable{
 		Variable:   &autofunc.Variable{Vector: actual},
 		ROutputVec: actualR,
 	}
-	deriv = make(linalg.Vector, len(actual))
-	rDeriv = make(linalg.Vector, len(actual))
 	res := c.CostR(autofunc.RVector{}, expected, variable)
-	res.PropagateRGradient([]float64{1}, []float64{0},
+	res.PropagateRGradient([]float64{weight}, []float64{0},
 		autofunc.RGradient{variable.Variable: rDeriv},
 		autofunc.Gradient{variable.Variable: deriv})
 	return
@@ -70,3 +81,23 @@ func (s seqSorter) Less(i, j int) bool {
 func (s seqSorter) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
+
+// encDecSampleSlice converts a sample set into a slice
+// of EncDecSamples.
+func encDecSampleSlice(s sgd.SampleSet) []EncDecSample {
+	res := make([]EncDecSample, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		res[i] = s.GetSample(i).(EncDecSample)
+	}
+	return res
+}
+
+// ctcSampleSlice converts a sample set into a slice of
+// CTCSamples.
+func ctcSampleSlice(s sgd.SampleSet) []CTCSample {
+	res := make([]CTCSample, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		res[i] = s.GetSample(i).(CTCSample)
+	}
+	return res
+}
@@ -0,0 +1,396 @@
+package rnn
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+const initialHighwayBias = -1
+
+func init() {
+	var r ResidualBlock
+	serializer.RegisterTypedDeserializer(r.SerializerType(), DeserializeResidualBlock)
+
+	var h HighwayBlock
+	serializer.RegisterTypedDeserializer(h.SerializerType(), DeserializeHighwayBlock)
+}
+
+// A ResidualBlock wraps a Block and adds the input at
+// each time step to the wrapped Block's output.
+// It is the recurrent analog of neuralnet.ResidualLayer,
+// and it is meant to be used for the layers of a deep
+// StackedBlock.
+//
+// The wrapped Block's outputs must be the same size as
+// its inputs.
+type ResidualBlock struct {
+	Block Block
+}
+
+// DeserializeResidualBlock deserializes a ResidualBlock.
+func DeserializeResidualBlock(d []byte) (*ResidualBlock, error) {
+	b, err := serializer.DeserializeWithType(d)
+	if err != nil {
+		return nil, err
+	}
+	block, ok := b.(Block)
+	if !ok {
+		return nil, fmt.Errorf("wrapped object is not a Block: %T", b)
+	}
+	return &ResidualBlock{Block: block}, nil
+}
+
+// StartState returns the wrapped Block's start state.
+func (r *ResidualBlock) StartState() State {
+	return r.Block.StartState()
+}
+
+// StartRState returns the wrapped Block's start state.
+func (r *ResidualBlock) StartRState(rv autofunc.RVector) RState {
+	return r.Block.StartRState(rv)
+}
+
+// PropagateStart propagates through the start state.
+func (r *ResidualBlock) PropagateStart(s []State, u []StateGrad, g autofunc.Gradient) {
+	r.Block.PropagateStart(s, u, g)
+}
+
+// PropagateStartR propagates through the start state.
+func (r *ResidualBlock) PropagateStartR(s []RState, u []RStateGrad, rg autofunc.RGradient,
+	g autofunc.Gradient) {
+	r.Block.PropagateStartR(s, u, rg, g)
+}
+
+// ApplyBlock applies the block to an input.
+func (r *ResidualBlock) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
+	return applySkipBlock(r.Block, s, in, func(in, out autofunc.Result) autofunc.Result {
+		return autofunc.Add(in, out)
+	})
+}
+
+// ApplyBlockR applies the block to an input.
+func (r *ResidualBlock) ApplyBlockR(rv autofunc.RVector, s []RState,
+	in []autofunc.RResult) BlockRResult {
+	return applySkipBlockR(rv, r.Block, s, in,
+		func(in, out autofunc.RResult) autofunc.RResult {
+			return autofunc.AddR(in, out)
+		})
+}
+
+// Parameters returns the parameters of the wrapped Block,
+// or nil if the Block is not an sgd.Learner.
+func (r *ResidualBlock) Parameters() []*autofunc.Variable {
+	ler, ok := r.Block.(sgd.Learner)
+	if !ok {
+		return nil
+	}
+	return ler.Parameters()
+}
+
+// SerializerType returns the unique ID used to serialize
+// ResidualBlocks with the serializer package.
+func (r *ResidualBlock) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.ResidualBlock"
+}
+
+// Serialize attempts to serialize this block by
+// serializing the wrapped block.
+// If the wrapped block is not a serializer.Serializer,
+// this will fail.
+func (r *ResidualBlock) Serialize() ([]byte, error) {
+	ser, ok := r.Block.(serializer.Serializer)
+	if !ok {
+		return nil, fmt.Errorf("type is not a Serializer: %T", r.Block)
+	}
+	return serializer.SerializeWithType(ser)
+}
+
+// A HighwayBlock wraps a Block and uses a learned gate
+// to mix the input at each time step with the wrapped
+// Block's output, as in highway networks
+// (https://arxiv.org/abs/1505.00387).
+//
+// For an input x and wrapped output y, the output of a
+// HighwayBlock is t*y + (1-t)*x, where t is computed by
+// applying a sigmoid to Gate's output for x.
+//
+// The wrapped Block's outputs must be the same size as
+// its inputs.
+type HighwayBlock struct {
+	Block Block
+	Gate  *neuralnet.DenseLayer
+}
+
+// NewHighwayBlock creates a HighwayBlock with a randomly
+// initialized gate for inputs of the given size.
+// The gate is biased so that inputs are initially
+// carried through more than they are transformed.
+func NewHighwayBlock(b Block, size int) *HighwayBlock {
+	gate := &neuralnet.DenseLayer{InputCount: size, OutputCount: size}
+	gate.Randomize()
+	for i := range gate.Biases.Var.Vector {
+		gate.Biases.Var.Vector[i] = initialHighwayBias
+	}
+	return &HighwayBlock{Block: b, Gate: gate}
+}
+
+// DeserializeHighwayBlock deserializes a HighwayBlock.
+func DeserializeHighwayBlock(d []byte) (*HighwayBlock, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 2 {
+		return nil, errors.New("invalid HighwayBlock slice length")
+	}
+	block, ok1 := slice[0].(Block)
+	gate, ok2 := slice[1].(*neuralnet.DenseLayer)
+	if !ok1 || !ok2 {
+		return nil, errors.New("invalid HighwayBlock slice types")
+	}
+	return &HighwayBlock{Block: block, Gate: gate}, nil
+}
+
+// StartState returns the wrapped Block's start state.
+func (h *HighwayBlock) StartState() State {
+	return h.Block.StartState()
+}
+
+// StartRState returns the wrapped Block's start state.
+func (h *HighwayBlock) StartRState(rv autofunc.RVector) RState {
+	return h.Block.StartRState(rv)
+}
+
+// PropagateStart propagates through the start state.
+func (h *HighwayBlock) PropagateStart(s []State, u []StateGrad, g autofunc.Gradient) {
+	h.Block.PropagateStart(s, u, g)
+}
+
+// PropagateStartR propagates through the start state.
+func (h *HighwayBlock) PropagateStartR(s []RState, u []RStateGrad, rg autofunc.RGradient,
+	g autofunc.Gradient) {
+	h.Block.PropagateStartR(s, u, rg, g)
+}
+
+// ApplyBlock applies the block to an input.
+func (h *HighwayBlock) ApplyBlock(s []State, in []autofunc.Result) BlockResult {
+	n := len(in)
+	return applySkipBlock(h.Block, s, in, func(in, out autofunc.Result) autofunc.Result {
+		return autofunc.Pool(in, func(in autofunc.Result) autofunc.Result {
+			gate := neuralnet.Sigmoid{}.Apply(h.Gate.Batch(in, n))
+			return autofunc.Pool(gate, func(gate autofunc.Result) autofunc.Result {
+				carry := autofunc.AddScaler(autofunc.Scale(gate, -1), 1)
+				return autofunc.Add(autofunc.Mul(gate, out), autofunc.Mul(carry, in))
+			})
+		})
+	})
+}
+
+// ApplyBlockR applies the block to an input.
+func (h *HighwayBlock) ApplyBlockR(rv autofunc.RVector, s []RState,
+	in []autofunc.RResult) BlockRResult {
+	n := len(in)
+	return applySkipBlockR(rv, h.Block, s, in,
+		func(in, out autofunc.RResult) autofunc.RResult {
+			return autofunc.PoolR(in, func(in autofunc.RResult) autofunc.RResult {
+				gate := neuralnet.Sigmoid{}.ApplyR(rv, h.Gate.BatchR(rv, in, n))
+				return autofunc.PoolR(gate, func(gate autofunc.RResult) autofunc.RResult {
+					carry := autofunc.AddScalerR(autofunc.ScaleR(gate, -1), 1)
+					return autofunc.AddR(autofunc.MulR(gate, out),
+						autofunc.MulR(carry, in))
+				})
+			})
+		})
+}
+
+// Parameters returns the parameters of the wrapped Block
+// (if it is an sgd.Learner), followed by the parameters
+// of the gate.
+func (h *HighwayBlock) Parameters() []*autofunc.Variable {
+	var res []*autofunc.Variable
+	if ler, ok := h.Block.(sgd.Learner); ok {
+		res = append(res, ler.Parameters()...)
+	}
+	return append(res, h.Gate.Parameters()...)
+}
+
+// SerializerType returns the unique ID used to serialize
+// HighwayBlocks with the serializer package.
+func (h *HighwayBlock) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.HighwayBlock"
+}
+
+// Serialize attempts to serialize this block.
+// If the wrapped block is not a serializer.Serializer,
+// this will fail.
+func (h *HighwayBlock) Serialize() ([]byte, error) {
+	ser, ok := h.Block.(serializer.Serializer)
+	if !ok {
+		return nil, fmt.Errorf("type is not a Serializer: %T", h.Block)
+	}
+	return serializer.SerializeSlice([]serializer.Serializer{ser, h.Gate})
+}
+
+// applySkipBlock applies a Block and then combines its
+// joined inputs and outputs with a function.
+func applySkipBlock(b Block, s []State, in []autofunc.Result,
+	combine func(in, out autofunc.Result) autofunc.Result) *skipBlockResult {
+	res := &skipBlockResult{Input: in}
+	var inResults, outResults []autofunc.Result
+	for _, x := range in {
+		v := &autofunc.Variable{Vector: x.Output()}
+		res.InPool = append(res.InPool, v)
+		inResults = append(inResults, v)
+	}
+	res.Inner = b.ApplyBlock(s, inResults)
+	for _, x := range res.Inner.Outputs() {
+		v := &autofunc.Variable{Vector: x}
+		res.OutPool = append(res.OutPool, v)
+		outResults = append(outResults, v)
+	}
+	res.Joined = combine(autofunc.Concat(inResults...), autofunc.Concat(outResults...))
+	return res
+}
+
+func applySkipBlockR(rv autofunc.RVector, b Block, s []RState, in []autofunc.RResult,
+	combine func(in, out autofunc.RResult) autofunc.RResult) *skipBlockRResult {
+	res := &skipBlockRResult{Input: in}
+	var inResults, outResults []autofunc.RResult
+	for _, x := range in {
+		v := &autofunc.Variable{Vector: x.Output()}
+		res.InPool = append(res.InPool, v)
+		inResults = append(inResults, &autofunc.RVariable{
+			Variable:   v,
+			ROutputVec: x.ROutput(),
+		})
+	}
+	res.Inner = b.ApplyBlockR(rv, s, inResults)
+	rOuts := res.Inner.ROutputs()
+	for i, x := range res.Inner.Outputs() {
+		v := &autofunc.Variable{Vector: x}
+		res.OutPool = append(res.OutPool, v)
+		outResults = append(outResults, &autofunc.RVariable{
+			Variable:   v,
+			ROutputVec: rOuts[i],
+		})
+	}
+	res.Joined = combine(autofunc.ConcatR(inResults...), autofunc.ConcatR(outResults...))
+	return res
+}
+
+type skipBlockResult struct {
+	Input   []autofunc.Result
+	InPool  []*autofunc.Variable
+	OutPool []*autofunc.Variable
+	Inner   BlockResult
+	Joined  autofunc.Result
+}
+
+func (s *skipBlockResult) Outputs() []linalg.Vector {
+	return splitVectors(s.Joined.Output(), len(s.InPool))
+}
+
+func (s *skipBlockResult) States() []State {
+	return s.Inner.States()
+}
+
+func (s *skipBlockResult) PropagateGradient(u []linalg.Vector, su []StateGrad,
+	g autofunc.Gradient) []StateGrad {
+	for _, vars := range [][]*autofunc.Variable{s.InPool, s.OutPool} {
+		for _, v := range vars {
+			g[v] = make(linalg.Vector, len(v.Vector))
+		}
+	}
+
+	var innerUpstream []linalg.Vector
+	if u != nil {
+		s.Joined.PropagateGradient(joinVecs(u), g)
+		for _, v := range s.OutPool {
+			innerUpstream = append(innerUpstream, g[v])
+		}
+	}
+	downstream := s.Inner.PropagateGradient(innerUpstream, su, g)
+
+	inGrads := make([]linalg.Vector, len(s.InPool))
+	for i, v := range s.InPool {
+		inGrads[i] = g[v]
+		delete(g, v)
+	}
+	for _, v := range s.OutPool {
+		delete(g, v)
+	}
+	for i, x := range s.Input {
+		if !x.Constant(g) {
+			x.PropagateGradient(inGrads[i], g)
+		}
+	}
+	return downstream
+}
+
+type skipBlockRResult struct {
+	Input   []autofunc.RResult
+	InPool  []*autofunc.Variable
+	OutPool []*autofunc.Variable
+	Inner   BlockRResult
+	Joined  autofunc.RResult
+}
+
+func (s *skipBlockRResult) Outputs() []linalg.Vector {
+	return splitVectors(s.Joined.Output(), len(s.InPool))
+}
+
+func (s *skipBlockRResult) ROutputs() []linalg.Vector {
+	return splitVectors(s.Joined.ROutput(), len(s.InPool))
+}
+
+func (s *skipBlockRResult) RStates() []RState {
+	return s.Inner.RStates()
+}
+
+func (s *skipBlockRResult) PropagateRGradient(u, uR []linalg.Vector, su []RStateGrad,
+	rg autofunc.RGradient, g autofunc.Gradient) []RStateGrad {
+	if g == nil {
+		g = autofunc.Gradient{}
+	}
+	for _, vars := range [][]*autofunc.Variable{s.InPool, s.OutPool} {
+		for _, v := range vars {
+			g[v] = make(linalg.Vector, len(v.Vector))
+			rg[v] = make(linalg.Vector, len(v.Vector))
+		}
+	}
+
+	var innerUpstream, innerUpstreamR []linalg.Vector
+	if u != nil {
+		s.Joined.PropagateRGradient(joinVecs(u), joinVecs(uR), rg, g)
+		for _, v := range s.OutPool {
+			innerUpstream = append(innerUpstream, g[v])
+			innerUpstreamR = append(innerUpstreamR, rg[v])
+		}
+	}
+	downstream := s.Inner.PropagateRGradient(innerUpstream, innerUpstreamR, su, rg, g)
+
+	inGrads := make([]linalg.Vector, len(s.InPool))
+	inGradsR := make([]linalg.Vector, len(s.InPool))
+	for i, v := range s.InPool {
+		inGrads[i] = g[v]
+		inGradsR[i] = rg[v]
+		delete(g, v)
+		delete(rg, v)
+	}
+	for _, v := range s.OutPool {
+		delete(g, v)
+		delete(rg, v)
+	}
+	for i, x := range s.Input {
+		if !x.Constant(rg, g) {
+			x.PropagateRGradient(inGrads[i], inGradsR[i], rg, g)
+		}
+	}
+	return downstream
+}
@@ -0,0 +1,320 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func init() {
+	var s SRU
+	serializer.RegisterTypedDeserializer(s.SerializerType(), DeserializeSRU)
+}
+
+// SRU is a Block that implements a simple recurrent unit,
+// as defined in https://arxiv.org/abs/1709.02755.
+//
+// In an SRU, the gates only depend on the current input,
+// and the state is only used element-wise.
+// The output is a highway-style mix of the (activated)
+// state and the input.
+// If the input size differs from the hidden size, the
+// input is linearly projected before being mixed in.
+type SRU struct {
+	hiddenSize int
+	transform  *neuralnet.DenseLayer
+	forgetGate *neuralnet.DenseLayer
+	resetGate  *neuralnet.DenseLayer
+	initState  *autofunc.Variable
+
+	// skip projects the input for the highway connection.
+	// It is nil when the input size is the hidden size.
+	skip *neuralnet.DenseLayer
+}
+
+// NewSRU creates an SRU with randomly initialized
+// weights and biases.
+func NewSRU(inputSize, hiddenSize int) *SRU {
+	newDense := func() *neuralnet.DenseLayer {
+		res := &neuralnet.DenseLayer{InputCount: inputSize, OutputCount: hiddenSize}
+		res.Randomize()
+		res.Biases.Var.Vector.Scale(0)
+		return res
+	}
+	res := &SRU{
+		hiddenSize: hiddenSize,
+		transform:  newDense(),
+		forgetGate: newDense(),
+		resetGate:  newDense(),
+		initState:  &autofunc.Variable{Vector: make(linalg.Vector, hiddenSize)},
+	}
+	if inputSize != hiddenSize {
+		res.skip = newDense()
+	}
+	return res
+}
+
+// DeserializeSRU deserializes an SRU.
+func DeserializeSRU(d []byte) (*SRU, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(slice) != 5 && len(slice) != 6 {
+		return nil, errors.New("invalid slice length in SRU")
+	}
+	hiddenSize, ok := slice[0].(serializer.Int)
+	transform, ok1 := slice[1].(*neuralnet.DenseLayer)
+	forgetGate, ok2 := slice[2].(*neuralnet.DenseLayer)
+	resetGate, ok3 := slice[3].(*neuralnet.DenseLayer)
+	initStateData, ok4 := slice[4].(serializer.Bytes)
+	if !ok || !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("invalid types in SRU slice")
+	}
+	var initState autofunc.Variable
+	if err := json.Unmarshal(initStateData, &initState); err != nil {
+		return nil, errors.New("invalid init state in SRU slice")
+	}
+	res := &SRU{
+		hiddenSize: int(hiddenSize),
+		transform:  transform,
+		forgetGate: forgetGate,
+		resetGate:  resetGate,
+		initState:  &initState,
+	}
+	if len(slice) == 6 {
+		res.skip, ok = slice[5].(*neuralnet.DenseLayer)
+		if !ok {
+			return nil, errors.New("invalid types in SRU slice")
+		}
+	}
+	return res, nil
+}
+
+// StartState returns the trainable start state.
+func (s *SRU) StartState() State {
+	return VecState(s.initState.Vector)
+}
+
+// StartRState is like StartState but with r-operators.
+func (s *SRU) StartRState(rv autofunc.RVector) RState {
+	resVar := autofunc.NewRVariable(s.initState, rv)
+	return VecRState{State: resVar.Output(), RState: resVar.ROutput()}
+}
+
+// PropagateStart propagates through the start state.
+func (s *SRU) PropagateStart(_ []State, u []StateGrad, g autofunc.Gradient) {
+	PropagateVarState(s.initState, u, g)
+}
+
+// PropagateStartR propagates through the start state.
+func (s *SRU) PropagateStartR(_ []RState, u []RStateGrad, rg autofunc.RGradient,
+	g autofunc.Gradient) {
+	PropagateVarStateR(s.initState, u, rg, g)
+}
+
+// ApplyBlock applies the block to an input.
+func (s *SRU) ApplyBlock(states []State, in []autofunc.Result) BlockResult {
+	stateVars, stateRes := PoolVecStates(states)
+	n := len(in)
+	res := autofunc.PoolAll(in, func(in []autofunc.Result) autofunc.Result {
+		joinedIn := autofunc.Concat(in...)
+		transformed := s.transform.Batch(joinedIn, n)
+		forget := neuralnet.Sigmoid{}.Apply(s.forgetGate.Batch(joinedIn, n))
+		reset := neuralnet.Sigmoid{}.Apply(s.resetGate.Batch(joinedIn, n))
+		skipIn := joinedIn
+		if s.skip != nil {
+			skipIn = s.skip.Batch(joinedIn, n)
+		}
+		lastState := autofunc.Concat(stateRes...)
+		newState := autofunc.Pool(forget, func(f autofunc.Result) autofunc.Result {
+			keep := autofunc.AddScaler(autofunc.Scale(f, -1), 1)
+			return autofunc.Add(autofunc.Mul(f, lastState), autofunc.Mul(keep, transformed))
+		})
+		return autofunc.Pool(newState, func(newState autofunc.Result) autofunc.Result {
+			out := autofunc.Pool(reset, func(r autofunc.Result) autofunc.Result {
+				activated := neuralnet.HyperbolicTangent{}.Apply(newState)
+				keep := autofunc.AddScaler(autofunc.Scale(r, -1), 1)
+				return autofunc.Add(autofunc.Mul(r, activated), autofunc.Mul(keep, skipIn))
+			})
+			return autofunc.Concat(newState, out)
+		})
+	})
+	return &sruResult{InStates: stateVars, Joined: res}
+}
+
+// ApplyBlockR applies the block to an input.
+func (s *SRU) ApplyBlockR(rv autofunc.RVector, states []RState,
+	in []autofunc.RResult) BlockRResult {
+	stateVars, stateRes := PoolVecRStates(states)
+	n := len(in)
+	res := autofunc.PoolAllR(in, func(in []autofunc.RResult) autofunc.RResult {
+		joinedIn := autofunc.ConcatR(in...)
+		transformed := s.transform.BatchR(rv, joinedIn, n)
+		forget := neuralnet.Sigmoid{}.ApplyR(rv, s.forgetGate.BatchR(rv, joinedIn, n))
+		reset := neuralnet.Sigmoid{}.ApplyR(rv, s.resetGate.BatchR(rv, joinedIn, n))
+		skipIn := joinedIn
+		if s.skip != nil {
+			skipIn = s.skip.BatchR(rv, joinedIn, n)
+		}
+		lastState := autofunc.ConcatR(stateRes...)
+		newState := autofunc.PoolR(forget, func(f autofunc.RResult) autofunc.RResult {
+			keep := autofunc.AddScalerR(autofunc.ScaleR(f, -1), 1)
+			return autofunc.AddR(autofunc.MulR(f, lastState),
+				autofunc.MulR(keep, transformed))
+		})
+		return autofunc.PoolR(newState, func(newState autofunc.RResult) autofunc.RResult {
+			out := autofunc.PoolR(reset, func(r autofunc.RResult) autofunc.RResult {
+				activated := neuralnet.HyperbolicTangent{}.ApplyR(rv, newState)
+				keep := autofunc.AddScalerR(autofunc.ScaleR(r, -1), 1)
+				return autofunc.AddR(autofunc.MulR(r, activated), autofunc.MulR(keep, skipIn))
+			})
+			return autofunc.ConcatR(newState, out)
+		})
+	})
+	return &sruRResult{InStates: stateVars, Joined: res}
+}
+
+// Parameters returns the SRU's parameters in the
+// following order: transform weights, transform biases,
+// forget gate weights, forget gate biases, reset gate
+// weights, reset gate biases, initial state biases.
+// If the input size differs from the hidden size, these
+// are followed by the weights and biases of the input
+// projection.
+func (s *SRU) Parameters() []*autofunc.Variable {
+	res := []*autofunc.Variable{
+		s.transform.Weights.Data,
+		s.transform.Biases.Var,
+		s.forgetGate.Weights.Data,
+		s.forgetGate.Biases.Var,
+		s.resetGate.Weights.Data,
+		s.resetGate.Biases.Var,
+		s.initState,
+	}
+	if s.skip != nil {
+		res = append(res, s.skip.Weights.Data, s.skip.Biases.Var)
+	}
+	return res
+}
+
+// Serialize serializes the block.
+func (s *SRU) Serialize() ([]byte, error) {
+	initData, err := json.Marshal(s.initState)
+	if err != nil {
+		return nil, err
+	}
+	slist := []serializer.Serializer{
+		serializer.Int(s.hiddenSize),
+		s.transform,
+		s.forgetGate,
+		s.resetGate,
+		serializer.Bytes(initData),
+	}
+	if s.skip != nil {
+		slist = append(slist, s.skip)
+	}
+	return serializer.SerializeSlice(slist)
+}
+
+// SerializerType returns the unique ID used to serialize
+// an SRU with the serializer package.
+func (s *SRU) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.SRU"
+}
+
+// sruResult stores the new states of every lane followed
+// by the outputs of every lane in Joined.
+type sruResult struct {
+	InStates []*autofunc.Variable
+	Joined   autofunc.Result
+}
+
+func (s *sruResult) Outputs() []linalg.Vector {
+	n := len(s.InStates)
+	return splitVectors(s.Joined.Output(), 2*n)[n:]
+}
+
+func (s *sruResult) States() []State {
+	n := len(s.InStates)
+	var res []State
+	for _, x := range splitVectors(s.Joined.Output(), 2*n)[:n] {
+		res = append(res, VecState(x))
+	}
+	return res
+}
+
+func (s *sruResult) PropagateGradient(u []linalg.Vector, su []StateGrad,
+	g autofunc.Gradient) []StateGrad {
+	n := len(s.InStates)
+	if n == 0 {
+		return nil
+	}
+	downstream := make(linalg.Vector, len(s.Joined.Output()))
+	cells := len(downstream) / (2 * n)
+	for i, stateObj := range su {
+		if stateObj != nil {
+			downstream[i*cells : (i+1)*cells].Add(linalg.Vector(stateObj.(VecStateGrad)))
+		}
+	}
+	for i, uVec := range u {
+		downstream[(i+n)*cells : (i+n+1)*cells].Add(uVec)
+	}
+	return PropagateVecStatePool(g, s.InStates, func() {
+		s.Joined.PropagateGradient(downstream, g)
+	})
+}
+
+type sruRResult struct {
+	InStates []*autofunc.Variable
+	Joined   autofunc.RResult
+}
+
+func (s *sruRResult) Outputs() []linalg.Vector {
+	n := len(s.InStates)
+	return splitVectors(s.Joined.Output(), 2*n)[n:]
+}
+
+func (s *sruRResult) ROutputs() []linalg.Vector {
+	n := len(s.InStates)
+	return splitVectors(s.Joined.ROutput(), 2*n)[n:]
+}
+
+func (s *sruRResult) RStates() []RState {
+	n := len(s.InStates)
+	var res []RState
+	statesR := splitVectors(s.Joined.ROutput(), 2*n)
+	for i, x := range splitVectors(s.Joined.Output(), 2*n)[:n] {
+		res = append(res, VecRState{State: x, RState: statesR[i]})
+	}
+	return res
+}
+
+func (s *sruRResult) PropagateRGradient(u, uR []linalg.Vector, su []RStateGrad,
+	rg autofunc.RGradient, g autofunc.Gradient) []RStateGrad {
+	n := len(s.InStates)
+	if n == 0 {
+		return nil
+	}
+	downstream := make(linalg.Vector, len(s.Joined.Output()))
+	downstreamR := make(linalg.Vector, len(s.Joined.Output()))
+	cells := len(downstream) / (2 * n)
+	for i, stateObj := range su {
+		if stateObj != nil {
+			state := stateObj.(VecRStateGrad)
+			downstream[i*cells : (i+1)*cells].Add(state.State)
+			downstreamR[i*cells : (i+1)*cells].Add(state.RState)
+		}
+	}
+	for i, uVec := range u {
+		downstream[(i+n)*cells : (i+n+1)*cells].Add(uVec)
+		downstreamR[(i+n)*cells : (i+n+1)*cells].Add(uR[i])
+	}
+	return PropagateVecRStatePool(rg, g, s.InStates, func() {
+		s.Joined.PropagateRGradient(downstream, downstreamR, rg, g)
+	})
+}
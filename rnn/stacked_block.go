@@ -18,6 +18,10 @@ func init() {
 // feeding the output of each block into the input of the
 // next block in the stack.
 // It is essential for building deep RNNs.
+//
+// To add skip connections between the layers of a deep
+// StackedBlock, wrap its blocks in ResidualBlocks or
+// HighwayBlocks.
 type StackedBlock []Block
 
 // DeserializeStackedBlock deserializes a StackedBlock.
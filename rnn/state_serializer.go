@@ -0,0 +1,177 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var v VecState
+	serializer.RegisterTypedDeserializer(v.SerializerType(), DeserializeVecState)
+
+	var l lstmState
+	serializer.RegisterTypedDeserializer(l.SerializerType(), deserializeLSTMState)
+
+	var g gruState
+	serializer.RegisterTypedDeserializer(g.SerializerType(), deserializeGRUState)
+
+	var c clockworkState
+	serializer.RegisterTypedDeserializer(c.SerializerType(), deserializeClockworkState)
+
+	var s stackedState
+	serializer.RegisterTypedDeserializer(s.SerializerType(), deserializeStackedState)
+}
+
+// SerializeState serializes a State which was produced
+// by one of the built-in blocks, such as an LSTM, GRU,
+// ClockworkRNN, NetworkBlock, StackedBlock, ParallelBlock,
+// or StateOutBlock.
+//
+// A State may be serialized at any time step and later
+// restored with DeserializeState, making it possible to
+// resume a sequence where it left off.
+func SerializeState(s State) ([]byte, error) {
+	ser, err := stateSerializer(s)
+	if err != nil {
+		return nil, err
+	}
+	return serializer.SerializeWithType(ser)
+}
+
+// DeserializeState deserializes a State which was
+// serialized with SerializeState.
+func DeserializeState(d []byte) (State, error) {
+	obj, err := serializer.DeserializeWithType(d)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapState(obj)
+}
+
+// DeserializeVecState deserializes a VecState.
+func DeserializeVecState(d []byte) (VecState, error) {
+	var res linalg.Vector
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, err
+	}
+	return VecState(res), nil
+}
+
+// Serialize serializes the VecState.
+func (v VecState) Serialize() ([]byte, error) {
+	return json.Marshal(linalg.Vector(v))
+}
+
+// SerializerType returns the unique ID used to serialize
+// a VecState with the serializer package.
+func (v VecState) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.VecState"
+}
+
+func deserializeLSTMState(d []byte) (lstmState, error) {
+	var res lstmState
+	if err := json.Unmarshal(d, &res); err != nil {
+		return res, err
+	}
+	if len(res.Output) != len(res.Internal) {
+		return res, errors.New("mismatching LSTM state sizes")
+	}
+	return res, nil
+}
+
+func (l lstmState) Serialize() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+func (l lstmState) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.lstmState"
+}
+
+func deserializeGRUState(d []byte) (gruState, error) {
+	var res gruState
+	err := json.Unmarshal(d, &res)
+	return res, err
+}
+
+func (g gruState) Serialize() ([]byte, error) {
+	return json.Marshal(g)
+}
+
+func (g gruState) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.gruState"
+}
+
+func deserializeClockworkState(d []byte) (clockworkState, error) {
+	var res clockworkState
+	err := json.Unmarshal(d, &res)
+	return res, err
+}
+
+func (c clockworkState) Serialize() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+func (c clockworkState) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.clockworkState"
+}
+
+// stackedState is the serializable form of the []State
+// used by StackedBlock and ParallelBlock.
+type stackedState []State
+
+func deserializeStackedState(d []byte) (stackedState, error) {
+	list, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, err
+	}
+	res := make(stackedState, len(list))
+	for i, x := range list {
+		res[i], err = unwrapState(x)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s stackedState) Serialize() ([]byte, error) {
+	list := make([]serializer.Serializer, len(s))
+	for i, x := range s {
+		var err error
+		list[i], err = stateSerializer(x)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return serializer.SerializeSlice(list)
+}
+
+func (s stackedState) SerializerType() string {
+	return "github.com/unixpickle/weakai/rnn.stackedState"
+}
+
+func stateSerializer(s State) (serializer.Serializer, error) {
+	switch s := s.(type) {
+	case []State:
+		return stackedState(s), nil
+	case VecState, lstmState, gruState, clockworkState:
+		return s.(serializer.Serializer), nil
+	default:
+		return nil, fmt.Errorf("cannot serialize state of type %T", s)
+	}
+}
+
+func unwrapState(obj serializer.Serializer) (State, error) {
+	switch obj := obj.(type) {
+	case stackedState:
+		return []State(obj), nil
+	case VecState, lstmState, gruState, clockworkState:
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("not a state: %T", obj)
+	}
+}